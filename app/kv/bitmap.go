@@ -0,0 +1,416 @@
+package kv
+
+// Bitmaps are plain strings addressed bit by bit. Bit 0 is the most
+// significant bit of the first byte, as in Redis. Writes modify the raw
+// bytes of the string in place, reads look at the bytes they need only.
+
+// Max bit offset, the last bit of a string of maxStringLen bytes
+const MaxBitOffset = maxStringLen*8 - 1
+
+// bit returns the bit at offset, 0 past the end of the string.
+func (str StringValue) bit(offset uint64) int {
+	byteIdx := offset >> 3
+	if byteIdx >= uint64(str.len()) {
+		return 0
+	}
+	return int(str.byteAt(int(byteIdx))>>(7-offset&7)) & 1
+}
+
+func setBit(buf []byte, offset uint64, bit int) {
+	byteIdx := offset >> 3
+	mask := byte(1) << (7 - offset&7)
+	if bit == 1 {
+		buf[byteIdx] |= mask
+	} else {
+		buf[byteIdx] &^= mask
+	}
+}
+
+// growBytes zero-pads buf to hold at least n bytes.
+func growBytes(buf []byte, n uint64) []byte {
+	if uint64(len(buf)) >= n {
+		return buf
+	}
+	return append(buf, make([]byte, n-uint64(len(buf)))...)
+}
+
+// SetBit sets the bit at offset and returns its previous value. The
+// string grows as needed.
+func (kv *KVStore) SetBit(key string, offset uint64, bit int) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, _, err := kv.getString(key)
+	if err != nil {
+		return 0, err
+	}
+	old := str.bit(offset)
+	buf := growBytes(str.mutable(), offset>>3+1)
+	setBit(buf, offset, bit)
+	// a missing key has no TTL to keep
+	kv.store(key, StringValue{raw: buf}, StringType)
+	return old, nil
+}
+
+func (kv *KVStore) GetBit(key string, offset uint64) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	str, _, err := kv.getString(key)
+	if err != nil {
+		return 0, err
+	}
+	return str.bit(offset), nil
+}
+
+// BitRange is the optional range of BITCOUNT and BITPOS, in bytes or bits.
+// Negative offsets count from the end.
+type BitRange struct {
+	Start, End int
+	HasStart   bool
+	HasEnd     bool
+	IsBit      bool
+}
+
+// bits returns the first and last bit covered by the range of a string
+// of n bytes, or ok == false for an empty range.
+func (r BitRange) bits(n int) (first, last int, ok bool) {
+	total := n
+	if r.IsBit {
+		total = n * 8
+	}
+	start, end := 0, total-1
+	if r.HasStart {
+		start = r.Start
+	}
+	if r.HasEnd {
+		end = r.End
+	}
+	if start < 0 {
+		start = max(total+start, 0)
+	}
+	if end < 0 {
+		end = max(total+end, 0)
+	}
+	end = min(end, total-1)
+	if total == 0 || start > end {
+		return 0, 0, false
+	}
+	if r.IsBit {
+		return start, end, true
+	}
+	return start * 8, end*8 + 7, true
+}
+
+// BitCount counts the set bits in the range.
+func (kv *KVStore) BitCount(key string, r BitRange) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	str, _, err := kv.getString(key)
+	if err != nil {
+		return 0, err
+	}
+	first, last, ok := r.bits(str.len())
+	if !ok {
+		return 0, nil
+	}
+	cnt := 0
+	for i := first; i <= last; {
+		if i&7 == 0 && i+7 <= last {
+			cnt += popcount(str.byteAt(i >> 3))
+			i += 8
+			continue
+		}
+		cnt += str.bit(uint64(i))
+		i++
+	}
+	return cnt, nil
+}
+
+func popcount(b byte) int {
+	cnt := 0
+	for ; b != 0; b &= b - 1 {
+		cnt++
+	}
+	return cnt
+}
+
+// BitPos returns the position of the first bit set to bit in the range,
+// or -1. When looking for a clear bit without an explicit end, the string
+// is considered padded with zeros on the right.
+func (kv *KVStore) BitPos(key string, bit int, r BitRange) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	str, ok, err := kv.getString(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		if bit == 1 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+	first, last, ok := r.bits(str.len())
+	if !ok {
+		return -1, nil
+	}
+	for i := first; i <= last; i++ {
+		if str.bit(uint64(i)) == bit {
+			return i, nil
+		}
+	}
+	if bit == 0 && !r.HasEnd {
+		return last + 1, nil
+	}
+	return -1, nil
+}
+
+// Bitwise operations of BITOP
+type BitOpKind int
+
+const (
+	BitAnd BitOpKind = iota
+	BitOr
+	BitXor
+	BitNot
+)
+
+// BitOp stores the result of the operation on the strings at keys in
+// dst and returns its length. Shorter strings are zero-padded.
+func (kv *KVStore) BitOp(op BitOpKind, dst string, keys []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	srcs := make([]StringValue, len(keys))
+	maxLen := 0
+	for i, key := range keys {
+		str, _, err := kv.getString(key)
+		if err != nil {
+			return 0, err
+		}
+		srcs[i] = str
+		maxLen = max(maxLen, str.len())
+	}
+
+	res := make([]byte, maxLen)
+	for i := range maxLen {
+		b := srcs[0].byteAt(i)
+		for _, src := range srcs[1:] {
+			switch op {
+			case BitAnd:
+				b &= src.byteAt(i)
+			case BitOr:
+				b |= src.byteAt(i)
+			case BitXor:
+				b ^= src.byteAt(i)
+			}
+		}
+		if op == BitNot {
+			b = ^b
+		}
+		res[i] = b
+	}
+
+	kv.delete(dst)
+	if maxLen > 0 {
+		kv.store(dst, StringValue{raw: res}, StringType)
+	}
+	return maxLen, nil
+}
+
+// Sub-commands of BITFIELD
+type BitFieldKind int
+
+const (
+	BitFieldGet BitFieldKind = iota
+	BitFieldSet
+	BitFieldIncrBy
+)
+
+// Overflow behaviours of BITFIELD SET and INCRBY
+type BitFieldOverflow int
+
+const (
+	OverflowWrap BitFieldOverflow = iota
+	OverflowSat
+	OverflowFail
+)
+
+type BitFieldOp struct {
+	Kind     BitFieldKind
+	Signed   bool
+	Bits     int
+	Offset   uint64
+	Value    int64 // value for SET, increment for INCRBY
+	Overflow BitFieldOverflow
+}
+
+func getUnsignedField(str StringValue, offset uint64, bits int) uint64 {
+	var v uint64
+	for i := range uint64(bits) {
+		v = v<<1 | uint64(str.bit(offset+i))
+	}
+	return v
+}
+
+func getSignedField(str StringValue, offset uint64, bits int) int64 {
+	v := getUnsignedField(str, offset, bits)
+	if bits < 64 && v&(1<<(bits-1)) != 0 {
+		v |= ^uint64(0) << bits // sign extend
+	}
+	return int64(v)
+}
+
+func setField(buf []byte, offset uint64, bits int, v uint64) {
+	for i := range bits {
+		setBit(buf, offset+uint64(i), int(v>>(bits-1-i))&1)
+	}
+}
+
+// checkUnsignedOverflow reports whether value+incr overflows an unsigned
+// field of the given width, and the value to store instead.
+func checkUnsignedOverflow(value uint64, incr int64, bits int, ow BitFieldOverflow) (bool, uint64) {
+	maxVal := uint64(1)<<bits - 1
+	if bits == 64 {
+		maxVal = ^uint64(0)
+	}
+	maxIncr := int64(maxVal - value)
+	minIncr := -int64(value)
+
+	wrap := func() uint64 {
+		return (value + uint64(incr)) & maxVal
+	}
+	if value > maxVal || (incr > 0 && incr > maxIncr) {
+		if ow == OverflowWrap {
+			return true, wrap()
+		}
+		return true, maxVal
+	}
+	if incr < 0 && incr < minIncr {
+		if ow == OverflowWrap {
+			return true, wrap()
+		}
+		return true, 0
+	}
+	return false, 0
+}
+
+// checkSignedOverflow is checkUnsignedOverflow for signed fields.
+func checkSignedOverflow(value, incr int64, bits int, ow BitFieldOverflow) (bool, int64) {
+	maxVal := int64(1)<<(bits-1) - 1
+	if bits == 64 {
+		maxVal = 1<<63 - 1
+	}
+	minVal := -maxVal - 1
+	// these may overflow, but are only used once value is known in range
+	maxIncr := int64(uint64(maxVal) - uint64(value))
+	minIncr := minVal - value
+
+	wrap := func() int64 {
+		c := uint64(value) + uint64(incr)
+		if bits < 64 {
+			mask := ^uint64(0) << bits
+			if c&(1<<(bits-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return int64(c)
+	}
+	if value > maxVal || (bits != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		if ow == OverflowWrap {
+			return true, wrap()
+		}
+		return true, maxVal
+	}
+	if value < minVal || (bits != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		if ow == OverflowWrap {
+			return true, wrap()
+		}
+		return true, minVal
+	}
+	return false, 0
+}
+
+// BitField runs the operations in order. Each GET, SET and INCRBY gives
+// an int64 result, or nil when it failed because of OVERFLOW FAIL.
+func (kv *KVStore) BitField(key string, ops []BitFieldOp) ([]any, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, _, err := kv.getString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// writes grow the string to the largest field they touch
+	write := false
+	for _, op := range ops {
+		if op.Kind != BitFieldGet {
+			write = true
+			str = StringValue{raw: growBytes(str.mutable(), (op.Offset+uint64(op.Bits)-1)>>3+1)}
+		}
+	}
+
+	res := make([]any, 0, len(ops))
+	for _, op := range ops {
+		switch op.Kind {
+		case BitFieldGet:
+			if op.Signed {
+				res = append(res, getSignedField(str, op.Offset, op.Bits))
+			} else {
+				res = append(res, int64(getUnsignedField(str, op.Offset, op.Bits)))
+			}
+			continue
+		}
+
+		var (
+			ret      int64
+			newVal   uint64
+			overflow bool
+		)
+		if op.Signed {
+			oldVal := getSignedField(str, op.Offset, op.Bits)
+			value, incr := op.Value, int64(0)
+			if op.Kind == BitFieldIncrBy {
+				value, incr = oldVal, op.Value
+			}
+			wrapped := int64(0)
+			overflow, wrapped = checkSignedOverflow(value, incr, op.Bits, op.Overflow)
+			if !overflow {
+				wrapped = value + incr
+			}
+			newVal = uint64(wrapped)
+			ret = oldVal
+			if op.Kind == BitFieldIncrBy {
+				ret = wrapped
+			}
+		} else {
+			oldVal := getUnsignedField(str, op.Offset, op.Bits)
+			value, incr := uint64(op.Value), int64(0)
+			if op.Kind == BitFieldIncrBy {
+				value, incr = oldVal, op.Value
+			}
+			wrapped := uint64(0)
+			overflow, wrapped = checkUnsignedOverflow(value, incr, op.Bits, op.Overflow)
+			if !overflow {
+				wrapped = value + uint64(incr)
+			}
+			newVal = wrapped
+			ret = int64(oldVal)
+			if op.Kind == BitFieldIncrBy {
+				ret = int64(wrapped)
+			}
+		}
+		if overflow && op.Overflow == OverflowFail {
+			res = append(res, nil)
+			continue
+		}
+		setField(str.raw, op.Offset, op.Bits, newVal)
+		res = append(res, ret)
+	}
+
+	if write {
+		// a missing key has no TTL to keep
+		kv.store(key, str, StringType)
+	}
+	return res, nil
+}
@@ -0,0 +1,180 @@
+package kv
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetBitGetBit(t *testing.T) {
+	kv := NewKVStore()
+	if old, _ := kv.SetBit("k", 7, 1); old != 0 {
+		t.Errorf("SetBit on a missing key = %d, want 0", old)
+	}
+	if old, _ := kv.SetBit("k", 7, 1); old != 1 {
+		t.Errorf("SetBit of a set bit = %d, want 1", old)
+	}
+	kv.SetBit("k", 9, 1)
+	if got, _ := kv.Get("k"); got != "\x01\x40" {
+		t.Errorf("value = %q, want \\x01\\x40", got)
+	}
+	for offset, want := range map[uint64]int{0: 0, 7: 1, 9: 1, 10: 0, 1000: 0} {
+		if got, _ := kv.GetBit("k", offset); got != want {
+			t.Errorf("GetBit(%d) = %d, want %d", offset, got, want)
+		}
+	}
+	kv.SetBit("k", 7, 0)
+	if got, _ := kv.Get("k"); got != "\x00\x40" {
+		t.Errorf("value after clearing = %q", got)
+	}
+}
+
+// SETBIT writes in place: a big bitmap isn't copied on every write, and a
+// copy made by COPY doesn't share its bytes.
+func TestSetBitInPlace(t *testing.T) {
+	kv := NewKVStore()
+	kv.SetBit("k", 1<<20, 1)
+	raw := func(key string) *byte {
+		val, _ := kv.load(key)
+		return &val.v.(StringValue).raw[0]
+	}
+	before := raw("k")
+	for i := range uint64(100) {
+		kv.SetBit("k", i, 1)
+	}
+	if raw("k") != before {
+		t.Error("SetBit reallocated a string long enough for the bit")
+	}
+
+	kv.Copy("k", kv, "c", false)
+	kv.SetBit("c", 0, 0)
+	if bit, _ := kv.GetBit("k", 0); bit != 1 {
+		t.Error("SetBit on a copy changed the original")
+	}
+	kv.SetRange("c", 1, "x")
+	if got, _ := kv.GetRange("k", 1, 1); got != "\xff" {
+		t.Errorf("SetRange on a copy changed the original: %q", got)
+	}
+}
+
+func TestBitCount(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("k", "foobar")
+	tests := []struct {
+		r    BitRange
+		want int
+	}{
+		{BitRange{}, 26},
+		{BitRange{Start: 0, End: 0, HasStart: true, HasEnd: true}, 4},
+		{BitRange{Start: 1, End: 1, HasStart: true, HasEnd: true}, 6},
+		{BitRange{Start: -2, End: -1, HasStart: true, HasEnd: true}, 7},
+		{BitRange{Start: 5, End: 30, HasStart: true, HasEnd: true, IsBit: true}, 17},
+		{BitRange{Start: 2, End: 1, HasStart: true, HasEnd: true}, 0},
+	}
+	for _, tt := range tests {
+		if got, _ := kv.BitCount("k", tt.r); got != tt.want {
+			t.Errorf("BitCount(%+v) = %d, want %d", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestBitPos(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("k", "\xff\xf0\x00")
+	kv.Set("ones", "\xff\xff")
+	tests := []struct {
+		key  string
+		bit  int
+		r    BitRange
+		want int
+	}{
+		{"k", 0, BitRange{}, 12},
+		{"k", 1, BitRange{Start: 2, HasStart: true}, -1},
+		{"k", 1, BitRange{Start: 7, End: 15, HasStart: true, HasEnd: true, IsBit: true}, 7},
+		{"ones", 0, BitRange{}, 16},
+		{"ones", 0, BitRange{Start: 0, End: -1, HasStart: true, HasEnd: true}, -1},
+		{"missing", 0, BitRange{}, 0},
+		{"missing", 1, BitRange{}, -1},
+	}
+	for _, tt := range tests {
+		if got, _ := kv.BitPos(tt.key, tt.bit, tt.r); got != tt.want {
+			t.Errorf("BitPos(%s, %d, %+v) = %d, want %d", tt.key, tt.bit, tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("a", "\xf0\x0f")
+	kv.Set("b", "\xff")
+	tests := []struct {
+		op   BitOpKind
+		keys []string
+		want string
+	}{
+		{BitAnd, []string{"a", "b"}, "\xf0\x00"},
+		{BitOr, []string{"a", "b"}, "\xff\x0f"},
+		{BitXor, []string{"a", "b"}, "\x0f\x0f"},
+		{BitNot, []string{"a"}, "\x0f\xf0"},
+		{BitAnd, []string{"a", "missing"}, "\x00\x00"},
+	}
+	for _, tt := range tests {
+		n, err := kv.BitOp(tt.op, "dst", tt.keys)
+		got, _ := kv.Get("dst")
+		if err != nil || n != len(tt.want) || got != tt.want {
+			t.Errorf("BitOp(%d, %v) = %d, %q, %v, want %q", tt.op, tt.keys, n, got, err, tt.want)
+		}
+	}
+	if n, _ := kv.BitOp(BitOr, "dst", []string{"missing"}); n != 0 || kv.Exists("dst") != 0 {
+		t.Error("BitOp of missing keys should delete the destination")
+	}
+}
+
+func TestBitField(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []BitFieldOp
+		want []any
+	}{
+		{"set and get", []BitFieldOp{
+			{Kind: BitFieldSet, Bits: 8, Offset: 0, Value: 255},
+			{Kind: BitFieldGet, Bits: 8, Offset: 0},
+			{Kind: BitFieldGet, Signed: true, Bits: 8, Offset: 0},
+			{Kind: BitFieldGet, Bits: 4, Offset: 4},
+		}, []any{int64(0), int64(255), int64(-1), int64(15)}},
+		{"unsigned wrap", []BitFieldOp{
+			{Kind: BitFieldIncrBy, Bits: 2, Offset: 100, Value: 1},
+			{Kind: BitFieldIncrBy, Bits: 2, Offset: 100, Value: 1},
+			{Kind: BitFieldIncrBy, Bits: 2, Offset: 100, Value: 1},
+			{Kind: BitFieldIncrBy, Bits: 2, Offset: 100, Value: 1},
+		}, []any{int64(1), int64(2), int64(3), int64(0)}},
+		{"unsigned sat and fail", []BitFieldOp{
+			{Kind: BitFieldIncrBy, Bits: 2, Offset: 102, Value: 5, Overflow: OverflowSat},
+			{Kind: BitFieldIncrBy, Bits: 2, Offset: 102, Value: -5, Overflow: OverflowSat},
+			{Kind: BitFieldIncrBy, Bits: 2, Offset: 102, Value: 4, Overflow: OverflowFail},
+		}, []any{int64(3), int64(0), nil}},
+		{"signed", []BitFieldOp{
+			{Kind: BitFieldSet, Signed: true, Bits: 8, Offset: 0, Value: 127},
+			{Kind: BitFieldIncrBy, Signed: true, Bits: 8, Offset: 0, Value: 1},
+			{Kind: BitFieldIncrBy, Signed: true, Bits: 8, Offset: 0, Value: -1, Overflow: OverflowSat},
+			{Kind: BitFieldIncrBy, Signed: true, Bits: 8, Offset: 0, Value: 300, Overflow: OverflowSat},
+			{Kind: BitFieldIncrBy, Signed: true, Bits: 8, Offset: 0, Value: 1, Overflow: OverflowFail},
+		}, []any{int64(0), int64(-128), int64(-128), int64(127), nil}},
+		{"i64", []BitFieldOp{
+			{Kind: BitFieldSet, Signed: true, Bits: 64, Offset: 3, Value: 1<<63 - 1},
+			{Kind: BitFieldIncrBy, Signed: true, Bits: 64, Offset: 3, Value: 1},
+		}, []any{int64(0), int64(-1 << 63)}},
+	}
+	for _, tt := range tests {
+		kv := NewKVStore()
+		got, err := kv.BitField("k", tt.ops)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: BitField = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	kv := NewKVStore()
+	kv.BitField("k", []BitFieldOp{{Kind: BitFieldGet, Bits: 8, Offset: 800}})
+	if kv.Exists("k") != 0 {
+		t.Error("a BITFIELD GET created the key")
+	}
+}
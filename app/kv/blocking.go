@@ -0,0 +1,200 @@
+package kv
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// blockedClient is a client waiting for data on one or more keys, like
+// BLPOP, BLMOVE or BZPOPMIN. It sits in the waiting queue of each of its
+// keys.
+type blockedClient struct {
+	db   atomic.Pointer[KVStore] // the store it waits in, SWAPDB moves it
+	keys []string
+	t    ValueType       // the type of value the client can be served from
+	ctx  context.Context // done once the client's connection is closed
+	// serve tries to complete the command from key of db, with its keyMu
+	// held. ok is false when there is nothing to serve and the client
+	// keeps waiting.
+	serve  func(db *KVStore, key string) (res any, ok bool, err error)
+	result chan blockResult // buffered, so serving never blocks
+}
+
+type blockResult struct {
+	res any
+	err error
+}
+
+// BlockOptions are the parameters of a blocking command.
+type BlockOptions struct {
+	// Ctx is the client's connection: the command gives up waiting once
+	// it is done. nil never cancels.
+	Ctx     context.Context
+	Timeout time.Duration // zero waits forever
+	// Served, if set, is called with keyMu held once the command took n
+	// elements from key, before any client is woken by them. Blocking
+	// commands are replicated from there, as the pop or move they made,
+	// in order with the write that served them.
+	Served func(key string, n int)
+}
+
+func (o BlockOptions) served(key string, n int) {
+	if o.Served != nil {
+		o.Served(key, n)
+	}
+}
+
+// blockingOp completes a blocking command: keys are tried in order, and
+// if none can serve the client it waits until a write to one of them
+// does, up to opts.Timeout or until opts.Ctx is done. nil is returned
+// when it gives up.
+//
+// Waiting clients are served by the writing command itself, in the
+// order they blocked, so an element is never grabbed by another client
+// between the wake-up and the pop.
+func (kv *KVStore) blockingOp(keys []string, t ValueType, opts BlockOptions, serve func(db *KVStore, key string) (any, bool, error)) (any, error) {
+	kv.keyMu.Lock()
+	for _, key := range keys {
+		res, ok, err := serve(kv, key)
+		if ok || err != nil {
+			kv.keyMu.Unlock()
+			return res, err
+		}
+	}
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := &blockedClient{
+		keys:   keys,
+		t:      t,
+		ctx:    ctx,
+		serve:  serve,
+		result: make(chan blockResult, 1),
+	}
+	c.db.Store(kv)
+	kv.block(c)
+	kv.keyMu.Unlock()
+
+	var expired <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case r := <-c.result:
+		return r.res, r.err
+	case <-expired:
+	case <-ctx.Done():
+	}
+
+	db := c.lockDB()
+	served := !db.unblock(c)
+	db.keyMu.Unlock()
+	if served {
+		// served while timing out, the result is already waiting
+		r := <-c.result
+		return r.res, r.err
+	}
+	return nil, nil
+}
+
+// lockDB locks the keyspace of the store c waits in, which SWAPDB may
+// change until it is locked.
+func (c *blockedClient) lockDB() *KVStore {
+	for {
+		db := c.db.Load()
+		db.keyMu.Lock()
+		if c.db.Load() == db {
+			return db
+		}
+		db.keyMu.Unlock()
+	}
+}
+
+// block appends c to the waiting queues of its keys. The caller must hold
+// keyMu.
+func (kv *KVStore) block(c *blockedClient) {
+	for _, key := range c.keys {
+		kv.watingQueue[key] = append(kv.watingQueue[key], c)
+	}
+}
+
+// unblock removes c from the waiting queues of its keys. Returns false if
+// it was not blocked anymore. The caller must hold keyMu.
+func (kv *KVStore) unblock(c *blockedClient) bool {
+	found := false
+	for _, key := range c.keys {
+		wQ := kv.watingQueue[key]
+		for i, other := range wQ {
+			if other != c {
+				continue
+			}
+			found = true
+			if len(wQ) == 1 {
+				delete(kv.watingQueue, key)
+			} else {
+				kv.watingQueue[key] = append(wQ[:i:i], wQ[i+1:]...)
+			}
+			break
+		}
+	}
+	return found
+}
+
+// wake serves the clients blocked on key, oldest first, for as long as
+// key holds a value of the type they wait for. The caller must hold
+// keyMu and call it after every write that may add data to key.
+func (kv *KVStore) wake(key string) {
+	wQ := kv.watingQueue[key]
+	if len(wQ) == 0 {
+		return
+	}
+	// serving may change the queues (BLMOVE pushes to its destination),
+	// so iterate over a snapshot and skip clients served in the meantime
+	for _, c := range append([]*blockedClient(nil), wQ...) {
+		val, ok := kv.load(key)
+		if !ok {
+			return
+		}
+		// a closed client is removed by its own goroutine, don't let it
+		// take data nobody will receive
+		if val.t != c.t || c.ctx.Err() != nil {
+			continue
+		}
+		// unblock first, serving may wake key again
+		if !kv.unblock(c) {
+			continue
+		}
+		res, ok, err := c.serve(kv, key)
+		if !ok && err == nil {
+			// empty values are never stored, but don't lose the client
+			kv.block(c)
+			continue
+		}
+		c.result <- blockResult{res, err}
+	}
+}
+
+// SwapWaiters exchanges the clients blocked in a and b, following SWAPDB
+// which exchanges their data: a client keeps waiting on the same database
+// index. Those whose keys now hold data are served right away.
+func SwapWaiters(a, b *KVStore) {
+	unlock := lockPair(a, b)
+	defer unlock()
+	a.watingQueue, b.watingQueue = b.watingQueue, a.watingQueue
+	for _, db := range []*KVStore{a, b} {
+		keys := make([]string, 0, len(db.watingQueue))
+		for key, wQ := range db.watingQueue {
+			keys = append(keys, key)
+			for _, c := range wQ {
+				c.db.Store(db)
+			}
+		}
+		for _, key := range keys {
+			db.wake(key)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package kv
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func blpop(kv *KVStore, opts BlockOptions, keys ...string) <-chan any {
+	return blockOn(func() any {
+		key, elems, err := kv.BLMPop(keys, true, 1, opts)
+		if err != nil {
+			return err
+		}
+		if elems == nil {
+			return nil
+		}
+		return key + ":" + elems[0]
+	})
+}
+
+func TestBLMPopKeyOrder(t *testing.T) {
+	kv := NewKVStore()
+	kv.RPush("b", []string{"1"})
+	kv.RPush("c", []string{"2"})
+	key, elems, _ := kv.BLMPop([]string{"a", "b", "c"}, true, 5, BlockOptions{})
+	if key != "b" || !slices.Equal(elems, []string{"1"}) {
+		t.Errorf("BLMPop = %s %q, want the first non-empty key b", key, elems)
+	}
+
+	// blocked on several keys, served by whichever receives data first
+	done := blpop(kv, BlockOptions{}, "x", "y")
+	kv.RPush("y", []string{"v"})
+	if got := waitFor(t, done); got != "y:v" {
+		t.Errorf("BLMPop = %v, want y:v", got)
+	}
+	if len(kv.watingQueue) != 0 {
+		t.Errorf("served client left in the waiting queues: %v", kv.watingQueue)
+	}
+}
+
+// Clients blocked on a key are served in the order they blocked, and
+// those that get nothing keep waiting.
+func TestBLMPopFIFO(t *testing.T) {
+	kv := NewKVStore()
+	first := blpop(kv, BlockOptions{}, "l")
+	second := blpop(kv, BlockOptions{}, "other", "l")
+	third := blpop(kv, BlockOptions{}, "l")
+
+	kv.RPush("l", []string{"a", "b"})
+	if got := waitFor(t, first); got != "l:a" {
+		t.Errorf("first client = %v, want l:a", got)
+	}
+	if got := waitFor(t, second); got != "l:b" {
+		t.Errorf("second client = %v, want l:b", got)
+	}
+	select {
+	case got := <-third:
+		t.Fatalf("third client served with %v, nothing was left", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if kv.Exists("l") != 0 {
+		t.Errorf("list left after serving every element")
+	}
+
+	kv.LPush("l", []string{"c"})
+	if got := waitFor(t, third); got != "l:c" {
+		t.Errorf("third client = %v, want l:c", got)
+	}
+}
+
+func TestBLMPopCount(t *testing.T) {
+	kv := NewKVStore()
+	done := blockOn(func() any {
+		_, elems, _ := kv.BLMPop([]string{"l"}, false, 2, BlockOptions{})
+		return elems
+	})
+	kv.RPush("l", []string{"a", "b", "c"})
+	if got := waitFor(t, done).([]string); !slices.Equal(got, []string{"c", "b"}) {
+		t.Errorf("BLMPop COUNT 2 from the right = %q", got)
+	}
+	if got := listOf(t, kv); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("list = %q", got)
+	}
+}
+
+func TestBLMPopTimeout(t *testing.T) {
+	kv := NewKVStore()
+	start := time.Now()
+	_, elems, err := kv.BLMPop([]string{"a", "b"}, true, 1, BlockOptions{Timeout: 30 * time.Millisecond})
+	if elems != nil || err != nil {
+		t.Errorf("BLMPop timing out = %q, %v", elems, err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("BLMPop returned after %v", d)
+	}
+	if len(kv.watingQueue) != 0 {
+		t.Errorf("timed out client left in the waiting queues: %v", kv.watingQueue)
+	}
+}
+
+// A client whose connection is closed stops waiting and doesn't take
+// the data pushed afterwards.
+func TestBLMPopCanceled(t *testing.T) {
+	kv := NewKVStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := blpop(kv, BlockOptions{Ctx: ctx}, "l")
+	cancel()
+	if got := waitFor(t, done); got != nil {
+		t.Errorf("canceled BLMPop = %v, want nil", got)
+	}
+	kv.RPush("l", []string{"a"})
+	if got := listOf(t, kv); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("list after the canceled client = %q", got)
+	}
+	if len(kv.watingQueue) != 0 {
+		t.Errorf("canceled client left in the waiting queues: %v", kv.watingQueue)
+	}
+}
+
+// A write of another type to the key doesn't serve, nor drop, the client.
+func TestBLMPopOtherType(t *testing.T) {
+	kv := NewKVStore()
+	done := blpop(kv, BlockOptions{}, "k")
+	kv.ZAdd("k", "m", 1)
+	select {
+	case got := <-done:
+		t.Fatalf("BLMPop served by a sorted set with %v", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	kv.Del("k")
+	kv.RPush("k", []string{"a"})
+	if got := waitFor(t, done); got != "k:a" {
+		t.Errorf("BLMPop = %v, want k:a", got)
+	}
+}
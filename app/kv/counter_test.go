@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIncrBy(t *testing.T) {
+	tests := []struct {
+		initial string // "" for a missing key
+		incr    int64
+		want    int64
+		wantErr error
+	}{
+		{"", 5, 5, nil},
+		{"10", -15, -5, nil},
+		{"9223372036854775806", 1, math.MaxInt64, nil},
+		{"9223372036854775807", 1, 0, ErrOverflow},
+		{"-9223372036854775808", -1, 0, ErrOverflow},
+		{"-9223372036854775807", math.MinInt64, 0, ErrOverflow},
+		{"abc", 1, 0, ErrNotInteger},
+		{"1.5", 1, 0, ErrNotInteger},
+		{" 1", 1, 0, ErrNotInteger},
+		{"01", 1, 0, ErrNotInteger},
+		{"+1", 1, 0, ErrNotInteger},
+		{"99999999999999999999", 1, 0, ErrNotInteger},
+	}
+	for _, tt := range tests {
+		kv := NewKVStore()
+		if tt.initial != "" {
+			kv.Set("k", tt.initial)
+		}
+		got, err := kv.IncrBy("k", tt.incr)
+		if got != tt.want || err != tt.wantErr {
+			t.Errorf("IncrBy(%q, %d) = %d, %v, want %d, %v", tt.initial, tt.incr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestIncrByFloat(t *testing.T) {
+	tests := []struct {
+		initial string
+		incr    float64
+		want    string
+		wantErr error
+	}{
+		{"", 0.1, "0.1", nil},
+		{"10.50", 0.1, "10.6", nil},
+		{"5.0e3", 200, "5200", nil},
+		{"3", -3, "0", nil},
+		{"1", 1e20, "100000000000000000000", nil},
+		{"abc", 1, "", ErrNotFloat},
+		{"inf", 1, "", ErrNotFloat},
+		{"1.7976931348623157e308", 1.7976931348623157e308, "", ErrNaN},
+	}
+	for _, tt := range tests {
+		kv := NewKVStore()
+		if tt.initial != "" {
+			kv.Set("k", tt.initial)
+		}
+		got, err := kv.IncrByFloat("k", tt.incr)
+		if got != tt.want || err != tt.wantErr {
+			t.Errorf("IncrByFloat(%q, %v) = %q, %v, want %q, %v", tt.initial, tt.incr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// Counters keep the TTL of the key they modify.
+func TestIncrKeepsTTL(t *testing.T) {
+	kv := NewKVStore()
+	at := time.Now().Add(time.Hour)
+	kv.Set("i", "1")
+	kv.Set("f", "1")
+	kv.Expire("i", at, ExpireAlways)
+	kv.Expire("f", at, ExpireAlways)
+	kv.IncrBy("i", 1)
+	kv.IncrByFloat("f", 1.5)
+	for _, key := range []string{"i", "f"} {
+		if kv.ExpireTime(key) != at.UnixMilli() {
+			t.Errorf("%s lost its TTL", key)
+		}
+	}
+	if enc, _ := kv.ObjectEncoding("i"); enc != "int" {
+		t.Errorf("encoding after INCR = %s, want int", enc)
+	}
+}
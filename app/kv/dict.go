@@ -0,0 +1,260 @@
+package kv
+
+import (
+	"hash/maphash"
+	"iter"
+	"math/bits"
+	"math/rand"
+)
+
+const minDictBuckets = 4
+
+var dictSeed = maphash.MakeSeed()
+
+type dictEntry[V any] struct {
+	key string
+	val V
+}
+
+// dict is the hash table behind hashes, sets and sorted sets. Like
+// keyIndex it keeps its entries in a power-of-two number of buckets, so
+// HSCAN, SSCAN and ZSCAN can walk it with a cursor that stays valid while
+// the table is resized, and random members are picked without listing
+// them all. It is guarded by the keyMu of the store holding it.
+//
+// Reads on a nil dict behave like on a nil map.
+type dict[V any] struct {
+	buckets [][]dictEntry[V]
+	count   int
+}
+
+func newDict[V any]() *dict[V] {
+	return &dict[V]{buckets: make([][]dictEntry[V], minDictBuckets)}
+}
+
+func (d *dict[V]) bucketOf(key string, n int) int {
+	return int(maphash.String(dictSeed, key) & uint64(n-1))
+}
+
+func (d *dict[V]) len() int {
+	if d == nil {
+		return 0
+	}
+	return d.count
+}
+
+func (d *dict[V]) get(key string) (V, bool) {
+	if d == nil || d.count == 0 {
+		var zero V
+		return zero, false
+	}
+	for _, e := range d.buckets[d.bucketOf(key, len(d.buckets))] {
+		if e.key == key {
+			return e.val, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func (d *dict[V]) has(key string) bool {
+	_, ok := d.get(key)
+	return ok
+}
+
+// set stores val at key and returns whether key was added.
+func (d *dict[V]) set(key string, val V) bool {
+	i := d.bucketOf(key, len(d.buckets))
+	b := d.buckets[i]
+	for j := range b {
+		if b[j].key == key {
+			b[j].val = val
+			return false
+		}
+	}
+	d.buckets[i] = append(b, dictEntry[V]{key, val})
+	d.count++
+	if d.count > len(d.buckets) {
+		d.resize(len(d.buckets) * 2)
+	}
+	return true
+}
+
+// delete removes key and returns whether it was present.
+func (d *dict[V]) delete(key string) bool {
+	if d == nil {
+		return false
+	}
+	i := d.bucketOf(key, len(d.buckets))
+	b := d.buckets[i]
+	for j := range b {
+		if b[j].key != key {
+			continue
+		}
+		last := len(b) - 1
+		b[j] = b[last]
+		b[last] = dictEntry[V]{}
+		d.buckets[i] = b[:last]
+		d.count--
+		if len(d.buckets) > minDictBuckets && d.count < len(d.buckets)/8 {
+			d.resize(len(d.buckets) / 2)
+		}
+		return true
+	}
+	return false
+}
+
+func (d *dict[V]) resize(n int) {
+	buckets := make([][]dictEntry[V], n)
+	for _, b := range d.buckets {
+		for _, e := range b {
+			i := d.bucketOf(e.key, n)
+			buckets[i] = append(buckets[i], e)
+		}
+	}
+	d.buckets = buckets
+}
+
+// clear empties the dict, releasing its entries.
+func (d *dict[V]) clear() {
+	if d == nil {
+		return
+	}
+	d.buckets = make([][]dictEntry[V], minDictBuckets)
+	d.count = 0
+}
+
+func (d *dict[V]) clone() *dict[V] {
+	c := &dict[V]{buckets: make([][]dictEntry[V], len(d.buckets)), count: d.count}
+	for i, b := range d.buckets {
+		if len(b) > 0 {
+			c.buckets[i] = append([]dictEntry[V](nil), b...)
+		}
+	}
+	return c
+}
+
+// all iterates over the entries in no particular order. The dict must
+// not be modified meanwhile.
+func (d *dict[V]) all() iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		if d == nil {
+			return
+		}
+		for _, b := range d.buckets {
+			for _, e := range b {
+				if !yield(e.key, e.val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// scan calls fn for the entries of the bucket at cursor and returns the
+// next cursor, 0 when the iteration is complete.
+func (d *dict[V]) scan(cursor uint64, fn func(key string, val V)) uint64 {
+	if d.len() == 0 {
+		return 0
+	}
+	mask := uint64(len(d.buckets) - 1)
+	for _, e := range d.buckets[cursor&mask] {
+		fn(e.key, e.val)
+	}
+	return nextCursor(cursor, mask)
+}
+
+// random returns a random entry, or false when the dict is empty.
+func (d *dict[V]) random() (string, V, bool) {
+	if d.len() == 0 {
+		var zero V
+		return "", zero, false
+	}
+	for {
+		b := d.buckets[rand.Intn(len(d.buckets))]
+		if len(b) == 0 {
+			continue
+		}
+		e := b[rand.Intn(len(b))]
+		return e.key, e.val, true
+	}
+}
+
+// sample returns random entries, count of them following the rules of
+// sampleIndexes.
+func (d *dict[V]) sample(count int) []dictEntry[V] {
+	if d.len() == 0 {
+		return nil
+	}
+	if count < 0 {
+		res := make([]dictEntry[V], 0, -count)
+		for range -count {
+			key, val, _ := d.random()
+			res = append(res, dictEntry[V]{key, val})
+		}
+		return res
+	}
+	count = min(count, d.count)
+	if count*3 > d.count {
+		// most entries are returned, shuffle them all
+		all := make([]dictEntry[V], 0, d.count)
+		for key, val := range d.all() {
+			all = append(all, dictEntry[V]{key, val})
+		}
+		for i := range count {
+			j := i + rand.Intn(len(all)-i)
+			all[i], all[j] = all[j], all[i]
+		}
+		return all[:count]
+	}
+	res := make([]dictEntry[V], 0, count)
+	picked := make(map[string]struct{}, count)
+	for len(res) < count {
+		key, val, _ := d.random()
+		if _, ok := picked[key]; !ok {
+			picked[key] = struct{}{}
+			res = append(res, dictEntry[V]{key, val})
+		}
+	}
+	return res
+}
+
+// sampleIndexes picks random indexes below n, the members returned by
+// SRANDMEMBER and the like: count distinct ones, or -count that may
+// repeat when count is negative. Like Redis, a sample much smaller than n
+// is drawn by picking again the indexes already seen, so it costs
+// O(count) instead of O(n). n must not be 0.
+func sampleIndexes(n, count int) []int {
+	if count < 0 {
+		res := make([]int, -count)
+		for i := range res {
+			res[i] = rand.Intn(n)
+		}
+		return res
+	}
+	count = min(count, n)
+	if count*3 > n {
+		return rand.Perm(n)[:count]
+	}
+	res := make([]int, 0, count)
+	picked := make(map[int]struct{}, count)
+	for len(res) < count {
+		i := rand.Intn(n)
+		if _, ok := picked[i]; !ok {
+			picked[i] = struct{}{}
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// nextCursor increments the reversed cursor, considering only the bits
+// of mask, the bucket count minus one. Walking the buckets in this order
+// visits every bucket of a table that grew or shrank between two calls,
+// at the price of a few duplicates.
+func nextCursor(cursor, mask uint64) uint64 {
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
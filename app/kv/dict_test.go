@@ -0,0 +1,124 @@
+package kv
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDict(t *testing.T) {
+	d := newDict[int]()
+	for i := range 1000 {
+		if !d.set(strconv.Itoa(i), i) {
+			t.Fatalf("set(%d) did not add the key", i)
+		}
+	}
+	if d.set("7", 70) {
+		t.Error("set of an existing key reported it as added")
+	}
+	if v, ok := d.get("7"); !ok || v != 70 {
+		t.Errorf("get(7) = %d, %v, want 70", v, ok)
+	}
+	if d.len() != 1000 || len(d.buckets) < 1000 {
+		t.Errorf("len = %d with %d buckets", d.len(), len(d.buckets))
+	}
+
+	c := d.clone()
+	for i := range 990 {
+		if !d.delete(strconv.Itoa(i)) {
+			t.Fatalf("delete(%d) did not find the key", i)
+		}
+	}
+	if d.delete("0") {
+		t.Error("delete of a missing key reported it as present")
+	}
+	if d.len() != 10 || len(d.buckets) > 80 {
+		t.Errorf("after deletes len = %d with %d buckets, want 10 and a smaller table", d.len(), len(d.buckets))
+	}
+	if c.len() != 1000 || !c.has("0") {
+		t.Error("the clone changed with the original")
+	}
+
+	var nilDict *dict[int]
+	if nilDict.len() != 0 || nilDict.has("a") || nilDict.delete("a") {
+		t.Error("reads on a nil dict should find nothing")
+	}
+	for range nilDict.all() {
+		t.Error("a nil dict has entries")
+	}
+}
+
+func TestDictScan(t *testing.T) {
+	d := newDict[struct{}]()
+	for i := range 100 {
+		d.set("stable"+strconv.Itoa(i), struct{}{})
+	}
+	seen := map[string]bool{}
+	cursor, next := uint64(0), 0
+	for {
+		cursor = scanDict(d, cursor, 5, func(key string, _ struct{}) {
+			seen[key] = true
+		})
+		if cursor == 0 {
+			break
+		}
+		// grow the table while scanning
+		for end := next + 50; next < end && next < 2000; next++ {
+			d.set("tmp"+strconv.Itoa(next), struct{}{})
+		}
+	}
+	for i := range 100 {
+		if !seen["stable"+strconv.Itoa(i)] {
+			t.Errorf("scan missed stable%d", i)
+		}
+	}
+}
+
+func TestDictSample(t *testing.T) {
+	d := newDict[int]()
+	for i := range 1000 {
+		d.set(strconv.Itoa(i), i)
+	}
+	for _, count := range []int{1, 10, 400, 1000, 5000} {
+		entries := d.sample(count)
+		if len(entries) != min(count, 1000) {
+			t.Errorf("sample(%d) returned %d entries", count, len(entries))
+		}
+		distinct := map[string]bool{}
+		for _, e := range entries {
+			if v, _ := d.get(e.key); v != e.val {
+				t.Errorf("sample(%d) returned %s = %d, stored %d", count, e.key, e.val, v)
+			}
+			distinct[e.key] = true
+		}
+		if len(distinct) != len(entries) {
+			t.Errorf("sample(%d) repeated entries", count)
+		}
+	}
+	if entries := d.sample(-3000); len(entries) != 3000 {
+		t.Errorf("sample(-3000) returned %d entries", len(entries))
+	}
+	if entries := newDict[int]().sample(5); len(entries) != 0 {
+		t.Errorf("sample of an empty dict returned %v", entries)
+	}
+}
+
+func TestSampleIndexes(t *testing.T) {
+	for _, tt := range []struct{ n, count, want int }{
+		{10, 3, 3}, {10, 8, 8}, {10, 20, 10}, {100000, 5, 5}, {5, -12, 12},
+	} {
+		idx := sampleIndexes(tt.n, tt.count)
+		if len(idx) != tt.want {
+			t.Errorf("sampleIndexes(%d, %d) returned %d indexes, want %d", tt.n, tt.count, len(idx), tt.want)
+		}
+		seen := map[int]bool{}
+		for _, i := range idx {
+			if i < 0 || i >= tt.n {
+				t.Errorf("sampleIndexes(%d, %d) returned %d", tt.n, tt.count, i)
+			}
+			if seen[i] && tt.count > 0 {
+				t.Errorf("sampleIndexes(%d, %d) repeated %d", tt.n, tt.count, i)
+			}
+			seen[i] = true
+		}
+	}
+}
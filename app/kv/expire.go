@@ -0,0 +1,174 @@
+package kv
+
+import (
+	"time"
+)
+
+const (
+	activeExpireInterval = 100 * time.Millisecond // How often the active expire cycle runs
+	activeExpireBudget   = 25 * time.Millisecond  // Max time spent per cycle
+	activeExpireSamples  = 20                     // Keys with a TTL sampled per round
+)
+
+// Conditions for EXPIRE and friends
+type ExpireFlag int
+
+const (
+	ExpireAlways ExpireFlag = iota
+	ExpireNX                // only when the key has no expiry
+	ExpireXX                // only when the key has an expiry
+	ExpireGT                // only when the new expiry is greater than the current one
+	ExpireLT                // only when the new expiry is less than the current one
+)
+
+func (kv *KVStore) isExpired(key string) bool {
+	at, ok := kv.getExpire(key)
+	if !ok {
+		return false
+	}
+	return !time.Now().Before(at)
+}
+
+func (kv *KVStore) getExpire(key string) (time.Time, bool) {
+	kv.expMu.Lock()
+	defer kv.expMu.Unlock()
+	at, ok := kv.expires[key]
+	return at, ok
+}
+
+func (kv *KVStore) setExpire(key string, at time.Time) {
+	kv.expMu.Lock()
+	defer kv.expMu.Unlock()
+	kv.expires[key] = at
+}
+
+// clearExpire removes the TTL of key. Returns whether it had one.
+func (kv *KVStore) clearExpire(key string) bool {
+	kv.expMu.Lock()
+	defer kv.expMu.Unlock()
+	_, ok := kv.expires[key]
+	delete(kv.expires, key)
+	return ok
+}
+
+// SetExpireAt sets the expiry of an existing key without any condition.
+func (kv *KVStore) SetExpireAt(key string, at time.Time) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	if _, ok := kv.mp.Load(key); ok {
+		kv.setExpire(key, at)
+	}
+}
+
+// Expire sets the expiry of key to `at`. An expiry in the past deletes the key.
+// Returns 1 if the timeout was set (or the key deleted), 0 otherwise.
+func (kv *KVStore) Expire(key string, at time.Time, flag ExpireFlag) int {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+
+	if _, ok := kv.load(key); !ok {
+		return 0
+	}
+
+	cur, hasTTL := kv.getExpire(key)
+	switch flag {
+	case ExpireNX:
+		if hasTTL {
+			return 0
+		}
+	case ExpireXX:
+		if !hasTTL {
+			return 0
+		}
+	case ExpireGT:
+		// A key without TTL is treated as an infinite TTL
+		if !hasTTL || !at.After(cur) {
+			return 0
+		}
+	case ExpireLT:
+		if hasTTL && !at.Before(cur) {
+			return 0
+		}
+	}
+
+	if !time.Now().Before(at) {
+		kv.delete(key)
+		return 1
+	}
+	kv.setExpire(key, at)
+	return 1
+}
+
+// Persist removes the expiry of key. Returns 1 if a timeout was removed.
+func (kv *KVStore) Persist(key string) int {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+
+	if _, ok := kv.load(key); !ok {
+		return 0
+	}
+	if !kv.clearExpire(key) {
+		return 0
+	}
+	return 1
+}
+
+// ExpireTime returns the absolute unix time in milliseconds at which key
+// expires, -1 if the key has no expiry and -2 if it does not exist.
+func (kv *KVStore) ExpireTime(key string) int64 {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+
+	if _, ok := kv.load(key); !ok {
+		return -2
+	}
+	at, ok := kv.getExpire(key)
+	if !ok {
+		return -1
+	}
+	return at.UnixMilli()
+}
+
+// Background reclamation of expired keys, modeled on Redis's active expire
+// cycle: sample a few keys with a TTL, delete the expired ones and keep
+// going while more than 25% of the sample was expired.
+func (kv *KVStore) activeExpireCycle() {
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		start := time.Now()
+		for time.Since(start) < activeExpireBudget {
+			sampled, expired := kv.expireSample(activeExpireSamples)
+			if sampled == 0 || expired*4 <= sampled {
+				break
+			}
+		}
+	}
+}
+
+func (kv *KVStore) expireSample(n int) (sampled, expired int) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+
+	now := time.Now()
+	toDelete := []string{}
+
+	// Map iteration starts at a random position, which gives us the sample.
+	kv.expMu.Lock()
+	for key, at := range kv.expires {
+		if sampled >= n {
+			break
+		}
+		sampled++
+		if !now.Before(at) {
+			toDelete = append(toDelete, key)
+		}
+	}
+	kv.expMu.Unlock()
+
+	for _, key := range toDelete {
+		kv.delete(key)
+	}
+	return sampled, len(toDelete)
+}
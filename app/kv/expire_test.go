@@ -0,0 +1,127 @@
+package kv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpireFlags(t *testing.T) {
+	now := time.Now()
+	later, sooner := now.Add(time.Hour), now.Add(time.Minute)
+	tests := []struct {
+		name   string
+		ttl    time.Time // current expiry, zero for none
+		at     time.Time
+		flag   ExpireFlag
+		want   int
+		wantAt time.Time // expiry afterwards, zero for none
+	}{
+		{"always", time.Time{}, later, ExpireAlways, 1, later},
+		{"NX without TTL", time.Time{}, later, ExpireNX, 1, later},
+		{"NX with TTL", sooner, later, ExpireNX, 0, sooner},
+		{"XX without TTL", time.Time{}, later, ExpireXX, 0, time.Time{}},
+		{"XX with TTL", sooner, later, ExpireXX, 1, later},
+		{"GT greater", sooner, later, ExpireGT, 1, later},
+		{"GT smaller", later, sooner, ExpireGT, 0, later},
+		{"GT without TTL", time.Time{}, later, ExpireGT, 0, time.Time{}},
+		{"LT smaller", later, sooner, ExpireLT, 1, sooner},
+		{"LT greater", sooner, later, ExpireLT, 0, sooner},
+		{"LT without TTL", time.Time{}, later, ExpireLT, 1, later},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := NewKVStore()
+			kv.Set("k", "v")
+			if !tt.ttl.IsZero() {
+				kv.Expire("k", tt.ttl, ExpireAlways)
+			}
+			if got := kv.Expire("k", tt.at, tt.flag); got != tt.want {
+				t.Errorf("Expire = %d, want %d", got, tt.want)
+			}
+			want := int64(-1)
+			if !tt.wantAt.IsZero() {
+				want = tt.wantAt.UnixMilli()
+			}
+			if got := kv.ExpireTime("k"); got != want {
+				t.Errorf("ExpireTime = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestExpireAllTypes(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("str", "v")
+	kv.RPush("list", []string{"a"})
+	kv.SAdd("set", []string{"a"})
+	kv.HSet("hash", []string{"f", "v"})
+	kv.ZAdd("zset", "a", 1)
+	keys := []string{"str", "list", "set", "hash", "zset"}
+
+	past := time.Now().Add(-time.Millisecond)
+	for _, key := range keys {
+		kv.SetExpireAt(key, past)
+	}
+	for _, key := range keys {
+		if kv.Exists(key) != 0 || kv.Type(key) != "none" {
+			t.Errorf("%s is still visible after its expiry", key)
+		}
+	}
+	if n := kv.DBSize(); n != 0 {
+		t.Errorf("DBSize = %d after all keys expired", n)
+	}
+}
+
+func TestExpireInThePast(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("k", "v")
+	if got := kv.Expire("k", time.Now().Add(-time.Second), ExpireAlways); got != 1 {
+		t.Errorf("Expire in the past = %d, want 1", got)
+	}
+	if kv.ExpireTime("k") != -2 {
+		t.Error("a key expired in the past was not deleted")
+	}
+	if got := kv.Expire("missing", time.Now().Add(time.Hour), ExpireAlways); got != 0 {
+		t.Errorf("Expire of a missing key = %d, want 0", got)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("k", "v")
+	if kv.Persist("k") != 0 {
+		t.Error("Persist of a key without TTL should return 0")
+	}
+	kv.Expire("k", time.Now().Add(time.Hour), ExpireAlways)
+	if kv.Persist("k") != 1 || kv.ExpireTime("k") != -1 {
+		t.Error("Persist did not remove the TTL")
+	}
+	// overwriting a value with SET drops its TTL
+	kv.Expire("k", time.Now().Add(time.Hour), ExpireAlways)
+	kv.Set("k", "v2")
+	if kv.ExpireTime("k") != -1 {
+		t.Error("SET kept the previous TTL")
+	}
+}
+
+func TestExpireSample(t *testing.T) {
+	kv := NewKVStore()
+	for _, key := range []string{"a", "b", "c"} {
+		kv.Set(key, "v")
+		kv.SetExpireAt(key, time.Now().Add(-time.Second))
+	}
+	kv.Set("d", "v")
+	kv.SetExpireAt("d", time.Now().Add(time.Hour))
+
+	sampled, expired := kv.expireSample(10)
+	if sampled != 4 || expired != 3 {
+		t.Errorf("expireSample = %d sampled, %d expired, want 4, 3", sampled, expired)
+	}
+	// deleted for real, not only hidden
+	if _, ok := kv.mp.Load("a"); ok {
+		t.Error("expired key still stored after the sample")
+	}
+	if keys, expires, _ := kv.KeyspaceInfo(); keys != 1 || expires != 1 {
+		t.Errorf("KeyspaceInfo = %d keys, %d expires, want 1, 1", keys, expires)
+	}
+}
@@ -8,10 +8,13 @@ import (
 
 func (kv *KVStore) GEOADD(key string, member string, longitude, latitude float64) (int, error) {
 	score, err := geospatial.GeohashEncode(longitude, latitude)
+	if err != nil {
+		return 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude)
+	}
+	isNew, err := kv.ZAdd(key, member, float64(score))
 	if err != nil {
 		return 0, err
 	}
-	isNew := kv.ZAdd(key, member, float64(score))
 	if isNew {
 		return 1, nil
 	} else {
@@ -19,19 +22,27 @@ func (kv *KVStore) GEOADD(key string, member string, longitude, latitude float64
 	}
 }
 
-func (kv *KVStore) GEOPOS(key string, member string) (float64, float64, error) {
-	score := kv.ZScore(key, member)
+// GEOPOS returns the position of member, ok is false if it doesn't exist.
+func (kv *KVStore) GEOPOS(key string, member string) (float64, float64, bool, error) {
+	score, err := kv.ZScore(key, member)
 	if score == nil {
-		return -1, -1, fmt.Errorf("Not exist")
+		return -1, -1, false, err
 	}
 	hash := score.(float64)
 	longitude, latitude := geospatial.GeohashDecode(hash)
-	return longitude, latitude, nil
+	return longitude, latitude, true, nil
 }
 
-func (kv *KVStore) GEODIST(key string, m1, m2 string) float64 {
-	s1 := kv.ZScore(key, m1)
-	s2 := kv.ZScore(key, m2)
+// GEODIST returns the distance in meters, or nil if a member is missing.
+func (kv *KVStore) GEODIST(key string, m1, m2 string) (any, error) {
+	s1, err := kv.ZScore(key, m1)
+	if err != nil {
+		return nil, err
+	}
+	s2, _ := kv.ZScore(key, m2)
+	if s1 == nil || s2 == nil {
+		return nil, nil
+	}
 
 	h1, h2 := s1.(float64), s2.(float64)
 
@@ -41,25 +52,24 @@ func (kv *KVStore) GEODIST(key string, m1, m2 string) float64 {
 	p1 := geospatial.NewPoint(lon1, lat1)
 	p2 := geospatial.NewPoint(lon2, lat2)
 
-	return geospatial.Distance(p1, p2)
+	return geospatial.Distance(p1, p2), nil
 }
 
 // Search for locations within given radius (meters)
-func (kv *KVStore) GEOSEARCH_FROMLONLAT_BYRADIUS(key string, lon, lat float64, radius float64) (res []string) {
-	storeValAny, ok := kv.mp.Load(key)
-	var zSet ZSetValue
+func (kv *KVStore) GEOSEARCH_FROMLONLAT_BYRADIUS(key string, lon, lat float64, radius float64) (res []string, err error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
 	if !ok {
 		return
-	} else {
-		zSet = storeValAny.(StoreValue).v.(ZSetValue)
 	}
 
 	tarPoint := geospatial.NewPoint(lon, lat)
-	for _, elem := range zSet.scores {
-		curLon, curLat := geospatial.GeohashDecode(elem.score)
+	for x := zSet.zsl.first(); x != nil; x = x.next() {
+		curLon, curLat := geospatial.GeohashDecode(x.score)
 		p := geospatial.NewPoint(curLon, curLat)
 		if geospatial.Distance(p, tarPoint) <= radius {
-			res = append(res, elem.member)
+			res = append(res, x.member)
 		}
 	}
 
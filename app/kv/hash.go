@@ -0,0 +1,303 @@
+package kv
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// HashValue maps the fields of a hash to their values.
+type HashValue struct {
+	fields *dict[string]
+}
+
+func newHashValue() HashValue {
+	return HashValue{fields: newDict[string]()}
+}
+
+// NewHashValueFrom builds a hash from a flat field/value list.
+func NewHashValueFrom(pairs []string) HashValue {
+	hash := newHashValue()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		hash.fields.set(pairs[i], pairs[i+1])
+	}
+	return hash
+}
+
+// Hashes within these limits are reported with the listpack encoding
+// (hash-max-listpack-entries and hash-max-listpack-value).
+const (
+	hashMaxListpackEntries = 128
+	hashMaxListpackValue   = 64
+)
+
+func (hash HashValue) Encoding() string {
+	if hash.fields.len() > hashMaxListpackEntries {
+		return "hashtable"
+	}
+	for field, value := range hash.fields.all() {
+		if len(field) > hashMaxListpackValue || len(value) > hashMaxListpackValue {
+			return "hashtable"
+		}
+	}
+	return "listpack"
+}
+
+var (
+	ErrHashNotInteger = errors.New("ERR hash value is not an integer")
+	ErrHashNotFloat   = errors.New("ERR hash value is not a float")
+)
+
+func (kv *KVStore) getHash(key string) (HashValue, bool, error) {
+	val, ok, err := kv.lookup(key, HashType)
+	if !ok {
+		return HashValue{}, false, err
+	}
+	return val.v.(HashValue), true, nil
+}
+
+// getOrCreateHash returns the hash at key, or a new empty hash which the
+// caller stores once it has been filled.
+func (kv *KVStore) getOrCreateHash(key string) (HashValue, error) {
+	hash, ok, err := kv.getHash(key)
+	if err != nil {
+		return HashValue{}, err
+	}
+	if !ok {
+		hash = newHashValue()
+	}
+	return hash, nil
+}
+
+// HSet sets field/value pairs (a flat list) and returns the number of
+// fields that were added.
+func (kv *KVStore) HSet(key string, pairs []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	hash, err := kv.getOrCreateHash(key)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if hash.fields.set(pairs[i], pairs[i+1]) {
+			added++
+		}
+	}
+	kv.store(key, hash, HashType)
+	return added, nil
+}
+
+// HSetNX sets field only if it does not exist yet. Returns 1 if it was set.
+func (kv *KVStore) HSetNX(key, field, value string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	hash, err := kv.getOrCreateHash(key)
+	if err != nil {
+		return 0, err
+	}
+	if hash.fields.has(field) {
+		return 0, nil
+	}
+	hash.fields.set(field, value)
+	kv.store(key, hash, HashType)
+	return 1, nil
+}
+
+// HGet returns the value of field, or nil when it does not exist.
+func (kv *KVStore) HGet(key, field string) (any, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := hash.fields.get(field); ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+// HMGet returns the values of the fields, nil for missing ones.
+func (kv *KVStore) HMGet(key string, fields []string) ([]any, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, len(fields))
+	for i, field := range fields {
+		if v, ok := hash.fields.get(field); ok {
+			res[i] = v
+		}
+	}
+	return res, nil
+}
+
+// HGetAll returns all fields and values as a flat list.
+func (kv *KVStore) HGetAll(key string) ([]string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, hash.fields.len()*2)
+	for k, v := range hash.fields.all() {
+		res = append(res, k, v)
+	}
+	return res, nil
+}
+
+// HKeys returns all fields, or all values when values is set.
+func (kv *KVStore) HKeys(key string, values bool) ([]string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, hash.fields.len())
+	for k, v := range hash.fields.all() {
+		if values {
+			res = append(res, v)
+		} else {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+// HDel removes fields and returns how many were removed. The key is
+// deleted once the hash is empty.
+func (kv *KVStore) HDel(key string, fields []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	hash, ok, err := kv.getHash(key)
+	if !ok {
+		return 0, err
+	}
+	cnt := 0
+	for _, field := range fields {
+		if hash.fields.delete(field) {
+			cnt++
+		}
+	}
+	if hash.fields.len() == 0 {
+		kv.delete(key)
+	}
+	return cnt, nil
+}
+
+func (kv *KVStore) HExists(key, field string) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	if err != nil {
+		return 0, err
+	}
+	if hash.fields.has(field) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (kv *KVStore) HLen(key string) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	return hash.fields.len(), err
+}
+
+// HStrLen returns the length of the value of field, 0 if it is missing.
+func (kv *KVStore) HStrLen(key, field string) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	v, _ := hash.fields.get(field)
+	return len(v), err
+}
+
+func (kv *KVStore) HIncrBy(key, field string, incr int64) (int64, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	hash, err := kv.getOrCreateHash(key)
+	if err != nil {
+		return 0, err
+	}
+	var cur int64
+	if v, ok := hash.fields.get(field); ok {
+		cur, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, ErrHashNotInteger
+		}
+	}
+	if (incr > 0 && cur > math.MaxInt64-incr) || (incr < 0 && cur < math.MinInt64-incr) {
+		return 0, ErrOverflow
+	}
+	cur += incr
+	hash.fields.set(field, strconv.FormatInt(cur, 10))
+	kv.store(key, hash, HashType)
+	return cur, nil
+}
+
+func (kv *KVStore) HIncrByFloat(key, field string, incr float64) (string, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	hash, err := kv.getOrCreateHash(key)
+	if err != nil {
+		return "", err
+	}
+	var cur float64
+	if v, ok := hash.fields.get(field); ok {
+		cur, err = strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(cur) || math.IsInf(cur, 0) {
+			return "", ErrHashNotFloat
+		}
+	}
+	cur += incr
+	if math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return "", ErrNaN
+	}
+	res := strconv.FormatFloat(cur, 'f', -1, 64)
+	hash.fields.set(field, res)
+	kv.store(key, hash, HashType)
+	return res, nil
+}
+
+// HRandField returns random fields with their values as a flat list.
+// A positive count returns distinct fields, a negative count may return
+// the same field several times.
+func (kv *KVStore) HRandField(key string, count int) ([]string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	if err != nil || hash.fields.len() == 0 {
+		return []string{}, err
+	}
+
+	res := []string{}
+	for _, e := range hash.fields.sample(count) {
+		res = append(res, e.key, e.val)
+	}
+	return res, nil
+}
+
+// HScan returns the fields and values, as a flat list, found by one step
+// of a cursor based iteration over the hash.
+func (kv *KVStore) HScan(key string, cursor uint64, count int, pattern string) (uint64, []string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	hash, _, err := kv.getHash(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	res := []string{}
+	cursor = scanDict(hash.fields, cursor, count, func(field, value string) {
+		if pattern == "" || MatchPattern(pattern, field, false) {
+			res = append(res, field, value)
+		}
+	})
+	return cursor, res, nil
+}
@@ -0,0 +1,144 @@
+package kv
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	kv := NewKVStore()
+	if n, _ := kv.HSet("h", []string{"a", "1", "b", "2", "a", "3"}); n != 2 {
+		t.Errorf("HSet added %d fields, want 2", n)
+	}
+	if v, _ := kv.HGet("h", "a"); v != "3" {
+		t.Errorf("HGet(a) = %v, want the last value 3", v)
+	}
+	if v, _ := kv.HGet("h", "missing"); v != nil {
+		t.Errorf("HGet of a missing field = %v, want nil", v)
+	}
+	if n, _ := kv.HSetNX("h", "a", "x"); n != 0 {
+		t.Error("HSetNX overwrote a field")
+	}
+	if got, _ := kv.HMGet("h", []string{"b", "c"}); !slices.Equal(got, []any{"2", nil}) {
+		t.Errorf("HMGet = %v", got)
+	}
+	if n, _ := kv.HStrLen("h", "b"); n != 1 {
+		t.Errorf("HStrLen = %d, want 1", n)
+	}
+	pairs, _ := kv.HGetAll("h")
+	if len(pairs) != 4 {
+		t.Errorf("HGetAll = %v", pairs)
+	}
+	if n, _ := kv.HDel("h", []string{"a", "b", "c"}); n != 2 {
+		t.Errorf("HDel removed %d fields, want 2", n)
+	}
+	if kv.Exists("h") != 0 {
+		t.Error("an empty hash was kept")
+	}
+
+	kv.Set("str", "v")
+	if _, err := kv.HSet("str", []string{"a", "1"}); err != ErrWrongType {
+		t.Errorf("HSet on a string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestHIncrBy(t *testing.T) {
+	kv := NewKVStore()
+	kv.HSet("h", []string{"n", "10", "s", "abc", "max", "9223372036854775807", "f", "1.5", "big", "1.7976931348623157e308"})
+	tests := []struct {
+		field   string
+		incr    int64
+		want    int64
+		wantErr error
+	}{
+		{"n", 5, 15, nil},
+		{"new", -3, -3, nil},
+		{"s", 1, 0, ErrHashNotInteger},
+		{"f", 1, 0, ErrHashNotInteger},
+		{"max", 1, 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := kv.HIncrBy("h", tt.field, tt.incr)
+		if got != tt.want || err != tt.wantErr {
+			t.Errorf("HIncrBy(%s, %d) = %d, %v, want %d, %v", tt.field, tt.incr, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	floats := []struct {
+		field   string
+		incr    float64
+		want    string
+		wantErr error
+	}{
+		{"f", 0.25, "1.75", nil},
+		{"n", 0.5, "15.5", nil},
+		{"s", 1, "", ErrHashNotFloat},
+		{"big", 1.7976931348623157e308, "", ErrNaN},
+	}
+	for _, tt := range floats {
+		got, err := kv.HIncrByFloat("h", tt.field, tt.incr)
+		if got != tt.want || err != tt.wantErr {
+			t.Errorf("HIncrByFloat(%s, %v) = %q, %v, want %q, %v", tt.field, tt.incr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHRandField(t *testing.T) {
+	kv := NewKVStore()
+	pairs := []string{}
+	for i := range 100 {
+		pairs = append(pairs, "f"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	kv.HSet("h", pairs)
+
+	got, _ := kv.HRandField("h", 10)
+	fields := map[string]bool{}
+	for i := 0; i < len(got); i += 2 {
+		if got[i] != "f"+got[i+1] {
+			t.Errorf("HRandField paired %s with %s", got[i], got[i+1])
+		}
+		fields[got[i]] = true
+	}
+	if len(got) != 20 || len(fields) != 10 {
+		t.Errorf("HRandField(10) = %d items, %d distinct fields", len(got), len(fields))
+	}
+	if got, _ := kv.HRandField("h", 500); len(got) != 200 {
+		t.Errorf("HRandField(500) returned %d items, want the 100 pairs", len(got))
+	}
+	if got, _ := kv.HRandField("h", -500); len(got) != 1000 {
+		t.Errorf("HRandField(-500) returned %d items, want 500 pairs", len(got))
+	}
+	if got, _ := kv.HRandField("missing", 5); len(got) != 0 {
+		t.Errorf("HRandField of a missing key = %v", got)
+	}
+}
+
+func TestHScan(t *testing.T) {
+	kv := NewKVStore()
+	pairs := []string{}
+	for i := range 1000 {
+		pairs = append(pairs, "f"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	kv.HSet("h", pairs)
+
+	seen := map[string]string{}
+	cursor, calls := uint64(0), 0
+	for {
+		var res []string
+		cursor, res, _ = kv.HScan("h", cursor, 50, "")
+		for i := 0; i < len(res); i += 2 {
+			seen[res[i]] = res[i+1]
+		}
+		calls++
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 1000 || seen["f7"] != "7" || calls < 10 {
+		t.Errorf("HSCAN returned %d fields in %d calls, f7 = %q", len(seen), calls, seen["f7"])
+	}
+	if _, res, _ := kv.HScan("h", 0, 10000, "f99?"); len(res) != 2*10 {
+		t.Errorf("HSCAN MATCH f99? returned %d items, want 20", len(res))
+	}
+}
@@ -0,0 +1,428 @@
+package kv
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// HyperLogLogs are stored as strings using the Redis layout, so they can
+// be read with GET, written back with SET and exchanged through RDB files:
+//
+//	+------+---+-----+----------+
+//	| HYLL | E | N/U | Cardin.  |
+//	+------+---+-----+----------+
+//
+// a 4 byte magic, 1 byte encoding (dense or sparse), 3 unused bytes and
+// the cached cardinality as a little endian uint64, whose most
+// significant bit is set when the cache is stale. The registers follow.
+//
+// The dense encoding packs 16384 6-bit registers, least significant bits
+// first. The sparse encoding run-length encodes them with three opcodes:
+//
+//	00xxxxxx          ZERO:  xxxxxx+1 zero registers (1-64)
+//	01xxxxxx yyyyyyyy XZERO: 14 bit length+1 zero registers (1-16384)
+//	1vvvvvxx          VAL:   xx+1 registers set to vvvvv+1 (1-32)
+const (
+	hllP           = 14
+	hllQ           = 64 - hllP
+	hllRegisters   = 1 << hllP
+	hllPMask       = hllRegisters - 1
+	hllBits        = 6
+	hllRegisterMax = 1<<hllBits - 1
+	hllHdrSize     = 16
+	hllDenseSize   = hllHdrSize + (hllRegisters*hllBits+7)/8
+	hllDense       = 0
+	hllSparse      = 1
+
+	hllSparseMaxBytes   = 3000 // sparse HLLs bigger than this become dense
+	hllSparseValMax     = 32
+	hllSparseValMaxLen  = 4
+	hllSparseZeroMaxLen = 64
+	hllSparseXZeroMax   = 16384
+
+	hllAlphaInf = 0.721347520444481703680
+)
+
+var (
+	ErrNotHLL     = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrCorruptHLL = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// hll is a HyperLogLog with its registers unpacked.
+type hll struct {
+	sparse    bool
+	card      [8]byte // cached cardinality
+	registers [hllRegisters]uint8
+}
+
+func newHLL() *hll {
+	return &hll{sparse: true}
+}
+
+// parseHLL decodes a HyperLogLog string.
+func parseHLL(str string) (*hll, error) {
+	if len(str) < hllHdrSize || str[:4] != "HYLL" {
+		return nil, ErrNotHLL
+	}
+	h := &hll{}
+	copy(h.card[:], str[8:16])
+	body := str[hllHdrSize:]
+	switch str[4] {
+	case hllDense:
+		if len(str) != hllDenseSize {
+			return nil, ErrNotHLL
+		}
+		for i := range hllRegisters {
+			h.registers[i] = denseRegister(body, i)
+		}
+	case hllSparse:
+		h.sparse = true
+		idx := 0
+		for p := 0; p < len(body); p++ {
+			b := body[p]
+			var val uint8
+			var runLen int
+			switch {
+			case b&0xc0 == 0x00: // ZERO
+				runLen = int(b&0x3f) + 1
+			case b&0xc0 == 0x40: // XZERO
+				if p+1 >= len(body) {
+					return nil, ErrCorruptHLL
+				}
+				runLen = (int(b&0x3f)<<8 | int(body[p+1])) + 1
+				p++
+			default: // VAL
+				val = (b>>2)&0x1f + 1
+				runLen = int(b&0x3) + 1
+			}
+			if idx+runLen > hllRegisters {
+				return nil, ErrCorruptHLL
+			}
+			for range runLen {
+				h.registers[idx] = val
+				idx++
+			}
+		}
+		if idx != hllRegisters {
+			return nil, ErrCorruptHLL
+		}
+	default:
+		return nil, ErrNotHLL
+	}
+	return h, nil
+}
+
+func denseRegister(body string, i int) uint8 {
+	byteIdx := i * hllBits / 8
+	fb := uint(i * hllBits & 7)
+	v := uint(body[byteIdx]) >> fb
+	if byteIdx+1 < len(body) {
+		v |= uint(body[byteIdx+1]) << (8 - fb)
+	}
+	return uint8(v & hllRegisterMax)
+}
+
+func setDenseRegister(body []byte, i int, val uint8) {
+	byteIdx := i * hllBits / 8
+	fb := uint(i * hllBits & 7)
+	body[byteIdx] &^= byte(hllRegisterMax << fb)
+	body[byteIdx] |= byte(uint(val) << fb)
+	if byteIdx+1 < len(body) {
+		body[byteIdx+1] &^= byte(hllRegisterMax >> (8 - fb))
+		body[byteIdx+1] |= byte(uint(val) >> (8 - fb))
+	}
+}
+
+// encode returns the string form of the HyperLogLog. A sparse HLL is
+// promoted to dense when a register doesn't fit the VAL opcode or the
+// encoding grows past hllSparseMaxBytes.
+func (h *hll) encode() string {
+	if h.sparse {
+		if buf, ok := h.encodeSparse(); ok {
+			return string(buf)
+		}
+		h.sparse = false
+	}
+	buf := make([]byte, hllDenseSize)
+	h.writeHeader(buf, hllDense)
+	for i, val := range h.registers {
+		setDenseRegister(buf[hllHdrSize:], i, val)
+	}
+	return string(buf)
+}
+
+func (h *hll) writeHeader(buf []byte, encoding byte) {
+	copy(buf, "HYLL")
+	buf[4] = encoding
+	copy(buf[8:16], h.card[:])
+}
+
+func (h *hll) encodeSparse() ([]byte, bool) {
+	buf := make([]byte, hllHdrSize, hllHdrSize+64)
+	h.writeHeader(buf, hllSparse)
+	for i := 0; i < hllRegisters; {
+		val := h.registers[i]
+		runLen := 1
+		for i+runLen < hllRegisters && h.registers[i+runLen] == val {
+			runLen++
+		}
+		i += runLen
+
+		if val > hllSparseValMax {
+			return nil, false
+		}
+		for runLen > 0 {
+			switch {
+			case val != 0:
+				n := min(runLen, hllSparseValMaxLen)
+				buf = append(buf, 0x80|(val-1)<<2|byte(n-1))
+				runLen -= n
+			case runLen > hllSparseZeroMaxLen:
+				n := min(runLen, hllSparseXZeroMax)
+				buf = append(buf, 0x40|byte((n-1)>>8), byte(n-1))
+				runLen -= n
+			default:
+				buf = append(buf, byte(runLen-1))
+				runLen = 0
+			}
+		}
+		if len(buf) > hllSparseMaxBytes {
+			return nil, false
+		}
+	}
+	return buf, true
+}
+
+func (h *hll) cacheValid() bool {
+	return h.card[7]&0x80 == 0
+}
+
+func (h *hll) invalidateCache() {
+	h.card[7] |= 0x80
+}
+
+func (h *hll) setCache(card uint64) {
+	binary.LittleEndian.PutUint64(h.card[:], card)
+}
+
+// hllPatLen returns the register index of ele and the length of the
+// run of zeros, plus one, in the rest of its hash.
+func hllPatLen(ele string) (int, uint8) {
+	hash := murmurHash64A([]byte(ele), 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= hllP
+	hash |= 1 << hllQ // make sure the loop terminates
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// add observes ele and reports whether a register was updated.
+func (h *hll) add(ele string) bool {
+	index, count := hllPatLen(ele)
+	if count <= h.registers[index] {
+		return false
+	}
+	h.registers[index] = count
+	return true
+}
+
+// merge keeps the max of each register of h and o.
+func (h *hll) merge(o *hll) {
+	for i, val := range o.registers {
+		h.registers[i] = max(h.registers[i], val)
+	}
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// count estimates the cardinality with the improved estimator by Otmar
+// Ertl used by Redis.
+func (h *hll) count() uint64 {
+	m := float64(hllRegisters)
+	var histo [64]int
+	for _, val := range h.registers {
+		histo[val]++
+	}
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+// murmurHash64A is the 64 bit MurmurHash2 by Austin Appleby, as used by
+// Redis to hash HyperLogLog elements.
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const (
+		m = 0xc6a4a7935bd1e995
+		r = 47
+	)
+	h := seed ^ uint64(len(data))*m
+	n := len(data) - len(data)&7
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	if rest := data[n:]; len(rest) > 0 {
+		for i := len(rest) - 1; i >= 0; i-- {
+			h ^= uint64(rest[i]) << (8 * i)
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// getHLL returns the HyperLogLog at key. Strings that are not valid
+// HyperLogLogs give ErrNotHLL.
+func (kv *KVStore) getHLL(key string) (*hll, bool, error) {
+	str, ok, err := kv.getString(key)
+	if !ok {
+		return nil, false, err
+	}
+	h, err := parseHLL(str.String())
+	if err != nil {
+		return nil, false, err
+	}
+	return h, true, nil
+}
+
+// storeHLL writes h back to key, keeping the TTL of an existing key.
+func (kv *KVStore) storeHLL(key string, h *hll, exists bool) {
+	if exists {
+		kv.store(key, StringValue{value: h.encode()}, StringType)
+	} else {
+		kv.set(key, h.encode())
+	}
+}
+
+// PFAdd adds elements to the HyperLogLog at key, creating it if needed.
+// Returns 1 if the estimated cardinality may have changed.
+func (kv *KVStore) PFAdd(key string, elements []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	h, ok, err := kv.getHLL(key)
+	if err != nil {
+		return 0, err
+	}
+	updated := !ok
+	if !ok {
+		h = newHLL()
+	}
+	for _, ele := range elements {
+		if h.add(ele) {
+			updated = true
+		}
+	}
+	if !updated {
+		return 0, nil
+	}
+	h.invalidateCache()
+	kv.storeHLL(key, h, ok)
+	return 1, nil
+}
+
+// PFCount returns the estimated cardinality of the union of the
+// HyperLogLogs at keys. With a single key the cached value is used and
+// refreshed.
+func (kv *KVStore) PFCount(keys []string) (uint64, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	if len(keys) == 1 {
+		h, ok, err := kv.getHLL(keys[0])
+		if !ok {
+			return 0, err
+		}
+		if h.cacheValid() {
+			return binary.LittleEndian.Uint64(h.card[:]), nil
+		}
+		card := h.count()
+		h.setCache(card)
+		kv.storeHLL(keys[0], h, true)
+		return card, nil
+	}
+
+	union := newHLL()
+	for _, key := range keys {
+		h, ok, err := kv.getHLL(key)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			union.merge(h)
+		}
+	}
+	return union.count(), nil
+}
+
+// PFMerge stores the union of dst and the HyperLogLogs at keys in dst.
+// The result is dense if any of the inputs is.
+func (kv *KVStore) PFMerge(dst string, keys []string) error {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	res, dstOk, err := kv.getHLL(dst)
+	if err != nil {
+		return err
+	}
+	if !dstOk {
+		res = newHLL()
+	}
+	for _, key := range keys {
+		h, ok, err := kv.getHLL(key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if !h.sparse {
+			res.sparse = false
+		}
+		res.merge(h)
+	}
+	res.invalidateCache()
+	kv.storeHLL(dst, res, dstOk)
+	return nil
+}
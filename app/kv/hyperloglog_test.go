@@ -0,0 +1,204 @@
+package kv
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func hllString(t *testing.T, kv *KVStore, key string) string {
+	t.Helper()
+	v, err := kv.Get(key)
+	if err != nil || v == nil {
+		t.Fatalf("Get(%q) = %v, %v", key, v, err)
+	}
+	return v.(string)
+}
+
+func addRange(t *testing.T, kv *KVStore, key string, from, to int) {
+	t.Helper()
+	elements := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		elements = append(elements, fmt.Sprintf("ele:%d", i))
+	}
+	if _, err := kv.PFAdd(key, elements); err != nil {
+		t.Fatalf("PFAdd: %v", err)
+	}
+}
+
+func TestPFAddEmpty(t *testing.T) {
+	kv := NewKVStore()
+	if n, err := kv.PFAdd("h", nil); n != 1 || err != nil {
+		t.Fatalf("PFAdd of a new key = %d, %v, want 1", n, err)
+	}
+	// the exact bytes Redis writes: a sparse header with a stale cache and
+	// a single XZERO
+	want := "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f\xff"
+	if got := hllString(t, kv, "h"); got != want {
+		t.Errorf("empty HLL = %q, want %q", got, want)
+	}
+	if n, _ := kv.PFAdd("h", nil); n != 0 {
+		t.Errorf("PFAdd of an existing key without elements = %d, want 0", n)
+	}
+	if n, _ := kv.PFCount([]string{"missing"}); n != 0 {
+		t.Errorf("PFCount of a missing key = %d, want 0", n)
+	}
+}
+
+func TestPFAddUpdates(t *testing.T) {
+	kv := NewKVStore()
+	if n, _ := kv.PFAdd("h", []string{"a", "b", "c"}); n != 1 {
+		t.Errorf("PFAdd of new elements = %d, want 1", n)
+	}
+	if n, _ := kv.PFAdd("h", []string{"a", "b", "c"}); n != 0 {
+		t.Errorf("PFAdd of the same elements = %d, want 0", n)
+	}
+	if n, _ := kv.PFCount([]string{"h"}); n != 3 {
+		t.Errorf("PFCount = %d, want 3", n)
+	}
+}
+
+func TestPFCountAccuracy(t *testing.T) {
+	for _, n := range []int{100, 1000, 10000, 100000} {
+		kv := NewKVStore()
+		addRange(t, kv, "h", 0, n)
+		got, _ := kv.PFCount([]string{"h"})
+		if errRate := math.Abs(float64(got)-float64(n)) / float64(n); errRate > 0.02 {
+			t.Errorf("PFCount after %d elements = %d, error %.2f%%", n, got, 100*errRate)
+		}
+	}
+}
+
+func TestPFCountCache(t *testing.T) {
+	kv := NewKVStore()
+	addRange(t, kv, "h", 0, 500)
+	if str := hllString(t, kv, "h"); str[15]&0x80 == 0 {
+		t.Fatalf("cache valid after PFAdd")
+	}
+	n, _ := kv.PFCount([]string{"h"})
+	str := hllString(t, kv, "h")
+	h, err := parseHLL(str)
+	if err != nil || !h.cacheValid() || h.count() != n {
+		t.Fatalf("PFCount did not store its result in the cache")
+	}
+
+	// a cached value is trusted as is, like Redis does
+	b := []byte(str)
+	b[8] ^= 1
+	kv.Set("h", string(b))
+	if got, _ := kv.PFCount([]string{"h"}); got != n^1 {
+		t.Errorf("PFCount with a cached value = %d, want %d", got, n^1)
+	}
+}
+
+func TestHLLEncoding(t *testing.T) {
+	kv := NewKVStore()
+	addRange(t, kv, "h", 0, 100)
+	sparse := hllString(t, kv, "h")
+	if sparse[4] != hllSparse || len(sparse) >= hllDenseSize {
+		t.Fatalf("small HLL has encoding %d and %d bytes, want sparse", sparse[4], len(sparse))
+	}
+
+	addRange(t, kv, "h", 100, 20000)
+	dense := hllString(t, kv, "h")
+	if dense[4] != hllDense || len(dense) != hllDenseSize {
+		t.Fatalf("big HLL has encoding %d and %d bytes, want dense", dense[4], len(dense))
+	}
+
+	// both forms decode back to the same registers
+	for _, str := range []string{sparse, dense} {
+		h, err := parseHLL(str)
+		if err != nil {
+			t.Fatalf("parseHLL: %v", err)
+		}
+		if got := h.encode(); got != str {
+			t.Errorf("encode(parseHLL(s)) differs from s, encoding %d", str[4])
+		}
+	}
+}
+
+// A register too big for the VAL opcode promotes the HLL to dense, even
+// when the sparse form would be small.
+func TestHLLSparseValMax(t *testing.T) {
+	h := newHLL()
+	h.registers[0] = hllSparseValMax + 1
+	if str := h.encode(); str[4] != hllDense || h.sparse {
+		t.Errorf("HLL with a register of %d encoded as %d", hllSparseValMax+1, str[4])
+	}
+	h = newHLL()
+	h.registers[0] = hllSparseValMax
+	if str := h.encode(); str[4] != hllSparse {
+		t.Errorf("HLL with a register of %d encoded as %d", hllSparseValMax, str[4])
+	}
+}
+
+func TestPFMerge(t *testing.T) {
+	kv := NewKVStore()
+	addRange(t, kv, "a", 0, 6000)
+	addRange(t, kv, "b", 4000, 10000)
+	if err := kv.PFMerge("dst", []string{"a", "b", "missing"}); err != nil {
+		t.Fatalf("PFMerge: %v", err)
+	}
+	merged, _ := kv.PFCount([]string{"dst"})
+	union, _ := kv.PFCount([]string{"a", "b"})
+	if merged != union {
+		t.Errorf("PFCount of the merge = %d, PFCount of both keys = %d", merged, union)
+	}
+	if math.Abs(float64(merged)-10000) > 200 {
+		t.Errorf("PFCount of the merge = %d, want about 10000", merged)
+	}
+
+	// a dense input makes the result dense
+	addRange(t, kv, "big", 0, 20000)
+	kv.PFAdd("small", []string{"x"})
+	kv.PFMerge("small", []string{"big"})
+	if str := hllString(t, kv, "small"); str[4] != hllDense {
+		t.Errorf("merge with a dense HLL has encoding %d", str[4])
+	}
+
+	// merging nothing still creates the key
+	if err := kv.PFMerge("new", nil); err != nil {
+		t.Fatalf("PFMerge: %v", err)
+	}
+	if n, err := kv.PFCount([]string{"new"}); n != 0 || err != nil {
+		t.Errorf("PFCount of an empty merge = %d, %v", n, err)
+	}
+}
+
+func TestHLLInvalid(t *testing.T) {
+	valid := "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff"
+	tests := []struct {
+		name string
+		str  string
+		want error
+	}{
+		{"plain string", "hello", ErrNotHLL},
+		{"bad magic", "HYLX" + valid[4:], ErrNotHLL},
+		{"unknown encoding", valid[:4] + "\x02" + valid[5:], ErrNotHLL},
+		{"short dense", valid[:4] + "\x00" + valid[5:], ErrNotHLL},
+		{"truncated XZERO", valid[:len(valid)-1], ErrCorruptHLL},
+		{"too few registers", valid[:16] + "\x7f\xfe", ErrCorruptHLL},
+		{"too many registers", valid + "\x00", ErrCorruptHLL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := NewKVStore()
+			kv.Set("h", tt.str)
+			if _, err := kv.PFAdd("h", []string{"a"}); err != tt.want {
+				t.Errorf("PFAdd error = %v, want %v", err, tt.want)
+			}
+			if _, err := kv.PFCount([]string{"h", "other"}); err != tt.want {
+				t.Errorf("PFCount error = %v, want %v", err, tt.want)
+			}
+			if err := kv.PFMerge("dst", []string{"h"}); err != tt.want {
+				t.Errorf("PFMerge error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	kv := NewKVStore()
+	kv.RPush("l", []string{"a"})
+	if _, err := kv.PFAdd("l", []string{"a"}); err != ErrWrongType {
+		t.Errorf("PFAdd on a list error = %v, want %v", err, ErrWrongType)
+	}
+}
@@ -0,0 +1,298 @@
+package kv
+
+import (
+	"slices"
+	"time"
+)
+
+// Del removes the given keys. Returns the number of keys removed.
+func (kv *KVStore) Del(keys ...string) int {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	cnt := 0
+	for _, key := range keys {
+		if _, ok := kv.load(key); ok {
+			kv.delete(key)
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// Unlink removes keys like Del, but the removed values are torn down in a
+// background goroutine so large collections don't stall other clients.
+func (kv *KVStore) Unlink(keys ...string) int {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	removed := []StoreValue{}
+	for _, key := range keys {
+		if val, ok := kv.load(key); ok {
+			kv.delete(key)
+			removed = append(removed, val)
+		}
+	}
+	go freeValues(removed)
+	return len(removed)
+}
+
+// freeValues releases the internal containers of values that are no longer
+// reachable from the keyspace. Slices may still be referenced by replies
+// being written, so only maps are cleared.
+func freeValues(vals []StoreValue) {
+	for _, val := range vals {
+		switch v := val.v.(type) {
+		case ZSetValue:
+			v.memToScore.clear()
+		case HashValue:
+			v.fields.clear()
+		case SetValue:
+			v.dict.clear()
+		}
+	}
+}
+
+// Exists returns how many of the given keys exist. A key mentioned several
+// times is counted several times.
+func (kv *KVStore) Exists(keys ...string) int {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	cnt := 0
+	for _, key := range keys {
+		if _, ok := kv.load(key); ok {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// Rename moves the value and TTL of src to dst. With nx, nothing happens
+// when dst already exists and 0 is returned.
+func (kv *KVStore) Rename(src, dst string, nx bool) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+
+	val, ok := kv.load(src)
+	if !ok {
+		return 0, ErrNoSuchKey
+	}
+	if _, exists := kv.load(dst); exists && nx {
+		return 0, nil
+	}
+	if src == dst {
+		if nx {
+			return 0, nil
+		}
+		return 1, nil
+	}
+
+	at, hasTTL := kv.getExpire(src)
+	kv.delete(src)
+	kv.delete(dst)
+	kv.storeValue(dst, val)
+	if hasTTL {
+		kv.setExpire(dst, at)
+	}
+	kv.signalKey(dst, val.t)
+	return 1, nil
+}
+
+// Copy duplicates the value of src into dst of the dstDB database (which
+// may be kv itself), including its TTL. Returns 1 if the key was copied,
+// 0 if src is missing or dst exists and replace is not set, and
+// ErrSameObject when src and dst are the same key.
+func (kv *KVStore) Copy(src string, dstDB *KVStore, dst string, replace bool) (int, error) {
+	if kv == dstDB && src == dst {
+		return 0, ErrSameObject
+	}
+	unlock := lockPair(kv, dstDB)
+	defer unlock()
+
+	val, ok := kv.load(src)
+	if !ok {
+		return 0, nil
+	}
+	if _, exists := dstDB.load(dst); exists && !replace {
+		return 0, nil
+	}
+
+	at, hasTTL := kv.getExpire(src)
+	dstDB.delete(dst)
+	dstDB.storeValue(dst, copyValue(val))
+	if hasTTL {
+		dstDB.setExpire(dst, at)
+	}
+	dstDB.signalKey(dst, val.t)
+	return 1, nil
+}
+
+// Move transfers key, with its TTL, from src to dst. Returns 0 if the key
+// does not exist in src or already exists in dst.
+func Move(src, dst *KVStore, key string) int {
+	unlock := lockPair(src, dst)
+	defer unlock()
+
+	val, ok := src.load(key)
+	if !ok {
+		return 0
+	}
+	if _, exists := dst.load(key); exists {
+		return 0
+	}
+
+	at, hasTTL := src.getExpire(key)
+	src.delete(key)
+	dst.storeValue(key, val)
+	if hasTTL {
+		dst.setExpire(key, at)
+	}
+	dst.signalKey(key, val.t)
+	return 1
+}
+
+// lockPair write-locks the keyspaces of two stores in a consistent order,
+// so concurrent cross-database commands cannot deadlock.
+func lockPair(a, b *KVStore) (unlock func()) {
+	if a == b {
+		a.keyMu.Lock()
+		return a.keyMu.Unlock
+	}
+	if a.id > b.id {
+		a, b = b, a
+	}
+	a.keyMu.Lock()
+	b.keyMu.Lock()
+	return func() {
+		b.keyMu.Unlock()
+		a.keyMu.Unlock()
+	}
+}
+
+// copyValue returns a deep copy, so the copy can be mutated independently.
+func copyValue(val StoreValue) StoreValue {
+	switch v := val.v.(type) {
+	case StringValue:
+		if v.raw != nil {
+			val.v = StringValue{raw: slices.Clone(v.raw)}
+		}
+	case *ListValue:
+		val.v = v.clone()
+	case ZSetValue:
+		val.v = v.clone()
+	case HashValue:
+		val.v = HashValue{fields: v.fields.clone()}
+	case SetValue:
+		val.v = v.clone()
+	case StreamValue:
+		val.v = StreamValue{
+			lastID:  v.lastID,
+			entries: slices.Clone(v.entries),
+		}
+	}
+	return val
+}
+
+// signalKey wakes up clients blocked on key after it received new data.
+func (kv *KVStore) signalKey(key string, t ValueType) {
+	switch t {
+	case ListType, ZSetType:
+		kv.wake(key)
+	case StreamType:
+		kv.fanOutCond.Broadcast()
+	}
+}
+
+// ObjectEncoding returns the name Redis gives to the internal encoding of
+// the value at key, or false if the key doesn't exist.
+func (kv *KVStore) ObjectEncoding(key string) (string, bool) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	val, ok := kv.load(key)
+	if !ok {
+		return "", false
+	}
+	switch v := val.v.(type) {
+	case StringValue:
+		return v.Encoding(), true
+	case *ListValue:
+		return v.Encoding(), true
+	case SetValue:
+		return v.Encoding(), true
+	case ZSetValue:
+		return v.Encoding(), true
+	case HashValue:
+		return v.Encoding(), true
+	}
+	return "stream", true
+}
+
+// Touch returns the number of existing keys. There is no LRU clock, so
+// touching only checks existence (and lazily expires the keys).
+func (kv *KVStore) Touch(keys ...string) int {
+	return kv.Exists(keys...)
+}
+
+// RandomKey returns a random live key, or false when the store is empty.
+func (kv *KVStore) RandomKey() (string, bool) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	for {
+		key, ok := kv.index.random()
+		if !ok {
+			return "", false
+		}
+		if _, ok := kv.load(key); ok {
+			return key, true
+		}
+	}
+}
+
+// DBSize returns the number of keys, including keys that are logically
+// expired but not yet reclaimed, like Redis does.
+func (kv *KVStore) DBSize() int {
+	return kv.index.size()
+}
+
+// Flush removes every key. With async, the old values are released in
+// the background.
+func (kv *KVStore) Flush(async bool) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+
+	removed := []StoreValue{}
+	if async {
+		kv.mp.Range(func(k, v any) bool {
+			removed = append(removed, v.(StoreValue))
+			return true
+		})
+	}
+	kv.mp.Clear()
+	kv.index.reset()
+	kv.expMu.Lock()
+	clear(kv.expires)
+	kv.expMu.Unlock()
+
+	if async {
+		go freeValues(removed)
+	}
+}
+
+// KeyspaceInfo returns the number of keys, the number of keys with a TTL
+// and their average remaining TTL in milliseconds.
+func (kv *KVStore) KeyspaceInfo() (keys, expires int, avgTTL int64) {
+	keys = kv.index.size()
+
+	kv.expMu.Lock()
+	defer kv.expMu.Unlock()
+	now := time.Now()
+	var total int64
+	for _, at := range kv.expires {
+		if ttl := at.Sub(now).Milliseconds(); ttl > 0 {
+			total += ttl
+		}
+	}
+	expires = len(kv.expires)
+	if expires > 0 {
+		avgTTL = total / int64(expires)
+	}
+	return
+}
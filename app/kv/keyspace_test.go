@@ -0,0 +1,115 @@
+package kv
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDelExists(t *testing.T) {
+	kv := NewKVStore()
+	kv.MSet([]string{"a", "1", "b", "2", "c", "3"})
+	if got := kv.Exists("a", "a", "missing", "b"); got != 3 {
+		t.Errorf("Exists counts repeated keys: got %d, want 3", got)
+	}
+	if got := kv.Del("a", "a", "missing"); got != 1 {
+		t.Errorf("Del = %d, want 1", got)
+	}
+	if got := kv.Unlink("b", "c", "missing"); got != 2 {
+		t.Errorf("Unlink = %d, want 2", got)
+	}
+	if kv.DBSize() != 0 {
+		t.Errorf("DBSize = %d after deleting every key", kv.DBSize())
+	}
+}
+
+func TestRename(t *testing.T) {
+	kv := NewKVStore()
+	at := time.Now().Add(time.Hour)
+	kv.Set("src", "v")
+	kv.Expire("src", at, ExpireAlways)
+	kv.Set("dst", "old")
+
+	if _, err := kv.Rename("missing", "x", false); err != ErrNoSuchKey {
+		t.Errorf("Rename of a missing key error = %v, want ErrNoSuchKey", err)
+	}
+	if n, _ := kv.Rename("src", "dst", true); n != 0 {
+		t.Errorf("RENAMENX over an existing key = %d, want 0", n)
+	}
+	if n, _ := kv.Rename("src", "src", false); n != 1 {
+		t.Errorf("Rename onto itself = %d, want 1", n)
+	}
+	if n, err := kv.Rename("src", "dst", false); n != 1 || err != nil {
+		t.Fatalf("Rename = %d, %v", n, err)
+	}
+	if got, _ := kv.Get("dst"); got != "v" {
+		t.Errorf("dst = %v after Rename, want v", got)
+	}
+	if kv.Exists("src") != 0 {
+		t.Error("src still exists after Rename")
+	}
+	if kv.ExpireTime("dst") != at.UnixMilli() {
+		t.Error("Rename lost the TTL")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	kv, other := NewKVStore(), NewKVStore()
+	at := time.Now().Add(time.Hour)
+	kv.Set("str", "v")
+	kv.Expire("str", at, ExpireAlways)
+	kv.RPush("list", []string{"a", "b"})
+	kv.SAdd("set", []string{"a", "b"})
+	kv.HSet("hash", []string{"f", "v"})
+	kv.ZAdd("zset", "a", 1)
+
+	for _, key := range []string{"str", "list", "set", "hash", "zset"} {
+		if n, err := kv.Copy(key, kv, key+"2", false); n != 1 || err != nil {
+			t.Errorf("Copy(%s) = %d, %v, want 1", key, n, err)
+		}
+	}
+	if kv.ExpireTime("str2") != at.UnixMilli() {
+		t.Error("Copy lost the TTL")
+	}
+
+	// the copies are independent of the originals
+	kv.Append("str2", "x")
+	kv.RPush("list2", []string{"c"})
+	kv.SAdd("set2", []string{"c"})
+	kv.HSet("hash2", []string{"f", "changed"})
+	kv.ZAdd("zset2", "a", 5)
+	if got, _ := kv.Get("str"); got != "v" {
+		t.Errorf("str = %v after changing its copy", got)
+	}
+	if got, _ := kv.LRange("list", 0, -1); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("list = %v after changing its copy", got)
+	}
+	if n, _ := kv.SCard("set"); n != 2 {
+		t.Errorf("set has %d members after changing its copy", n)
+	}
+	if got, _ := kv.HGet("hash", "f"); got != "v" {
+		t.Errorf("hash f = %v after changing its copy", got)
+	}
+	if got, _ := kv.ZScore("zset", "a"); got != 1.0 {
+		t.Errorf("zset a = %v after changing its copy", got)
+	}
+
+	if n, _ := kv.Copy("str", kv, "str2", false); n != 0 {
+		t.Errorf("Copy over an existing key = %d, want 0", n)
+	}
+	if n, _ := kv.Copy("str", kv, "str2", true); n != 1 {
+		t.Errorf("Copy with replace = %d, want 1", n)
+	}
+	if n, _ := kv.Copy("missing", kv, "x", false); n != 0 {
+		t.Errorf("Copy of a missing key = %d, want 0", n)
+	}
+	if _, err := kv.Copy("str", kv, "str", true); err != ErrSameObject {
+		t.Errorf("Copy onto itself error = %v, want ErrSameObject", err)
+	}
+	if n, err := kv.Copy("str", other, "str", false); n != 1 || err != nil {
+		t.Errorf("Copy to another database = %d, %v, want 1", n, err)
+	}
+	if got, _ := other.Get("str"); got != "v" {
+		t.Errorf("copied value in the other database = %v", got)
+	}
+}
@@ -1,14 +1,35 @@
 package kv
 
 import (
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var nextStoreID atomic.Int64
+
+var (
+	ErrNoSuchKey       = errors.New("ERR no such key")
+	ErrWrongType       = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNotInteger      = errors.New("ERR value is not an integer or out of range")
+	ErrNotFloat        = errors.New("ERR value is not a valid float")
+	ErrOverflow        = errors.New("ERR increment or decrement would overflow")
+	ErrNaN             = errors.New("ERR increment would produce NaN or Infinity")
+	ErrIndexOutOfRange = errors.New("ERR index out of range")
+	ErrSameObject      = errors.New("ERR source and destination objects are the same")
 )
 
 type KVStore struct {
 	sync.Mutex
+	id          int64        // unique id, orders locking when two stores are involved
+	keyMu       sync.RWMutex // serializes read-modify-write commands on the keyspace
 	mp          sync.Map
-	watingQueue map[string][]chan struct{} // exclusive chan for each blpop client
-	fanOutCond  *sync.Cond                 // fan-out sync for all xread blocked at same stream
+	index       *keyIndex // bucketed copy of the key set, for SCAN and RANDOMKEY
+	expMu       sync.Mutex
+	expires     map[string]time.Time        // only keys with a TTL, guarded by expMu
+	watingQueue map[string][]*blockedClient // clients blocked on each key, guarded by keyMu
+	fanOutCond  *sync.Cond                  // fan-out sync for all xread blocked at same stream
 }
 
 type ValueType int
@@ -21,7 +42,6 @@ const (
 	HashType
 	StreamType
 	VectorsetType
-	ErrorType
 )
 
 type StoreValue struct {
@@ -35,54 +55,109 @@ func NewStoreValue(t ValueType, v any) StoreValue {
 
 func NewKVStore() *KVStore {
 	kv := &KVStore{
+		id:          nextStoreID.Add(1),
 		mp:          sync.Map{},
-		watingQueue: make(map[string][]chan struct{}),
+		index:       newKeyIndex(),
+		expires:     make(map[string]time.Time),
+		watingQueue: make(map[string][]*blockedClient),
 	}
 	kv.fanOutCond = sync.NewCond(&kv.Mutex)
+	go kv.activeExpireCycle()
 	return kv
 }
 
+// load returns the value of a live key. Expired keys are deleted on access.
+func (kv *KVStore) load(key string) (StoreValue, bool) {
+	val, ok := kv.mp.Load(key)
+	if !ok {
+		return StoreValue{}, false
+	}
+	if kv.isExpired(key) {
+		kv.delete(key)
+		return StoreValue{}, false
+	}
+	return val.(StoreValue), true
+}
+
+// lookup returns the live value of key when it holds type t. A missing key
+// gives ok == false, a key holding another type gives ErrWrongType.
+func (kv *KVStore) lookup(key string, t ValueType) (StoreValue, bool, error) {
+	val, ok := kv.load(key)
+	if !ok {
+		return StoreValue{}, false, nil
+	}
+	if val.t != t {
+		return StoreValue{}, false, ErrWrongType
+	}
+	return val, true, nil
+}
+
+// store overwrites the value of key, keeping its TTL.
 func (kv *KVStore) store(key string, val any, t ValueType) {
 	storeV := StoreValue{
 		t: t,
 		v: val,
 	}
-	kv.mp.Store(key, storeV)
+	kv.storeValue(key, storeV)
+}
+
+func (kv *KVStore) storeValue(key string, sVal StoreValue) {
+	if _, loaded := kv.mp.Swap(key, sVal); !loaded {
+		kv.index.add(key)
+	}
+}
+
+// delete removes key and its TTL. Returns whether the key existed.
+func (kv *KVStore) delete(key string) bool {
+	kv.clearExpire(key)
+	_, existed := kv.mp.LoadAndDelete(key)
+	if existed {
+		kv.index.remove(key)
+	}
+	return existed
 }
 
 func (kv *KVStore) Store(key string, sVal StoreValue) {
-	kv.mp.Store(key, sVal)
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	kv.storeValue(key, sVal)
+	kv.clearExpire(key)
+}
+
+var typeNames = map[ValueType]string{
+	StringType:    "string",
+	ListType:      "list",
+	SetType:       "set",
+	ZSetType:      "zset",
+	HashType:      "hash",
+	StreamType:    "stream",
+	VectorsetType: "vectorset",
 }
 
 func (kv *KVStore) Type(key string) string {
-	val, ok := kv.mp.Load(key)
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	val, ok := kv.load(key)
 	if !ok {
 		return "none"
 	}
-	switch val.(StoreValue).t {
-	case StringType:
-		return "string"
-	case ListType:
-		return "list"
-	case SetType:
-		return "set"
-	case ZSetType:
-		return "zset"
-	case HashType:
-		return "hash"
-	case StreamType:
-		return "stream"
-	case VectorsetType:
-		return "vectorset"
-	default:
-		return "none"
+	if name, ok := typeNames[val.t]; ok {
+		return name
 	}
+	return "none"
 }
 
-func (kv *KVStore) Keys(query string) []string {
+// Keys returns all the live keys matching the glob-style pattern.
+func (kv *KVStore) Keys(pattern string) []string {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
 	keys := []string{}
+	allKeys := pattern == "*"
 	kv.mp.Range(func(k, v any) bool {
-		keys = append(keys, k.(string))
+		key := k.(string)
+		if (allKeys || MatchPattern(pattern, key, false)) && !kv.isExpired(key) {
+			keys = append(keys, key)
+		}
 		return true
 	})
 	return keys
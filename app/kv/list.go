@@ -1,53 +1,67 @@
 package kv
 
-import (
-	"context"
-	"fmt"
-	"slices"
-	"time"
-)
-
-type ListValue []string
-
-func (kv *KVStore) wake(key string) {
-	kv.Lock()
-	defer kv.Unlock()
-	wQ, ok := kv.watingQueue[key]
-	if !ok || len(wQ) == 0 {
-		return
+func (kv *KVStore) getList(key string) (*ListValue, bool, error) {
+	val, ok, err := kv.lookup(key, ListType)
+	if !ok {
+		return nil, false, err
 	}
-	ch := wQ[0]
-	kv.watingQueue[key] = wQ[1:]
-	ch <- struct{}{}
+	return val.v.(*ListValue), true, nil
 }
 
-func (kv *KVStore) RPush(key string, value []string) int {
-	oldTarList, ok := kv.mp.Load(key)
-	var newTarList ListValue
-	if !ok {
-		newTarList = ListValue{}
-	} else {
-		newTarList = oldTarList.(StoreValue).v.(ListValue)
+// storeList stores list at key, or deletes the key when it is empty.
+func (kv *KVStore) storeList(key string, list *ListValue) {
+	if list.Len() == 0 {
+		kv.delete(key)
+		return
 	}
-	newTarList = append(newTarList, value...)
-	kv.store(key, newTarList, ListType)
-	kv.wake(key)
-	return len(newTarList)
+	kv.store(key, list, ListType)
 }
 
-func (kv *KVStore) LPush(key string, value []string) int {
-	oldTarList, ok := kv.mp.Load(key)
-	var newTarList ListValue
+// push adds values to the head or tail of the list. With onlyIfExists a
+// missing key is left alone and 0 is returned.
+func (kv *KVStore) push(key string, value []string, left, onlyIfExists bool) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	tarList, ok, err := kv.getList(key)
+	if err != nil {
+		return 0, err
+	}
 	if !ok {
-		newTarList = ListValue{}
-	} else {
-		newTarList = oldTarList.(StoreValue).v.(ListValue)
+		if onlyIfExists {
+			return 0, nil
+		}
+		tarList = NewListValue()
 	}
-	slices.Reverse(value)
-	newTarList = append(value, newTarList...)
-	kv.store(key, newTarList, ListType)
+	for _, elem := range value {
+		if left {
+			tarList.pushHead(elem)
+		} else {
+			tarList.pushTail(elem)
+		}
+	}
+	kv.storeList(key, tarList)
+	// blocked clients may pop right away, reply with the pushed length
+	length := tarList.Len()
 	kv.wake(key)
-	return len(newTarList)
+	return length, nil
+}
+
+func (kv *KVStore) RPush(key string, value []string) (int, error) {
+	return kv.push(key, value, false, false)
+}
+
+func (kv *KVStore) LPush(key string, value []string) (int, error) {
+	return kv.push(key, value, true, false)
+}
+
+// RPushX appends values only if the list already exists.
+func (kv *KVStore) RPushX(key string, value []string) (int, error) {
+	return kv.push(key, value, false, true)
+}
+
+// LPushX prepends values only if the list already exists.
+func (kv *KVStore) LPushX(key string, value []string) (int, error) {
+	return kv.push(key, value, true, true)
 }
 
 func (kv *KVStore) validateRange(start, stop, length int) (int, int) {
@@ -66,118 +80,341 @@ func (kv *KVStore) validateRange(start, stop, length int) (int, int) {
 	return start, stop
 }
 
-func (kv *KVStore) LRange(key string, start, stop int) ListValue {
-	res := ListValue{}
-	tarListAny, ok := kv.mp.Load(key)
+func (kv *KVStore) LRange(key string, start, stop int) ([]string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	res := []string{}
+	tarList, ok, err := kv.getList(key)
 	if !ok {
-		return res
-	} else {
-		tarList := tarListAny.(StoreValue).v.(ListValue)
-		length := len(tarList)
-		start, stop = kv.validateRange(start, stop, length)
-		if start >= length || start > stop || stop < 0 {
-			return res
-		}
-		res = tarList[start : stop+1]
+		return res, err
 	}
-	return res
+	length := tarList.Len()
+	start, stop = kv.validateRange(start, stop, length)
+	if start >= length || start > stop || stop < 0 {
+		return res, nil
+	}
+	return tarList.slice(start, stop), nil
 }
 
-func (kv *KVStore) LLen(key string) int {
-	tarListAny, ok := kv.mp.Load(key)
+func (kv *KVStore) LLen(key string) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	tarList, ok, err := kv.getList(key)
 	if !ok {
-		return 0
-	} else {
-		tarList := tarListAny.(StoreValue).v.(ListValue)
-		return len(tarList)
+		return 0, err
 	}
+	return tarList.Len(), nil
 }
 
-func (kv *KVStore) LPop(key string) any {
-	tarListAny, ok := kv.mp.Load(key)
+// pop removes up to num elements from the head or the tail of the list.
+// A missing key gives nil. The caller must hold keyMu.
+func (kv *KVStore) pop(key string, num int, left bool) ([]string, error) {
+	tarList, ok, err := kv.getList(key)
 	if !ok {
-		return nil
+		return nil, err
 	}
-	tarList := tarListAny.(StoreValue).v.(ListValue)
-	length := len(tarList)
-	if length == 0 {
-		return nil
+	num = min(num, tarList.Len())
+	res := make([]string, 0, num)
+	for range num {
+		if left {
+			res = append(res, tarList.popHead())
+		} else {
+			res = append(res, tarList.popTail())
+		}
+	}
+	kv.storeList(key, tarList)
+	return res, nil
+}
+
+// popOne pops a single element, or returns nil when the list is missing.
+func (kv *KVStore) popOne(key string, left bool) (any, error) {
+	res, err := kv.pop(key, 1, left)
+	if len(res) == 0 {
+		return nil, err
 	}
-	res := tarList[0]
-	tarList = tarList[1:]
-	kv.store(key, tarList, ListType)
-	return res
+	return res[0], nil
+}
+
+func (kv *KVStore) LPop(key string) (any, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	return kv.popOne(key, true)
+}
+
+func (kv *KVStore) LPopN(key string, num int) ([]string, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	return kv.pop(key, num, true)
+}
+
+func (kv *KVStore) RPop(key string) (any, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	return kv.popOne(key, false)
+}
+
+func (kv *KVStore) RPopN(key string, num int) ([]string, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	return kv.pop(key, num, false)
 }
 
-func (kv *KVStore) LPopN(key string, num int) []string {
-	tarListAny, ok := kv.mp.Load(key)
+// move pops an element from one end of src and pushes it to one end of
+// dst, which may be the same list. Returns nil when src is missing. The
+// caller must hold keyMu and wake dst.
+func (kv *KVStore) move(src, dst string, fromLeft, toLeft bool) (any, error) {
+	srcList, ok, err := kv.getList(src)
 	if !ok {
-		return nil
+		return nil, err
 	}
-	tarList := tarListAny.(StoreValue).v.(ListValue)
-	length := len(tarList)
-	if length == 0 {
-		return nil
+	dstList, ok, err := kv.getList(dst)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		dstList = NewListValue()
+	}
+
+	var elem string
+	if fromLeft {
+		elem = srcList.popHead()
+	} else {
+		elem = srcList.popTail()
+	}
+	if src == dst {
+		dstList = srcList
+	} else {
+		kv.storeList(src, srcList)
 	}
-	if num > length {
-		num = length
+	if toLeft {
+		dstList.pushHead(elem)
+	} else {
+		dstList.pushTail(elem)
 	}
-	res := tarList[:num]
-	tarList = tarList[num:]
-	kv.store(key, tarList, ListType)
-	return res
+	kv.storeList(dst, dstList)
+	return elem, nil
 }
 
-func (kv *KVStore) BLPop(key string, timeout time.Duration) any {
-	if tarListAny, ok := kv.mp.Load(key); ok {
-		tarList := tarListAny.(StoreValue).v.(ListValue)
-		length := len(tarList)
-		if length > 0 {
-			res := tarList[0]
-			tarList = tarList[1:]
-			kv.store(key, tarList, ListType)
-			return res
+// LMove atomically moves an element between two lists and returns it,
+// or nil when src doesn't exist.
+func (kv *KVStore) LMove(src, dst string, fromLeft, toLeft bool) (any, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	res, err := kv.move(src, dst, fromLeft, toLeft)
+	if res != nil {
+		kv.wake(dst)
+	}
+	return res, err
+}
+
+// BLMove is LMove, but waits for src to receive data.
+func (kv *KVStore) BLMove(src, dst string, fromLeft, toLeft bool, opts BlockOptions) (any, error) {
+	return kv.blockingOp([]string{src}, ListType, opts, func(db *KVStore, key string) (any, bool, error) {
+		res, err := db.move(src, dst, fromLeft, toLeft)
+		if res == nil {
+			return nil, false, err
+		}
+		opts.served(src, 1)
+		db.wake(dst)
+		return res, true, nil
+	})
+}
+
+// LMPop pops up to count elements from the first non-empty list among
+// keys. Returns the key popped from, or an empty elems if all are empty.
+func (kv *KVStore) LMPop(keys []string, left bool, count int) (key string, elems []string, err error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	for _, key := range keys {
+		elems, err := kv.pop(key, count, left)
+		if len(elems) > 0 || err != nil {
+			return key, elems, err
 		}
 	}
+	return "", nil, nil
+}
 
-	kv.Lock()
-	if _, ok := kv.watingQueue[key]; !ok {
-		wQ := []chan struct{}{}
-		kv.watingQueue[key] = wQ
+// BLMPop is LMPop, but waits for one of the keys to receive data.
+// Clients blocked on the same key are served first come, first served.
+func (kv *KVStore) BLMPop(keys []string, left bool, count int, opts BlockOptions) (key string, elems []string, err error) {
+	res, err := kv.blockingOp(keys, ListType, opts, func(db *KVStore, key string) (any, bool, error) {
+		elems, err := db.pop(key, count, left)
+		if len(elems) == 0 {
+			return nil, false, err
+		}
+		opts.served(key, len(elems))
+		return keyedElems{key, elems}, true, nil
+	})
+	if res == nil {
+		return "", nil, err
 	}
+	ke := res.(keyedElems)
+	return ke.key, ke.elems, nil
+}
 
-	ch := make(chan struct{})
-	kv.watingQueue[key] = append(kv.watingQueue[key], ch)
-	kv.Unlock()
+type keyedElems struct {
+	key   string
+	elems []string
+}
 
-	var (
-		tCtx   context.Context
-		cancel context.CancelFunc
-	)
-	if timeout == 0 {
-		tCtx = context.Background()
-	} else {
-		tCtx, cancel = context.WithTimeout(context.Background(), timeout)
-		defer cancel()
+// listIndex converts a possibly negative index, ok is false when out of range.
+func listIndex(index, length int) (int, bool) {
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
+
+// LIndex returns the element at index, or nil.
+func (kv *KVStore) LIndex(key string, index int) (any, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	tarList, ok, err := kv.getList(key)
+	if !ok {
+		return nil, err
+	}
+	i, ok := listIndex(index, tarList.Len())
+	if !ok {
+		return nil, nil
+	}
+	return tarList.get(i), nil
+}
+
+// LSet replaces the element at index.
+func (kv *KVStore) LSet(key string, index int, value string) error {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	tarList, ok, err := kv.getList(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoSuchKey
 	}
+	i, ok := listIndex(index, tarList.Len())
+	if !ok {
+		return ErrIndexOutOfRange
+	}
+	tarList.set(i, value)
+	return nil
+}
 
-	select {
-	case <-tCtx.Done():
+// LInsert inserts value before or after the first occurrence of pivot.
+// Returns the new length, 0 if the key doesn't exist or -1 if pivot
+// wasn't found.
+func (kv *KVStore) LInsert(key string, before bool, pivot, value string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	tarList, ok, err := kv.getList(key)
+	if !ok {
+		return 0, err
+	}
+	i := -1
+	tarList.each(false, func(idx int, elem string) bool {
+		if elem == pivot {
+			i = idx
+			return false
+		}
+		return true
+	})
+	if i < 0 {
+		return -1, nil
+	}
+	if !before {
+		i++
+	}
+	tarList.insert(i, value)
+	return tarList.Len(), nil
+}
+
+// LRem removes the first count occurrences of value, scanning from the
+// tail when count is negative and removing all of them when it is 0.
+func (kv *KVStore) LRem(key string, count int, value string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	tarList, ok, err := kv.getList(key)
+	if !ok {
+		return 0, err
+	}
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	remove := make(map[int]bool)
+	tarList.each(count < 0, func(i int, elem string) bool {
+		if elem == value {
+			remove[i] = true
+		}
+		return limit == 0 || len(remove) < limit
+	})
+	if len(remove) == 0 {
+		return 0, nil
+	}
+	newList := NewListValue()
+	tarList.each(false, func(i int, elem string) bool {
+		if !remove[i] {
+			newList.pushTail(elem)
+		}
+		return true
+	})
+	kv.storeList(key, newList)
+	return len(remove), nil
+}
+
+// LTrim keeps only the elements between start and stop (inclusive).
+func (kv *KVStore) LTrim(key string, start, stop int) error {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	tarList, ok, err := kv.getList(key)
+	if !ok {
+		return err
+	}
+	length := tarList.Len()
+	start, stop = kv.validateRange(start, stop, length)
+	if start >= length || start > stop || stop < 0 {
+		kv.delete(key)
 		return nil
-	case <-ch:
 	}
+	for range start {
+		tarList.popHead()
+	}
+	for range length - 1 - stop {
+		tarList.popTail()
+	}
+	return nil
+}
 
-	tarListAny, ok := kv.mp.Load(key)
+// LPos returns the indexes of the elements equal to element. rank picks
+// the first match to return (negative ranks scan from the tail), count
+// limits the number of matches (0 means all) and maxLen limits the number
+// of elements compared (0 means all).
+func (kv *KVStore) LPos(key, element string, rank, count, maxLen int) ([]int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	res := []int{}
+	tarList, ok, err := kv.getList(key)
 	if !ok {
-		panic(fmt.Sprintf("Unexpected empty tarList for key: %s", key))
+		return res, err
 	}
-	tarList := tarListAny.(StoreValue).v.(ListValue)
-	length := len(tarList)
-	if length == 0 {
-		panic(fmt.Sprintf("Unexpected empty tarList for key: %s", key))
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
 	}
-	res := tarList[0]
-	tarList = tarList[1:]
-	kv.store(key, tarList, ListType)
-	return res
+	compared := 0
+	tarList.each(rank < 0, func(i int, elem string) bool {
+		if maxLen > 0 && compared == maxLen {
+			return false
+		}
+		compared++
+		if elem != element {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		res = append(res, i)
+		return count == 0 || len(res) < count
+	})
+	return res, nil
 }
@@ -0,0 +1,349 @@
+package kv
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newList returns a store holding elems at "l".
+func newList(t *testing.T, elems ...string) *KVStore {
+	t.Helper()
+	kv := NewKVStore()
+	if _, err := kv.RPush("l", elems); err != nil {
+		t.Fatalf("RPush: %v", err)
+	}
+	return kv
+}
+
+func listOf(t *testing.T, kv *KVStore) []string {
+	t.Helper()
+	res, err := kv.LRange("l", 0, -1)
+	if err != nil {
+		t.Fatalf("LRange: %v", err)
+	}
+	return res
+}
+
+func TestPushX(t *testing.T) {
+	kv := NewKVStore()
+	if n, err := kv.LPushX("l", []string{"a"}); n != 0 || err != nil {
+		t.Errorf("LPushX on a missing key = %d, %v, want 0", n, err)
+	}
+	if kv.Exists("l") != 0 {
+		t.Errorf("LPushX created the key")
+	}
+	kv.RPush("l", []string{"b"})
+	kv.LPushX("l", []string{"a", "0"})
+	if n, _ := kv.RPushX("l", []string{"c"}); n != 4 {
+		t.Errorf("RPushX = %d, want 4", n)
+	}
+	if got := listOf(t, kv); !slices.Equal(got, []string{"0", "a", "b", "c"}) {
+		t.Errorf("list = %q", got)
+	}
+}
+
+func TestPop(t *testing.T) {
+	kv := newList(t, "a", "b", "c", "d")
+	if got, _ := kv.RPop("l"); got != "d" {
+		t.Errorf("RPop = %v, want d", got)
+	}
+	if got, _ := kv.RPopN("l", 2); !slices.Equal(got, []string{"c", "b"}) {
+		t.Errorf("RPopN(2) = %q, want [c b]", got)
+	}
+	if got, _ := kv.LPopN("l", 0); got == nil || len(got) != 0 {
+		t.Errorf("LPopN(0) = %#v, want an empty slice", got)
+	}
+	if got, _ := kv.LPopN("l", 10); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("LPopN(10) = %q, want [a]", got)
+	}
+	if kv.Exists("l") != 0 {
+		t.Errorf("popping the last element left the key")
+	}
+	if got, err := kv.RPop("l"); got != nil || err != nil {
+		t.Errorf("RPop of a missing key = %v, %v, want nil", got, err)
+	}
+	if got, err := kv.RPopN("l", 2); got != nil || err != nil {
+		t.Errorf("RPopN of a missing key = %#v, %v, want nil", got, err)
+	}
+}
+
+func TestLIndexLSet(t *testing.T) {
+	kv := newList(t, "a", "b", "c")
+	for _, tt := range []struct {
+		index int
+		want  any
+	}{
+		{0, "a"}, {2, "c"}, {-1, "c"}, {-3, "a"}, {3, nil}, {-4, nil},
+	} {
+		if got, _ := kv.LIndex("l", tt.index); got != tt.want {
+			t.Errorf("LIndex(%d) = %v, want %v", tt.index, got, tt.want)
+		}
+	}
+
+	if err := kv.LSet("l", -1, "z"); err != nil {
+		t.Fatalf("LSet: %v", err)
+	}
+	if err := kv.LSet("l", 3, "z"); err != ErrIndexOutOfRange {
+		t.Errorf("LSet out of range error = %v", err)
+	}
+	if err := kv.LSet("missing", 0, "z"); err != ErrNoSuchKey {
+		t.Errorf("LSet on a missing key error = %v", err)
+	}
+	if got := listOf(t, kv); !slices.Equal(got, []string{"a", "b", "z"}) {
+		t.Errorf("list = %q", got)
+	}
+}
+
+func TestLInsert(t *testing.T) {
+	kv := newList(t, "a", "b", "a")
+	if n, _ := kv.LInsert("l", true, "a", "x"); n != 4 {
+		t.Errorf("LInsert BEFORE = %d, want 4", n)
+	}
+	if n, _ := kv.LInsert("l", false, "a", "y"); n != 5 {
+		t.Errorf("LInsert AFTER = %d, want 5", n)
+	}
+	if n, _ := kv.LInsert("l", false, "missing", "y"); n != -1 {
+		t.Errorf("LInsert without pivot = %d, want -1", n)
+	}
+	if n, _ := kv.LInsert("missing", false, "a", "y"); n != 0 {
+		t.Errorf("LInsert on a missing key = %d, want 0", n)
+	}
+	if got := listOf(t, kv); !slices.Equal(got, []string{"x", "a", "y", "b", "a"}) {
+		t.Errorf("list = %q", got)
+	}
+}
+
+func TestLRem(t *testing.T) {
+	elems := []string{"a", "b", "a", "c", "a"}
+	tests := []struct {
+		count int
+		n     int
+		want  []string
+	}{
+		{0, 3, []string{"b", "c"}},
+		{2, 2, []string{"b", "c", "a"}},
+		{-2, 2, []string{"a", "b", "c"}},
+		{-10, 3, []string{"b", "c"}},
+	}
+	for _, tt := range tests {
+		kv := newList(t, elems...)
+		n, _ := kv.LRem("l", tt.count, "a")
+		if got := listOf(t, kv); n != tt.n || !slices.Equal(got, tt.want) {
+			t.Errorf("LRem(%d) = %d, list %q, want %d, %q", tt.count, n, got, tt.n, tt.want)
+		}
+	}
+
+	kv := newList(t, "a", "a")
+	if n, _ := kv.LRem("l", 0, "a"); n != 2 || kv.Exists("l") != 0 {
+		t.Errorf("LRem of every element = %d, key exists %d", n, kv.Exists("l"))
+	}
+}
+
+func TestLTrim(t *testing.T) {
+	elems := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		start, stop int
+		want        []string
+	}{
+		{1, 3, []string{"b", "c", "d"}},
+		{0, -1, elems},
+		{-2, 100, []string{"d", "e"}},
+		{-100, 0, []string{"a"}},
+		{3, 1, []string{}},
+		{5, 10, []string{}},
+		{0, -6, []string{}},
+	}
+	for _, tt := range tests {
+		kv := newList(t, elems...)
+		if err := kv.LTrim("l", tt.start, tt.stop); err != nil {
+			t.Fatalf("LTrim: %v", err)
+		}
+		if got := listOf(t, kv); !slices.Equal(got, tt.want) {
+			t.Errorf("LTrim(%d, %d) = %q, want %q", tt.start, tt.stop, got, tt.want)
+		}
+		if len(tt.want) == 0 && kv.Exists("l") != 0 {
+			t.Errorf("LTrim(%d, %d) left an empty list", tt.start, tt.stop)
+		}
+	}
+}
+
+func TestLPos(t *testing.T) {
+	kv := newList(t, "a", "b", "c", "1", "2", "3", "c", "c")
+	tests := []struct {
+		rank, count, maxLen int
+		want                []int
+	}{
+		{1, 1, 0, []int{2}},
+		{2, 1, 0, []int{6}},
+		{-1, 1, 0, []int{7}},
+		{-2, 0, 0, []int{6, 2}},
+		{1, 0, 0, []int{2, 6, 7}},
+		{1, 2, 0, []int{2, 6}},
+		{1, 0, 7, []int{2, 6}},
+		{-1, 0, 2, []int{7, 6}},
+		{4, 0, 0, []int{}},
+		{1, 0, 2, []int{}},
+	}
+	for _, tt := range tests {
+		got, _ := kv.LPos("l", "c", tt.rank, tt.count, tt.maxLen)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("LPos(rank %d, count %d, maxlen %d) = %v, want %v", tt.rank, tt.count, tt.maxLen, got, tt.want)
+		}
+	}
+}
+
+func TestListWrongType(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("s", "v")
+	if _, err := kv.LIndex("s", 0); err != ErrWrongType {
+		t.Errorf("LIndex error = %v", err)
+	}
+	if err := kv.LSet("s", 0, "x"); err != ErrWrongType {
+		t.Errorf("LSet error = %v", err)
+	}
+	if _, err := kv.LPos("s", "x", 1, 0, 0); err != ErrWrongType {
+		t.Errorf("LPos error = %v", err)
+	}
+	if _, err := kv.RPushX("s", []string{"x"}); err != ErrWrongType {
+		t.Errorf("RPushX error = %v", err)
+	}
+}
+
+func TestLMove(t *testing.T) {
+	tests := []struct {
+		fromLeft, toLeft bool
+		elem             string
+		src, dst         []string
+	}{
+		{true, true, "a", []string{"b", "c"}, []string{"a", "x"}},
+		{true, false, "a", []string{"b", "c"}, []string{"x", "a"}},
+		{false, true, "c", []string{"a", "b"}, []string{"c", "x"}},
+		{false, false, "c", []string{"a", "b"}, []string{"x", "c"}},
+	}
+	for _, tt := range tests {
+		kv := newList(t, "a", "b", "c")
+		kv.RPush("d", []string{"x"})
+		elem, err := kv.LMove("l", "d", tt.fromLeft, tt.toLeft)
+		if elem != tt.elem || err != nil {
+			t.Errorf("LMove(%v, %v) = %v, %v, want %s", tt.fromLeft, tt.toLeft, elem, err, tt.elem)
+		}
+		dst, _ := kv.LRange("d", 0, -1)
+		if src := listOf(t, kv); !slices.Equal(src, tt.src) || !slices.Equal(dst, tt.dst) {
+			t.Errorf("LMove(%v, %v) left %q and %q, want %q and %q", tt.fromLeft, tt.toLeft, src, dst, tt.src, tt.dst)
+		}
+	}
+}
+
+func TestLMoveEdgeCases(t *testing.T) {
+	// rotating a list onto itself
+	kv := newList(t, "a", "b", "c")
+	kv.LMove("l", "l", false, true)
+	if got := listOf(t, kv); !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("rotated list = %q", got)
+	}
+	kv = newList(t, "a")
+	if elem, _ := kv.LMove("l", "l", true, false); elem != "a" || kv.Exists("l") != 1 {
+		t.Errorf("moving the only element onto its list = %v, exists %d", elem, kv.Exists("l"))
+	}
+
+	// the last element moves out, the source key goes away
+	kv = newList(t, "a")
+	kv.LMove("l", "new", true, true)
+	if kv.Exists("l") != 0 || kv.Type("new") != "list" {
+		t.Errorf("after moving the last element: l exists %d, new is %s", kv.Exists("l"), kv.Type("new"))
+	}
+
+	if elem, err := kv.LMove("missing", "new", true, true); elem != nil || err != nil {
+		t.Errorf("LMove from a missing key = %v, %v, want nil", elem, err)
+	}
+
+	// nothing is popped when the destination has the wrong type
+	kv = newList(t, "a")
+	kv.Set("s", "v")
+	if _, err := kv.LMove("l", "s", true, true); err != ErrWrongType {
+		t.Errorf("LMove to a string error = %v", err)
+	}
+	if got := listOf(t, kv); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("source after a failed move = %q", got)
+	}
+}
+
+// blockOn runs fn in a goroutine and returns its result on a channel,
+// once fn had the time to block.
+func blockOn(fn func() any) <-chan any {
+	done := make(chan any, 1)
+	go func() { done <- fn() }()
+	time.Sleep(20 * time.Millisecond)
+	return done
+}
+
+func waitFor(t *testing.T, done <-chan any) any {
+	t.Helper()
+	select {
+	case res := <-done:
+		return res
+	case <-time.After(time.Second):
+		t.Fatal("blocked call not served")
+		return nil
+	}
+}
+
+func TestBLMove(t *testing.T) {
+	kv := NewKVStore()
+	var served []string
+	opts := BlockOptions{Served: func(key string, n int) {
+		served = append(served, fmt.Sprintf("%s:%d", key, n))
+	}}
+	done := blockOn(func() any {
+		elem, _ := kv.BLMove("src", "dst", true, false, opts)
+		return elem
+	})
+	if n, _ := kv.RPush("src", []string{"a", "b"}); n != 2 {
+		t.Errorf("RPush that serves a blocked move = %d, want the pushed length 2", n)
+	}
+	if got := waitFor(t, done); got != "a" {
+		t.Errorf("BLMove = %v, want a", got)
+	}
+	if dst, _ := kv.LRange("dst", 0, -1); !slices.Equal(dst, []string{"a"}) {
+		t.Errorf("dst = %q", dst)
+	}
+	if !slices.Equal(served, []string{"src:1"}) {
+		t.Errorf("Served calls = %q", served)
+	}
+
+	// served right away when src has data
+	if elem, _ := kv.BLMove("src", "dst", true, false, opts); elem != "b" {
+		t.Errorf("BLMove = %v, want b", elem)
+	}
+
+	start := time.Now()
+	elem, err := kv.BLMove("src", "dst", true, false, BlockOptions{Timeout: 50 * time.Millisecond})
+	if elem != nil || err != nil || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("BLMove timing out = %v, %v after %v", elem, err, time.Since(start))
+	}
+}
+
+// A blocked move pushing to a list another client waits on serves it too.
+func TestBLMoveChain(t *testing.T) {
+	kv := NewKVStore()
+	moved := blockOn(func() any {
+		elem, _ := kv.BLMove("a", "b", true, true, BlockOptions{})
+		return elem
+	})
+	popped := blockOn(func() any {
+		_, elems, _ := kv.BLMPop([]string{"b"}, true, 1, BlockOptions{})
+		return elems[0]
+	})
+	kv.RPush("a", []string{"x"})
+	if got := waitFor(t, moved); got != "x" {
+		t.Errorf("BLMove = %v, want x", got)
+	}
+	if got := waitFor(t, popped); got != "x" {
+		t.Errorf("BLMPop on the destination = %v, want x", got)
+	}
+	if kv.Exists("a", "b") != 0 {
+		t.Errorf("lists left after the chain: %d", kv.Exists("a", "b"))
+	}
+}
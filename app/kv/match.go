@@ -0,0 +1,126 @@
+package kv
+
+import "unicode"
+
+// MatchPattern reports whether str matches the glob-style pattern, with
+// the same rules as Redis's stringmatchlen:
+//
+//	?      matches any single character
+//	*      matches any sequence of characters, including none
+//	[abc]  matches one of the listed characters, [^abc] negates the class
+//	[a-z]  matches a character in the range
+//	\x     matches x literally
+func MatchPattern(pattern, str string, nocase bool) bool {
+	skipLonger := false
+	return matchPattern(pattern, str, nocase, &skipLonger, 0)
+}
+
+// Nesting limit for '*', so a pattern made of thousands of them can't
+// exhaust the stack.
+const maxMatchNesting = 1000
+
+// matchPattern sets skipLonger once the rest of the pattern after a '*'
+// failed against every suffix of str it was given. An enclosing '*' can
+// only hand out shorter suffixes than those, so it gives up too instead
+// of retrying them all: this keeps patterns like "*a*a*a*b" from taking
+// exponential time.
+func matchPattern(pattern, str string, nocase bool, skipLonger *bool, nesting int) bool {
+	if nesting > maxMatchNesting {
+		return false
+	}
+	p, s := 0, 0
+	for p < len(pattern) && s < len(str) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for ; s < len(str); s++ {
+				if matchPattern(pattern[p+1:], str[s:], nocase, skipLonger, nesting+1) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+			}
+			*skipLonger = true
+			return false
+		case '?':
+			s++
+		case '[':
+			p++
+			not := p < len(pattern) && pattern[p] == '^'
+			if not {
+				p++
+			}
+			match := false
+			for {
+				if p >= len(pattern) {
+					// unterminated class: treat the end as ']'
+					p--
+					break
+				}
+				if pattern[p] == '\\' && p+2 < len(pattern) {
+					p++
+					if pattern[p] == str[s] {
+						match = true
+					}
+				} else if pattern[p] == ']' {
+					break
+				} else if p+2 < len(pattern) && pattern[p+1] == '-' {
+					start, end := pattern[p], pattern[p+2]
+					c := str[s]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					p += 2
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if equalByte(pattern[p], str[s], nocase) {
+					match = true
+				}
+				p++
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s++
+		case '\\':
+			if p+1 < len(pattern) {
+				p++
+			}
+			fallthrough
+		default:
+			if !equalByte(pattern[p], str[s], nocase) {
+				return false
+			}
+			s++
+		}
+		p++
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern) && s == len(str)
+}
+
+func toLower(c byte) byte {
+	return byte(unicode.ToLower(rune(c)))
+}
+
+func equalByte(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
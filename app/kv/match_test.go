@@ -0,0 +1,71 @@
+package kv
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		nocase       bool
+		want         bool
+	}{
+		{"*", "", false, true},
+		{"*", "anything", false, true},
+		{"h?llo", "hello", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "hllo", false, true},
+		{"h*llo", "heeeello", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[b-a]llo", "hbllo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{`h\*llo`, "h*llo", false, true},
+		{`h\*llo`, "hello", false, false},
+		{`h[\]]llo`, "h]llo", false, true},
+		{"h[ab", "ha", false, true},
+		{"HELLO", "hello", false, false},
+		{"HELLO", "hello", true, true},
+		{"h[A-Z]llo", "hello", true, true},
+		{"a*b*c", "aXbYc", false, true},
+		{"a*b*c", "aXbY", false, false},
+		{"*a", "ba", false, true},
+		{"**a**", "xay", false, true},
+		{"user:*:name", "user:42:name", false, true},
+		{"user:*:name", "user:42:age", false, false},
+		{"", "", false, true},
+		{"", "a", false, false},
+	}
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.str, tt.nocase); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q, %v) = %v, want %v", tt.pattern, tt.str, tt.nocase, got, tt.want)
+		}
+	}
+}
+
+// Patterns with many stars used to retry every split of the string.
+func TestMatchPatternLinear(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{strings.Repeat("*a", 30) + "*b", strings.Repeat("a", 100), false},
+		{strings.Repeat("*a", 30) + "*b", strings.Repeat("a", 100) + "b", true},
+		{strings.Repeat("a*", 20) + "c", strings.Repeat("ab", 5000), false},
+		{strings.Repeat("*", 100000) + "x", "x", true},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		if got := MatchPattern(tt.pattern, tt.str, false); got != tt.want {
+			t.Errorf("MatchPattern(%.20q..., %.20q...) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("MatchPattern(%.20q..., %.20q...) took %v", tt.pattern, tt.str, d)
+		}
+	}
+}
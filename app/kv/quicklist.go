@@ -0,0 +1,285 @@
+package kv
+
+// Lists are quicklists, like in Redis: a doubly linked list of nodes that
+// each hold a small run of elements. Pushes and pops only touch the node
+// at that end, and a node is released as soon as it is empty, so both
+// are O(1) amortized and a long-lived queue doesn't keep popped elements
+// alive.
+const (
+	listNodeMaxEntries = 128
+	listNodeMaxBytes   = 8192
+	// A list is reported as a listpack until it grows past
+	// listMaxListpackBytes (list-max-listpack-size -2) and as a quicklist
+	// until it shrinks back to half of it.
+	listMaxListpackBytes = 8192
+	listpackHdrSize      = 7
+)
+
+// listEntrySize approximates the bytes taken by s in a listpack: a
+// header, the data and the back length.
+func listEntrySize(s string) int {
+	if len(s) < 64 {
+		return len(s) + 2
+	}
+	return len(s) + 4
+}
+
+type listNode struct {
+	prev, next *listNode
+	entries    []string
+	size       int // listEntrySize of the entries
+}
+
+func (n *listNode) full(s string) bool {
+	return len(n.entries) >= listNodeMaxEntries || n.size+listEntrySize(s) > listNodeMaxBytes
+}
+
+// ListValue is stored by pointer and updated in place.
+type ListValue struct {
+	head, tail *listNode
+	count      int
+	size       int
+	quicklist  bool // encoding, see listMaxListpackBytes
+}
+
+func NewListValue() *ListValue {
+	return &ListValue{}
+}
+
+// NewListValueFrom builds a list holding elems in order.
+func NewListValueFrom(elems []string) *ListValue {
+	l := NewListValue()
+	for _, elem := range elems {
+		l.pushTail(elem)
+	}
+	return l
+}
+
+func (l *ListValue) Len() int {
+	return l.count
+}
+
+func (l *ListValue) Encoding() string {
+	if l.quicklist {
+		return "quicklist"
+	}
+	return "listpack"
+}
+
+// resize accounts for delta bytes and updates the encoding.
+func (l *ListValue) resize(delta int) {
+	l.size += delta
+	switch {
+	case !l.quicklist && listpackHdrSize+l.size > listMaxListpackBytes:
+		l.quicklist = true
+	case l.quicklist && listpackHdrSize+l.size <= listMaxListpackBytes/2:
+		l.quicklist = false
+	}
+}
+
+// linkAfter inserts a new empty node after prev, or at the head if prev
+// is nil.
+func (l *ListValue) linkAfter(prev *listNode) *listNode {
+	n := &listNode{prev: prev}
+	if prev == nil {
+		n.next = l.head
+		l.head = n
+	} else {
+		n.next = prev.next
+		prev.next = n
+	}
+	if n.next == nil {
+		l.tail = n
+	} else {
+		n.next.prev = n
+	}
+	return n
+}
+
+func (l *ListValue) unlink(n *listNode) {
+	if n.prev == nil {
+		l.head = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next == nil {
+		l.tail = n.prev
+	} else {
+		n.next.prev = n.prev
+	}
+	n.prev, n.next = nil, nil
+}
+
+func (l *ListValue) pushHead(s string) {
+	n := l.head
+	if n == nil || n.full(s) {
+		n = l.linkAfter(nil)
+	}
+	n.entries = append(n.entries, "")
+	copy(n.entries[1:], n.entries)
+	n.entries[0] = s
+	l.added(n, s)
+}
+
+func (l *ListValue) pushTail(s string) {
+	n := l.tail
+	if n == nil || n.full(s) {
+		n = l.linkAfter(l.tail)
+	}
+	n.entries = append(n.entries, s)
+	l.added(n, s)
+}
+
+func (l *ListValue) added(n *listNode, s string) {
+	n.size += listEntrySize(s)
+	l.count++
+	l.resize(listEntrySize(s))
+}
+
+// removeEntry deletes the i-th entry of n, releasing n once it is empty.
+func (l *ListValue) removeEntry(n *listNode, i int) string {
+	s := n.entries[i]
+	switch {
+	case len(n.entries) == 1:
+		l.unlink(n)
+		n.entries = nil
+	case i == 0:
+		// don't keep the popped string alive through the array
+		n.entries[0] = ""
+		n.entries = n.entries[1:]
+	default:
+		last := len(n.entries) - 1
+		copy(n.entries[i:], n.entries[i+1:])
+		n.entries[last] = ""
+		n.entries = n.entries[:last]
+	}
+	n.size -= listEntrySize(s)
+	l.count--
+	l.resize(-listEntrySize(s))
+	return s
+}
+
+func (l *ListValue) popHead() string {
+	return l.removeEntry(l.head, 0)
+}
+
+func (l *ListValue) popTail() string {
+	return l.removeEntry(l.tail, len(l.tail.entries)-1)
+}
+
+// locate returns the node holding the element at index and its offset in
+// the node, walking from the nearest end. index must be in range.
+func (l *ListValue) locate(index int) (*listNode, int) {
+	if index < l.count/2 {
+		n := l.head
+		for index >= len(n.entries) {
+			index -= len(n.entries)
+			n = n.next
+		}
+		return n, index
+	}
+	n := l.tail
+	index = l.count - 1 - index
+	for index >= len(n.entries) {
+		index -= len(n.entries)
+		n = n.prev
+	}
+	return n, len(n.entries) - 1 - index
+}
+
+func (l *ListValue) get(index int) string {
+	n, i := l.locate(index)
+	return n.entries[i]
+}
+
+func (l *ListValue) set(index int, s string) {
+	n, i := l.locate(index)
+	delta := listEntrySize(s) - listEntrySize(n.entries[i])
+	n.entries[i] = s
+	n.size += delta
+	l.resize(delta)
+}
+
+// insert adds s so that it ends up at index, splitting a full node.
+func (l *ListValue) insert(index int, s string) {
+	switch index {
+	case 0:
+		l.pushHead(s)
+		return
+	case l.count:
+		l.pushTail(s)
+		return
+	}
+	n, i := l.locate(index)
+	if n.full(s) {
+		// move the second half to a new node
+		half := len(n.entries) / 2
+		next := l.linkAfter(n)
+		next.entries = append(next.entries, n.entries[half:]...)
+		clear(n.entries[half:])
+		n.entries = n.entries[:half]
+		for _, e := range next.entries {
+			n.size -= listEntrySize(e)
+			next.size += listEntrySize(e)
+		}
+		if i >= half {
+			n, i = next, i-half
+		}
+	}
+	n.entries = append(n.entries, "")
+	copy(n.entries[i+1:], n.entries[i:])
+	n.entries[i] = s
+	l.added(n, s)
+}
+
+// each calls fn with the index and value of each element, from the tail
+// when reverse is set, until fn returns false.
+func (l *ListValue) each(reverse bool, fn func(int, string) bool) {
+	if !reverse {
+		idx := 0
+		for n := l.head; n != nil; n = n.next {
+			for _, s := range n.entries {
+				if !fn(idx, s) {
+					return
+				}
+				idx++
+			}
+		}
+		return
+	}
+	idx := l.count - 1
+	for n := l.tail; n != nil; n = n.prev {
+		for i := len(n.entries) - 1; i >= 0; i-- {
+			if !fn(idx, n.entries[i]) {
+				return
+			}
+			idx--
+		}
+	}
+}
+
+// slice returns a copy of the elements between start and stop, inclusive
+// and in range.
+func (l *ListValue) slice(start, stop int) []string {
+	res := make([]string, 0, stop-start+1)
+	n, i := l.locate(start)
+	for len(res) < cap(res) {
+		if i == len(n.entries) {
+			n, i = n.next, 0
+			continue
+		}
+		res = append(res, n.entries[i])
+		i++
+	}
+	return res
+}
+
+func (l *ListValue) clone() *ListValue {
+	c := &ListValue{count: l.count, size: l.size, quicklist: l.quicklist}
+	for n := l.head; n != nil; n = n.next {
+		cn := c.linkAfter(c.tail)
+		cn.entries = append([]string(nil), n.entries...)
+		cn.size = n.size
+	}
+	return c
+}
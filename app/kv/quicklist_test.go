@@ -0,0 +1,188 @@
+package kv
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checkList verifies the links, counts and sizes of l against want.
+func checkList(t *testing.T, l *ListValue, want []string) {
+	t.Helper()
+	var got []string
+	count, size := 0, 0
+	var prev *listNode
+	for n := l.head; n != nil; n = n.next {
+		if n.prev != prev {
+			t.Fatalf("node prev link broken")
+		}
+		if len(n.entries) == 0 {
+			t.Fatalf("empty node kept in the list")
+		}
+		if len(n.entries) > listNodeMaxEntries {
+			t.Fatalf("node holds %d entries", len(n.entries))
+		}
+		nodeSize := 0
+		for _, s := range n.entries {
+			nodeSize += listEntrySize(s)
+		}
+		if nodeSize != n.size {
+			t.Fatalf("node size = %d, entries take %d", n.size, nodeSize)
+		}
+		got = append(got, n.entries...)
+		count += len(n.entries)
+		size += n.size
+		prev = n
+	}
+	if l.tail != prev {
+		t.Fatalf("tail is not the last node")
+	}
+	if count != l.count || size != l.size {
+		t.Fatalf("list count, size = %d, %d, nodes hold %d, %d", l.count, l.size, count, size)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("list = %q, want %q", got, want)
+	}
+}
+
+// The quicklist behaves like a slice under a random mix of operations.
+func TestQuicklistModel(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	l := NewListValue()
+	var model []string
+	value := func() string {
+		return strings.Repeat("x", rng.Intn(100))
+	}
+	for i := range 20000 {
+		s := value() + string(rune('a'+i%26))
+		switch op := rng.Intn(10); {
+		case op < 3:
+			l.pushHead(s)
+			model = slices.Insert(model, 0, s)
+		case op < 6:
+			l.pushTail(s)
+			model = append(model, s)
+		case op == 6 && len(model) > 0:
+			if got := l.popHead(); got != model[0] {
+				t.Fatalf("popHead = %q, want %q", got, model[0])
+			}
+			model = model[1:]
+		case op == 7 && len(model) > 0:
+			if got := l.popTail(); got != model[len(model)-1] {
+				t.Fatalf("popTail = %q, want %q", got, model[len(model)-1])
+			}
+			model = model[:len(model)-1]
+		case op == 8:
+			idx := rng.Intn(len(model) + 1)
+			l.insert(idx, s)
+			model = slices.Insert(model, idx, s)
+		case op == 9 && len(model) > 0:
+			idx := rng.Intn(len(model))
+			if got := l.get(idx); got != model[idx] {
+				t.Fatalf("get(%d) = %q, want %q", idx, got, model[idx])
+			}
+			l.set(idx, s)
+			model[idx] = s
+		}
+		if i%500 == 0 {
+			checkList(t, l, model)
+		}
+	}
+	checkList(t, l, model)
+
+	if len(model) > 10 {
+		if got := l.slice(3, len(model)-4); !slices.Equal(got, model[3:len(model)-3]) {
+			t.Errorf("slice differs from the model")
+		}
+	}
+	var reversed []string
+	l.each(true, func(i int, s string) bool {
+		if s != model[i] {
+			t.Fatalf("each(reverse) gave %q at %d, want %q", s, i, model[i])
+		}
+		reversed = append(reversed, s)
+		return true
+	})
+	if len(reversed) != len(model) {
+		t.Errorf("each(reverse) visited %d elements, want %d", len(reversed), len(model))
+	}
+}
+
+// Popped elements release their nodes, a drained queue keeps none.
+func TestQuicklistReleasesNodes(t *testing.T) {
+	l := NewListValue()
+	for range 10 * listNodeMaxEntries {
+		l.pushTail("job")
+	}
+	nodes := 0
+	for n := l.head; n != nil; n = n.next {
+		nodes++
+	}
+	if nodes != 10 {
+		t.Errorf("%d small entries fill %d nodes, want 10", 10*listNodeMaxEntries, nodes)
+	}
+	for range 10*listNodeMaxEntries - 1 {
+		l.popHead()
+	}
+	if l.head != l.tail || len(l.head.entries) != 1 {
+		t.Errorf("nodes left after draining the queue")
+	}
+	l.popHead()
+	if l.head != nil || l.tail != nil || l.Len() != 0 {
+		t.Errorf("empty list still holds nodes")
+	}
+	checkList(t, l, nil)
+
+	// big entries fill a node by size before count
+	big := strings.Repeat("x", listNodeMaxBytes/4)
+	for range 8 {
+		l.pushHead(big)
+	}
+	if len(l.head.entries) >= 4 {
+		t.Errorf("node of %d bytes holds %d entries of %d bytes", listNodeMaxBytes, len(l.head.entries), len(big))
+	}
+}
+
+func TestQuicklistEncoding(t *testing.T) {
+	l := NewListValue()
+	if got := l.Encoding(); got != "listpack" {
+		t.Fatalf("empty list encoding = %s", got)
+	}
+	elem := strings.Repeat("x", 100)
+	for l.Encoding() == "listpack" {
+		l.pushTail(elem)
+	}
+	n := l.Len()
+	if listpackHdrSize+l.size <= listMaxListpackBytes {
+		t.Errorf("converted at %d bytes", listpackHdrSize+l.size)
+	}
+
+	// one pop doesn't convert back, shrinking to half does
+	l.popTail()
+	if got := l.Encoding(); got != "quicklist" {
+		t.Errorf("encoding after one pop = %s, want quicklist", got)
+	}
+	for l.Len() > n/2-1 {
+		l.popTail()
+	}
+	if got := l.Encoding(); got != "listpack" {
+		t.Errorf("encoding at %d of %d elements = %s, want listpack", l.Len(), n, got)
+	}
+
+	// a single big element converts it right away
+	l.set(0, strings.Repeat("x", listMaxListpackBytes))
+	if got := l.Encoding(); got != "quicklist" {
+		t.Errorf("encoding after LSET of a big element = %s, want quicklist", got)
+	}
+}
+
+func TestQuicklistClone(t *testing.T) {
+	l := NewListValueFrom(numbers(300))
+	c := l.clone()
+	l.set(0, "changed")
+	l.popTail()
+	c.pushHead("new")
+	checkList(t, l, append([]string{"changed"}, numbers(300)[1:299]...))
+	checkList(t, c, append([]string{"new"}, numbers(300)...))
+}
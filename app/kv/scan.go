@@ -0,0 +1,195 @@
+package kv
+
+import (
+	"hash/maphash"
+	"math/rand"
+	"sync"
+)
+
+const minIndexBuckets = 4
+
+// keyIndex is a bucketed hash index of the keyspace, used for SCAN and
+// RANDOMKEY. sync.Map has no stable iteration order, so the index mirrors
+// Redis's dict: keys are spread over a power-of-two number of buckets and
+// SCAN walks the buckets with a reverse-binary cursor, which keeps the
+// cursor valid while the table is resized between calls.
+type keyIndex struct {
+	mu      sync.Mutex
+	seed    maphash.Seed
+	buckets []map[string]struct{}
+	count   int
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		seed:    maphash.MakeSeed(),
+		buckets: makeBuckets(minIndexBuckets),
+	}
+}
+
+func makeBuckets(n int) []map[string]struct{} {
+	buckets := make([]map[string]struct{}, n)
+	for i := range buckets {
+		buckets[i] = make(map[string]struct{})
+	}
+	return buckets
+}
+
+func (idx *keyIndex) bucketOf(key string, n int) int {
+	return int(maphash.String(idx.seed, key) & uint64(n-1))
+}
+
+func (idx *keyIndex) add(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	b := idx.buckets[idx.bucketOf(key, len(idx.buckets))]
+	if _, ok := b[key]; ok {
+		return
+	}
+	b[key] = struct{}{}
+	idx.count++
+	if idx.count > len(idx.buckets) {
+		idx.resize(len(idx.buckets) * 2)
+	}
+}
+
+func (idx *keyIndex) remove(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	b := idx.buckets[idx.bucketOf(key, len(idx.buckets))]
+	if _, ok := b[key]; !ok {
+		return
+	}
+	delete(b, key)
+	idx.count--
+	if len(idx.buckets) > minIndexBuckets && idx.count < len(idx.buckets)/8 {
+		idx.resize(len(idx.buckets) / 2)
+	}
+}
+
+func (idx *keyIndex) resize(n int) {
+	buckets := makeBuckets(n)
+	for _, b := range idx.buckets {
+		for key := range b {
+			buckets[idx.bucketOf(key, n)][key] = struct{}{}
+		}
+	}
+	idx.buckets = buckets
+}
+
+func (idx *keyIndex) reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.buckets = makeBuckets(minIndexBuckets)
+	idx.count = 0
+}
+
+func (idx *keyIndex) size() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.count
+}
+
+// scan appends the keys of the bucket at cursor to keys and returns the
+// next cursor, 0 when the iteration is complete.
+func (idx *keyIndex) scan(cursor uint64, keys []string) ([]string, uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	mask := uint64(len(idx.buckets) - 1)
+	for key := range idx.buckets[cursor&mask] {
+		keys = append(keys, key)
+	}
+	return keys, nextCursor(cursor, mask)
+}
+
+// random returns a random key, or false when the index is empty.
+func (idx *keyIndex) random() (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.count == 0 {
+		return "", false
+	}
+	for {
+		b := idx.buckets[rand.Intn(len(idx.buckets))]
+		if len(b) == 0 {
+			continue
+		}
+		i := rand.Intn(len(b))
+		for key := range b {
+			if i == 0 {
+				return key, true
+			}
+			i--
+		}
+	}
+}
+
+// Scan returns the keys found by one step of a cursor based iteration,
+// filtered by pattern (empty for all) and type name (empty for any).
+func (kv *KVStore) Scan(cursor uint64, count int, pattern, typeName string) (uint64, []string) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+
+	keys := []string{}
+	maxIterations := count * 10
+	for {
+		keys, cursor = kv.index.scan(cursor, keys)
+		maxIterations--
+		if cursor == 0 || maxIterations <= 0 || len(keys) >= count {
+			break
+		}
+	}
+
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if pattern != "" && !MatchPattern(pattern, key, false) {
+			continue
+		}
+		val, ok := kv.load(key)
+		if !ok {
+			continue
+		}
+		if typeName != "" && typeNames[val.t] != typeName {
+			continue
+		}
+		res = append(res, key)
+	}
+	return cursor, res
+}
+
+// scanDict runs one step of HSCAN, SSCAN or ZSCAN over d, calling fn
+// for each entry of the buckets visited. Like Scan, it stops once count
+// entries were seen or after count*10 buckets.
+func scanDict[V any](d *dict[V], cursor uint64, count int, fn func(key string, val V)) uint64 {
+	seen := 0
+	maxIterations := count * 10
+	for {
+		cursor = d.scan(cursor, func(key string, val V) {
+			seen++
+			fn(key, val)
+		})
+		maxIterations--
+		if cursor == 0 || maxIterations <= 0 || seen >= count {
+			return cursor
+		}
+	}
+}
+
+// ZScan returns the members and scores, as a flat list, found by one
+// step of a cursor based iteration over the sorted set.
+func (kv *KVStore) ZScan(key string, cursor uint64, count int, pattern string) (uint64, []string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return 0, []string{}, err
+	}
+	res := []string{}
+	cursor = scanDict(zSet.memToScore, cursor, count, func(member string, score float64) {
+		if pattern == "" || MatchPattern(pattern, member, false) {
+			res = append(res, member, formatScore(score))
+		}
+	})
+	return cursor, res, nil
+}
@@ -0,0 +1,128 @@
+package kv
+
+import (
+	"strconv"
+	"testing"
+)
+
+// scanAll runs a full SCAN iteration, calling between after each step.
+func scanAll(kv *KVStore, count int, pattern, typeName string, between func()) map[string]int {
+	seen := map[string]int{}
+	cursor := uint64(0)
+	for {
+		var keys []string
+		cursor, keys = kv.Scan(cursor, count, pattern, typeName)
+		for _, key := range keys {
+			seen[key]++
+		}
+		if cursor == 0 {
+			return seen
+		}
+		between()
+	}
+}
+
+func TestScan(t *testing.T) {
+	kv := NewKVStore()
+	for i := range 1000 {
+		kv.Set("key:"+strconv.Itoa(i), "v")
+	}
+	kv.SAdd("set:1", []string{"a"})
+
+	seen := scanAll(kv, 10, "", "", func() {})
+	if len(seen) != 1001 {
+		t.Errorf("SCAN returned %d keys, want 1001", len(seen))
+	}
+	if seen := scanAll(kv, 10, "key:1*", "", func() {}); len(seen) != 111 {
+		t.Errorf("SCAN MATCH key:1* returned %d keys, want 111", len(seen))
+	}
+	if seen := scanAll(kv, 10, "", "set", func() {}); len(seen) != 1 || seen["set:1"] != 1 {
+		t.Errorf("SCAN TYPE set returned %v", seen)
+	}
+}
+
+// Keys present during the whole iteration are returned even when the
+// index grows or shrinks between two calls.
+func TestScanResize(t *testing.T) {
+	for _, grow := range []bool{true, false} {
+		kv := NewKVStore()
+		for i := range 500 {
+			kv.Set("stable:"+strconv.Itoa(i), "v")
+		}
+		if !grow {
+			for i := range 5000 {
+				kv.Set("tmp:"+strconv.Itoa(i), "v")
+			}
+		}
+		next := 0
+		seen := scanAll(kv, 20, "stable:*", "", func() {
+			// 200 changes per step, until 10 times the stable keys
+			for end := min(next+200, 5000); next < end; next++ {
+				if grow {
+					kv.Set("tmp:"+strconv.Itoa(next), "v")
+				} else {
+					kv.Del("tmp:" + strconv.Itoa(next))
+				}
+			}
+		})
+		for i := range 500 {
+			if seen["stable:"+strconv.Itoa(i)] == 0 {
+				t.Errorf("grow=%v: SCAN missed stable:%d", grow, i)
+			}
+		}
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	// with 8 buckets the cursor visits them in reverse binary order
+	want := []uint64{4, 2, 6, 1, 5, 3, 7, 0}
+	cursor := uint64(0)
+	for _, w := range want {
+		cursor = nextCursor(cursor, 7)
+		if cursor != w {
+			t.Fatalf("nextCursor = %d, want %d", cursor, w)
+		}
+	}
+}
+
+func TestZScan(t *testing.T) {
+	kv := NewKVStore()
+	for i := range 1000 {
+		kv.ZAdd("z", "m"+strconv.Itoa(i), float64(i))
+	}
+	seen := map[string]string{}
+	cursor, calls := uint64(0), 0
+	for {
+		var res []string
+		var err error
+		cursor, res, err = kv.ZScan("z", cursor, 50, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(res); i += 2 {
+			seen[res[i]] = res[i+1]
+		}
+		calls++
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 1000 || seen["m42"] != "42" {
+		t.Errorf("ZSCAN returned %d members, m42 = %q", len(seen), seen["m42"])
+	}
+	if calls < 10 {
+		t.Errorf("ZSCAN COUNT 50 over 1000 members finished in %d calls", calls)
+	}
+
+	cursor, res, _ := kv.ZScan("z", 0, 10000, "m99*")
+	if cursor != 0 || len(res) != 2*11 {
+		t.Errorf("ZSCAN MATCH m99* = %d, %d items, want 0, 22", cursor, len(res))
+	}
+	if cursor, res, err := kv.ZScan("missing", 0, 10, ""); cursor != 0 || len(res) != 0 || err != nil {
+		t.Errorf("ZSCAN of a missing key = %d, %v, %v", cursor, res, err)
+	}
+	kv.Set("str", "v")
+	if _, _, err := kv.ZScan("str", 0, 10, ""); err != ErrWrongType {
+		t.Errorf("ZSCAN of a string error = %v, want ErrWrongType", err)
+	}
+}
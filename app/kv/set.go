@@ -0,0 +1,449 @@
+package kv
+
+import (
+	"iter"
+	"slices"
+	"strconv"
+)
+
+// Max number of members of a set kept in the intset encoding.
+const setMaxIntsetEntries = 512
+
+// SetValue holds small all-integer sets as a sorted []int64 (the intset
+// encoding, like Redis) and switches to a hash table as soon as a
+// non-integer member is added or the set grows past setMaxIntsetEntries.
+type SetValue struct {
+	intset []int64         // sorted members, used while dict is nil
+	dict   *dict[struct{}] // hash table encoding
+}
+
+func NewSetValue() SetValue {
+	return SetValue{intset: []int64{}}
+}
+
+func (set *SetValue) isIntset() bool {
+	return set.dict == nil
+}
+
+func (set *SetValue) Encoding() string {
+	if set.isIntset() {
+		return "intset"
+	}
+	return "hashtable"
+}
+
+// convert switches an intset to the hash table encoding.
+func (set *SetValue) convert() {
+	set.dict = newDict[struct{}]()
+	for _, v := range set.intset {
+		set.dict.set(strconv.FormatInt(v, 10), struct{}{})
+	}
+	set.intset = nil
+}
+
+// add inserts member and returns whether it was not already present.
+func (set *SetValue) add(member string) bool {
+	if set.isIntset() {
+		if v, ok := parseInt(member); ok {
+			pos, found := slices.BinarySearch(set.intset, v)
+			if found {
+				return false
+			}
+			if len(set.intset) < setMaxIntsetEntries {
+				set.intset = slices.Insert(set.intset, pos, v)
+				return true
+			}
+		}
+		set.convert()
+	}
+	return set.dict.set(member, struct{}{})
+}
+
+// remove deletes member and returns whether it was present.
+func (set *SetValue) remove(member string) bool {
+	if set.isIntset() {
+		v, ok := parseInt(member)
+		if !ok {
+			return false
+		}
+		pos, found := slices.BinarySearch(set.intset, v)
+		if !found {
+			return false
+		}
+		set.intset = slices.Delete(set.intset, pos, pos+1)
+		return true
+	}
+	return set.dict.delete(member)
+}
+
+func (set *SetValue) has(member string) bool {
+	if set.isIntset() {
+		v, ok := parseInt(member)
+		if !ok {
+			return false
+		}
+		_, found := slices.BinarySearch(set.intset, v)
+		return found
+	}
+	return set.dict.has(member)
+}
+
+func (set *SetValue) card() int {
+	if set.isIntset() {
+		return len(set.intset)
+	}
+	return set.dict.len()
+}
+
+func (set *SetValue) members() []string {
+	res := make([]string, 0, set.card())
+	for member := range set.all() {
+		res = append(res, member)
+	}
+	return res
+}
+
+// all iterates over the members, without listing them first.
+func (set *SetValue) all() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		if set.isIntset() {
+			for _, v := range set.intset {
+				if !yield(strconv.FormatInt(v, 10)) {
+					return
+				}
+			}
+			return
+		}
+		for member := range set.dict.all() {
+			if !yield(member) {
+				return
+			}
+		}
+	}
+}
+
+// sample returns random members, count of them following the rules of
+// sampleIndexes.
+func (set *SetValue) sample(count int) []string {
+	res := []string{}
+	if set.card() == 0 {
+		return res
+	}
+	if set.isIntset() {
+		for _, i := range sampleIndexes(len(set.intset), count) {
+			res = append(res, strconv.FormatInt(set.intset[i], 10))
+		}
+		return res
+	}
+	for _, e := range set.dict.sample(count) {
+		res = append(res, e.key)
+	}
+	return res
+}
+
+func (set *SetValue) clone() SetValue {
+	if set.isIntset() {
+		return SetValue{intset: slices.Clone(set.intset)}
+	}
+	return SetValue{dict: set.dict.clone()}
+}
+
+// NewSetValueFrom builds a set from members, picking the encoding.
+func NewSetValueFrom(members []string) SetValue {
+	set := NewSetValue()
+	for _, member := range members {
+		set.add(member)
+	}
+	return set
+}
+
+func (kv *KVStore) getSet(key string) (SetValue, bool, error) {
+	val, ok, err := kv.lookup(key, SetType)
+	if !ok {
+		return SetValue{}, false, err
+	}
+	return val.v.(SetValue), true, nil
+}
+
+// storeSet stores set at key, or deletes the key when the set is empty.
+func (kv *KVStore) storeSet(key string, set SetValue) {
+	if set.card() == 0 {
+		kv.delete(key)
+		return
+	}
+	kv.store(key, set, SetType)
+}
+
+// SAdd adds members and returns how many were not already in the set.
+func (kv *KVStore) SAdd(key string, members []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	set, ok, err := kv.getSet(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		set = NewSetValue()
+	}
+	added := 0
+	for _, member := range members {
+		if set.add(member) {
+			added++
+		}
+	}
+	kv.storeSet(key, set)
+	return added, nil
+}
+
+// SRem removes members and returns how many were removed.
+func (kv *KVStore) SRem(key string, members []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	set, ok, err := kv.getSet(key)
+	if !ok {
+		return 0, err
+	}
+	removed := 0
+	for _, member := range members {
+		if set.remove(member) {
+			removed++
+		}
+	}
+	kv.storeSet(key, set)
+	return removed, nil
+}
+
+func (kv *KVStore) SMembers(key string) ([]string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	set, ok, err := kv.getSet(key)
+	if !ok {
+		return []string{}, err
+	}
+	return set.members(), nil
+}
+
+// SIsMember returns 1 or 0 for each member.
+func (kv *KVStore) SIsMember(key string, members []string) ([]int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	set, ok, err := kv.getSet(key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]int, len(members))
+	for i, member := range members {
+		if ok && set.has(member) {
+			res[i] = 1
+		}
+	}
+	return res, nil
+}
+
+func (kv *KVStore) SCard(key string) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	set, ok, err := kv.getSet(key)
+	if !ok {
+		return 0, err
+	}
+	return set.card(), nil
+}
+
+// SPop removes and returns up to count random members.
+func (kv *KVStore) SPop(key string, count int) ([]string, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	set, ok, err := kv.getSet(key)
+	if !ok {
+		return []string{}, err
+	}
+	members := set.sample(count)
+	for _, member := range members {
+		set.remove(member)
+	}
+	kv.storeSet(key, set)
+	return members, nil
+}
+
+// SRandMember returns random members without removing them. A positive
+// count returns distinct members, a negative count may repeat members.
+func (kv *KVStore) SRandMember(key string, count int) ([]string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	set, ok, err := kv.getSet(key)
+	if !ok {
+		return []string{}, err
+	}
+	return set.sample(count), nil
+}
+
+// SMove moves member from src to dst. Returns 1 if it was moved.
+func (kv *KVStore) SMove(src, dst, member string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	srcSet, ok, err := kv.getSet(src)
+	if err != nil {
+		return 0, err
+	}
+	dstSet, dstOk, err := kv.getSet(dst)
+	if err != nil {
+		return 0, err
+	}
+	if !ok || !srcSet.has(member) {
+		return 0, nil
+	}
+	if src == dst {
+		return 1, nil
+	}
+	if !dstOk {
+		dstSet = NewSetValue()
+	}
+	srcSet.remove(member)
+	dstSet.add(member)
+	kv.storeSet(src, srcSet)
+	kv.storeSet(dst, dstSet)
+	return 1, nil
+}
+
+// Set algebra operations
+type SetOp int
+
+const (
+	SetUnion SetOp = iota
+	SetInter
+	SetDiff
+)
+
+// setAlgebra computes the union, intersection or difference of the sets
+// at keys. Missing keys count as empty sets. The intersection stops once
+// it has limit members (0 means no limit).
+func (kv *KVStore) setAlgebra(op SetOp, keys []string, limit int) ([]string, error) {
+	sets := make([]SetValue, len(keys))
+	exists := make([]bool, len(keys))
+	for i, key := range keys {
+		set, ok, err := kv.getSet(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i], exists[i] = set, ok
+	}
+
+	switch op {
+	case SetUnion:
+		res := NewSetValue()
+		for i := range sets {
+			if exists[i] {
+				for _, member := range sets[i].members() {
+					res.add(member)
+				}
+			}
+		}
+		return res.members(), nil
+	case SetInter:
+		if slices.Contains(exists, false) {
+			return []string{}, nil
+		}
+		// iterate the smallest set, probe the others
+		smallest := 0
+		for i := range sets {
+			if sets[i].card() < sets[smallest].card() {
+				smallest = i
+			}
+		}
+		res := []string{}
+		for member := range sets[smallest].all() {
+			inAll := true
+			for i := range sets {
+				if i != smallest && !sets[i].has(member) {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				res = append(res, member)
+				if len(res) == limit {
+					break
+				}
+			}
+		}
+		return res, nil
+	default: // SetDiff
+		if !exists[0] {
+			return []string{}, nil
+		}
+		res := []string{}
+		for _, member := range sets[0].members() {
+			inOther := false
+			for i := 1; i < len(sets); i++ {
+				if exists[i] && sets[i].has(member) {
+					inOther = true
+					break
+				}
+			}
+			if !inOther {
+				res = append(res, member)
+			}
+		}
+		return res, nil
+	}
+}
+
+// SOp returns the result of SUNION, SINTER or SDIFF.
+func (kv *KVStore) SOp(op SetOp, keys []string) ([]string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	return kv.setAlgebra(op, keys, 0)
+}
+
+// SOpStore stores the result of the operation in dst, overwriting it,
+// and returns the cardinality of the result.
+func (kv *KVStore) SOpStore(op SetOp, dst string, keys []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	members, err := kv.setAlgebra(op, keys, 0)
+	if err != nil {
+		return 0, err
+	}
+	kv.delete(dst)
+	kv.storeSet(dst, NewSetValueFrom(members))
+	return len(members), nil
+}
+
+// SInterCard returns the cardinality of the intersection, stopping early
+// once limit is reached (0 means no limit).
+func (kv *KVStore) SInterCard(keys []string, limit int) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	members, err := kv.setAlgebra(SetInter, keys, limit)
+	if err != nil {
+		return 0, err
+	}
+	return len(members), nil
+}
+
+// SScan returns the members found by one step of a cursor based
+// iteration over the set. Like Redis does for the intset encoding, a
+// small set of integers is returned whole in a single step.
+func (kv *KVStore) SScan(key string, cursor uint64, count int, pattern string) (uint64, []string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	set, ok, err := kv.getSet(key)
+	if !ok {
+		return 0, []string{}, err
+	}
+	res := []string{}
+	match := func(member string, _ struct{}) {
+		if pattern == "" || MatchPattern(pattern, member, false) {
+			res = append(res, member)
+		}
+	}
+	if set.isIntset() {
+		for _, member := range set.members() {
+			match(member, struct{}{})
+		}
+		return 0, res, nil
+	}
+	cursor = scanDict(set.dict, cursor, count, match)
+	return cursor, res, nil
+}
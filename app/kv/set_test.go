@@ -0,0 +1,199 @@
+package kv
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestSetEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []string
+		want    string
+	}{
+		{"integers", []string{"1", "-5", "300"}, "intset"},
+		{"non canonical integer", []string{"1", "01"}, "hashtable"},
+		{"string", []string{"1", "a"}, "hashtable"},
+		{"too many integers", numbers(setMaxIntsetEntries + 1), "hashtable"},
+		{"max integers", numbers(setMaxIntsetEntries), "intset"},
+	}
+	for _, tt := range tests {
+		set := NewSetValueFrom(tt.members)
+		if got := set.Encoding(); got != tt.want {
+			t.Errorf("%s: encoding = %s, want %s", tt.name, got, tt.want)
+		}
+		if set.card() != len(tt.members) {
+			t.Errorf("%s: card = %d, want %d", tt.name, set.card(), len(tt.members))
+		}
+		for _, member := range tt.members {
+			if !set.has(member) {
+				t.Errorf("%s: member %s missing", tt.name, member)
+			}
+		}
+	}
+
+	set := NewSetValueFrom([]string{"3", "1", "2"})
+	if got := set.members(); !slices.Equal(got, []string{"1", "2", "3"}) {
+		t.Errorf("intset members = %v, want them sorted", got)
+	}
+	if set.has("a") || set.remove("a") || set.add("2") {
+		t.Error("non members of an intset were found")
+	}
+}
+
+func numbers(n int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = strconv.Itoa(i)
+	}
+	return res
+}
+
+func TestSetCommands(t *testing.T) {
+	kv := NewKVStore()
+	if n, _ := kv.SAdd("s", []string{"a", "b", "a"}); n != 2 {
+		t.Errorf("SAdd = %d, want 2", n)
+	}
+	if got, _ := kv.SIsMember("s", []string{"a", "c"}); !slices.Equal(got, []int{1, 0}) {
+		t.Errorf("SIsMember = %v", got)
+	}
+	if n, _ := kv.SMove("s", "d", "a"); n != 1 {
+		t.Errorf("SMove = %d, want 1", n)
+	}
+	if n, _ := kv.SMove("s", "d", "a"); n != 0 {
+		t.Errorf("SMove of a moved member = %d, want 0", n)
+	}
+	if n, _ := kv.SRem("s", []string{"b", "x"}); n != 1 {
+		t.Errorf("SRem = %d, want 1", n)
+	}
+	if kv.Exists("s") != 0 {
+		t.Error("an empty set was kept")
+	}
+	kv.Set("str", "v")
+	if _, err := kv.SAdd("str", []string{"a"}); err != ErrWrongType {
+		t.Errorf("SAdd on a string error = %v, want ErrWrongType", err)
+	}
+	if _, err := kv.SMove("s", "str", "a"); err != ErrWrongType {
+		t.Errorf("SMove to a string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	kv := NewKVStore()
+	kv.SAdd("a", []string{"1", "2", "3", "x"})
+	kv.SAdd("b", []string{"2", "3", "4"})
+	kv.SAdd("c", []string{"3", "x"})
+	tests := []struct {
+		op   SetOp
+		keys []string
+		want []string
+	}{
+		{SetUnion, []string{"a", "b"}, []string{"1", "2", "3", "4", "x"}},
+		{SetUnion, []string{"missing", "c"}, []string{"3", "x"}},
+		{SetInter, []string{"a", "b"}, []string{"2", "3"}},
+		{SetInter, []string{"a", "b", "c"}, []string{"3"}},
+		{SetInter, []string{"a", "missing"}, []string{}},
+		{SetDiff, []string{"a", "b"}, []string{"1", "x"}},
+		{SetDiff, []string{"a", "b", "c"}, []string{"1"}},
+		{SetDiff, []string{"a", "missing"}, []string{"1", "2", "3", "x"}},
+		{SetDiff, []string{"missing", "a"}, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := kv.SOp(tt.op, tt.keys)
+		slices.Sort(got)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("SOp(%d, %v) = %v, %v, want %v", tt.op, tt.keys, got, err, tt.want)
+		}
+	}
+
+	if n, _ := kv.SOpStore(SetInter, "a", []string{"a", "b"}); n != 2 {
+		t.Errorf("SOpStore into a source = %d, want 2", n)
+	}
+	if n, _ := kv.SOpStore(SetInter, "dst", []string{"a", "missing"}); n != 0 || kv.Exists("dst") != 0 {
+		t.Error("SOpStore of an empty result should not create the key")
+	}
+	kv.Set("str", "v")
+	if _, err := kv.SOp(SetUnion, []string{"a", "str"}); err != ErrWrongType {
+		t.Errorf("SOp with a string error = %v, want ErrWrongType", err)
+	}
+}
+
+func TestSInterCard(t *testing.T) {
+	kv := NewKVStore()
+	kv.SAdd("a", numbers(1000))
+	kv.SAdd("b", numbers(600))
+	for _, tt := range []struct{ limit, want int }{{0, 600}, {10, 10}, {600, 600}, {5000, 600}} {
+		if got, _ := kv.SInterCard([]string{"a", "b"}, tt.limit); got != tt.want {
+			t.Errorf("SInterCard LIMIT %d = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSPopSRandMember(t *testing.T) {
+	kv := NewKVStore()
+	for _, members := range [][]string{numbers(100), append(numbers(100), "a")} {
+		kv.Del("s")
+		kv.SAdd("s", members)
+		n := len(members)
+
+		got, _ := kv.SRandMember("s", 10)
+		if len(got) != 10 || len(distinct(got)) != 10 {
+			t.Errorf("SRandMember(10) = %v", got)
+		}
+		if got, _ := kv.SRandMember("s", 1000); len(got) != n {
+			t.Errorf("SRandMember(1000) returned %d members, want %d", len(got), n)
+		}
+		if got, _ := kv.SRandMember("s", -300); len(got) != 300 {
+			t.Errorf("SRandMember(-300) returned %d members", len(got))
+		}
+
+		popped, _ := kv.SPop("s", 30)
+		for _, member := range popped {
+			if in, _ := kv.SIsMember("s", []string{member}); in[0] != 0 {
+				t.Errorf("SPop left %s in the set", member)
+			}
+		}
+		if card, _ := kv.SCard("s"); len(distinct(popped)) != 30 || card != n-30 {
+			t.Errorf("SPop(30) popped %d distinct members, card = %d", len(distinct(popped)), card)
+		}
+		if popped, _ := kv.SPop("s", 1000); len(popped) != n-30 || kv.Exists("s") != 0 {
+			t.Errorf("SPop(1000) popped %d members, want the remaining %d", len(popped), n-30)
+		}
+	}
+}
+
+func distinct(l []string) map[string]bool {
+	res := map[string]bool{}
+	for _, s := range l {
+		res[s] = true
+	}
+	return res
+}
+
+func TestSScan(t *testing.T) {
+	kv := NewKVStore()
+	kv.SAdd("small", []string{"1", "2", "3"})
+	if cursor, res, _ := kv.SScan("small", 0, 1, ""); cursor != 0 || len(res) != 3 {
+		t.Errorf("SSCAN of an intset = %d, %v, want it whole", cursor, res)
+	}
+
+	members := append(numbers(1000), "a")
+	kv.SAdd("big", members)
+	seen := map[string]bool{}
+	cursor, calls := uint64(0), 0
+	for {
+		var res []string
+		cursor, res, _ = kv.SScan("big", cursor, 50, "")
+		for _, member := range res {
+			seen[member] = true
+		}
+		calls++
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != len(members) || calls < 10 {
+		t.Errorf("SSCAN returned %d members in %d calls, want %d", len(seen), calls, len(members))
+	}
+}
@@ -0,0 +1,246 @@
+package kv
+
+import "math/rand"
+
+// skiplist orders the members of a sorted set by score, then member. It
+// is a port of the Redis zskiplist: every forward link records its span,
+// the number of nodes it skips, so the rank of a node is summed on the way
+// down and lookups by rank are O(log n) as well.
+const (
+	zslMaxLevel = 32
+	zslP        = 0.25
+)
+
+type zslLevel struct {
+	forward *zslNode
+	span    int
+}
+
+type zslNode struct {
+	member   string
+	score    float64
+	backward *zslNode
+	level    []zslLevel
+}
+
+type skiplist struct {
+	header *zslNode
+	tail   *zslNode
+	length int
+	level  int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: &zslNode{level: make([]zslLevel, zslMaxLevel)},
+		level:  1,
+	}
+}
+
+func zslRandomLevel() int {
+	level := 1
+	for level < zslMaxLevel && rand.Float64() < zslP {
+		level++
+	}
+	return level
+}
+
+// before reports whether n sorts before the (score, member) pair.
+func (n *zslNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+func (n *zslNode) next() *zslNode {
+	return n.level[0].forward
+}
+
+func (zsl *skiplist) first() *zslNode {
+	return zsl.header.level[0].forward
+}
+
+// insert adds a member that is not in the skiplist yet.
+func (zsl *skiplist) insert(score float64, member string) *zslNode {
+	var (
+		update [zslMaxLevel]*zslNode
+		rank   [zslMaxLevel]int
+	)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &zslNode{member: member, score: score, level: make([]zslLevel, level)}
+	for i := range level {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	// untouched levels skip one more node now
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+// findUpdate returns, for each level, the last node before (score, member).
+func (zsl *skiplist) findUpdate(score float64, member string) [zslMaxLevel]*zslNode {
+	var update [zslMaxLevel]*zslNode
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return update
+}
+
+func (zsl *skiplist) deleteNode(x *zslNode, update *[zslMaxLevel]*zslNode) {
+	for i := range zsl.level {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// delete removes the node with the given score and member, if present.
+func (zsl *skiplist) delete(score float64, member string) bool {
+	update := zsl.findUpdate(score, member)
+	x := update[0].level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+	zsl.deleteNode(x, &update)
+	return true
+}
+
+// updateScore moves member from curScore to newScore. The node is updated
+// in place when it keeps its position.
+func (zsl *skiplist) updateScore(curScore float64, member string, newScore float64) *zslNode {
+	update := zsl.findUpdate(curScore, member)
+	x := update[0].level[0].forward
+	if (x.backward == nil || x.backward.score < newScore) &&
+		(x.level[0].forward == nil || x.level[0].forward.score > newScore) {
+		x.score = newScore
+		return x
+	}
+	zsl.deleteNode(x, &update)
+	return zsl.insert(newScore, member)
+}
+
+// rank returns the 1-based rank of the member, or 0 if it is missing.
+func (zsl *skiplist) rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.before(score, member) ||
+				(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node at the 1-based rank, or nil if out of range.
+func (zsl *skiplist) byRank(rank int) *zslNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstInRange returns the first node in r, or nil.
+func (zsl *skiplist) firstInRange(r zslRange) *zslNode {
+	if r.empty() {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.next()
+	if x == nil || !r.belowMax(x) {
+		return nil
+	}
+	return x
+}
+
+// lastInRange returns the last node in r, or nil.
+func (zsl *skiplist) lastInRange(r zslRange) *zslNode {
+	if r.empty() {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.belowMax(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+	if x == zsl.header || !r.aboveMin(x) {
+		return nil
+	}
+	return x
+}
+
+func (zsl *skiplist) clone() *skiplist {
+	c := newSkiplist()
+	for x := zsl.first(); x != nil; x = x.next() {
+		c.insert(x.score, x.member)
+	}
+	return c
+}
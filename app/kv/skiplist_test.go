@@ -0,0 +1,186 @@
+package kv
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+type zslEntry struct {
+	score  float64
+	member string
+}
+
+func compareEntries(a, b zslEntry) int {
+	return cmp.Or(cmp.Compare(a.score, b.score), cmp.Compare(a.member, b.member))
+}
+
+// checkSkiplist verifies the order, links and spans of zsl against want,
+// which is sorted.
+func checkSkiplist(t *testing.T, zsl *skiplist, want []zslEntry) {
+	t.Helper()
+	if zsl.length != len(want) {
+		t.Fatalf("length = %d, want %d", zsl.length, len(want))
+	}
+	rankOf := map[*zslNode]int{zsl.header: 0}
+	var prev *zslNode
+	i := 0
+	for x := zsl.first(); x != nil; x = x.next() {
+		if i >= len(want) {
+			t.Fatalf("more nodes than the %d wanted", len(want))
+		}
+		if x.score != want[i].score || x.member != want[i].member {
+			t.Fatalf("node %d = (%v, %s), want %v", i, x.score, x.member, want[i])
+		}
+		if x.backward != prev {
+			t.Fatalf("node %d backward link broken", i)
+		}
+		if len(x.level) > zsl.level {
+			t.Fatalf("node %d has %d levels, the list %d", i, len(x.level), zsl.level)
+		}
+		i++
+		rankOf[x] = i
+		prev = x
+	}
+	if zsl.tail != prev {
+		t.Fatalf("tail is not the last node")
+	}
+	if zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		t.Fatalf("level %d is empty", zsl.level)
+	}
+	// every link skips as many nodes as its span says
+	for x := zsl.header; x != nil; x = x.next() {
+		for lvl := 0; lvl < len(x.level) && lvl < zsl.level; lvl++ {
+			next := x.level[lvl].forward
+			if next != nil && x.level[lvl].span != rankOf[next]-rankOf[x] {
+				t.Fatalf("level %d span from rank %d = %d, want %d", lvl, rankOf[x], x.level[lvl].span, rankOf[next]-rankOf[x])
+			}
+		}
+	}
+}
+
+func TestSkiplistModel(t *testing.T) {
+	zsl := newSkiplist()
+	scores := map[string]float64{}
+	var model []zslEntry
+	rebuild := func() {
+		model = model[:0]
+		for member, score := range scores {
+			model = append(model, zslEntry{score, member})
+		}
+		slices.SortFunc(model, compareEntries)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := range 5000 {
+		member := strconv.Itoa(rng.Intn(500))
+		// few distinct scores, so members break many ties
+		score := float64(rng.Intn(50))
+		cur, ok := scores[member]
+		switch op := rng.Intn(3); {
+		case !ok:
+			zsl.insert(score, member)
+			scores[member] = score
+		case op == 0:
+			if !zsl.delete(cur, member) {
+				t.Fatalf("delete(%v, %s) = false", cur, member)
+			}
+			delete(scores, member)
+		default:
+			x := zsl.updateScore(cur, member, score)
+			if x.score != score || x.member != member {
+				t.Fatalf("updateScore returned (%v, %s)", x.score, x.member)
+			}
+			scores[member] = score
+		}
+		if i%250 == 0 {
+			rebuild()
+			checkSkiplist(t, zsl, model)
+		}
+	}
+	rebuild()
+	checkSkiplist(t, zsl, model)
+
+	for i, e := range model {
+		if got := zsl.rank(e.score, e.member); got != i+1 {
+			t.Fatalf("rank(%v) = %d, want %d", e, got, i+1)
+		}
+		if x := zsl.byRank(i + 1); x.member != e.member {
+			t.Fatalf("byRank(%d) = %s, want %s", i+1, x.member, e.member)
+		}
+	}
+	if zsl.byRank(len(model)+1) != nil {
+		t.Errorf("byRank past the end returned a node")
+	}
+	if zsl.rank(1000, "missing") != 0 || zsl.rank(model[0].score, "missing") != 0 {
+		t.Errorf("rank of a missing member is not 0")
+	}
+	if zsl.delete(model[0].score+0.5, model[0].member) {
+		t.Errorf("delete with the wrong score succeeded")
+	}
+}
+
+// updateScore keeps the node in place when the order doesn't change.
+func TestSkiplistUpdateInPlace(t *testing.T) {
+	zsl := newSkiplist()
+	a := zsl.insert(1, "a")
+	zsl.insert(3, "c")
+	if x := zsl.updateScore(1, "a", 2); x != a {
+		t.Errorf("update keeping the order moved the node")
+	}
+	if x := zsl.updateScore(2, "a", 4); x == a || zsl.tail != x {
+		t.Errorf("update past the next node did not move it to the tail")
+	}
+	checkSkiplist(t, zsl, []zslEntry{{3, "c"}, {4, "a"}})
+}
+
+func TestSkiplistInRange(t *testing.T) {
+	zsl := newSkiplist()
+	for i := range 100 {
+		zsl.insert(float64(i/2), strconv.Itoa(i))
+	}
+	tests := []struct {
+		r           ZScoreRange
+		first, last string // "" for nil
+	}{
+		{ZScoreRange{Min: 10, Max: 20}, "20", "41"},
+		{ZScoreRange{Min: 10, Max: 20, MinEx: true, MaxEx: true}, "22", "39"},
+		{ZScoreRange{Min: -5, Max: 0}, "0", "1"},
+		{ZScoreRange{Min: 49, Max: 100}, "98", "99"},
+		{ZScoreRange{Min: 10.2, Max: 10.8}, "", ""},
+		{ZScoreRange{Min: 60, Max: 70}, "", ""},
+		{ZScoreRange{Min: 20, Max: 10}, "", ""},
+		{ZScoreRange{Min: 10, Max: 10, MinEx: true}, "", ""},
+	}
+	name := func(x *zslNode) string {
+		if x == nil {
+			return ""
+		}
+		return x.member
+	}
+	for _, tt := range tests {
+		first, last := name(zsl.firstInRange(tt.r)), name(zsl.lastInRange(tt.r))
+		if first != tt.first || last != tt.last {
+			t.Errorf("range %+v = %q..%q, want %q..%q", tt.r, first, last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestSkiplistClone(t *testing.T) {
+	zsl := newSkiplist()
+	for i := range 50 {
+		zsl.insert(float64(i), strconv.Itoa(i))
+	}
+	c := zsl.clone()
+	zsl.delete(0, "0")
+	c.insert(-1, "new")
+
+	var want []zslEntry
+	for i := range 50 {
+		want = append(want, zslEntry{float64(i), strconv.Itoa(i)})
+	}
+	checkSkiplist(t, zsl, want[1:])
+	checkSkiplist(t, c, append([]zslEntry{{-1, "new"}}, want...))
+}
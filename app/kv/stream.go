@@ -2,6 +2,7 @@ package kv
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sort"
@@ -86,27 +87,42 @@ func parseIDString(str string, lastID any) (StreamID, error) {
 	return StreamID{Ms: ms, Seq: seq}, nil
 }
 
-func (kv *KVStore) XAdd(key string, idStr string, data map[string]string) (res string, t ValueType) {
+var (
+	ErrStreamIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+)
+
+func (kv *KVStore) getStream(key string) (StreamValue, bool, error) {
+	val, ok, err := kv.lookup(key, StreamType)
+	if !ok {
+		return StreamValue{}, false, err
+	}
+	return val.v.(StreamValue), true, nil
+}
+
+func (kv *KVStore) XAdd(key string, idStr string, data map[string]string) (string, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
 	var id StreamID
-	tarStreamAny, ok := kv.mp.Load(key)
-	var tarStream StreamValue
+	tarStream, ok, err := kv.getStream(key)
+	if err != nil {
+		return "", err
+	}
 	if !ok {
 		// Not existed. Create a new stream.
-		tarStream = StreamValue{}
 		id, _ = parseIDString(idStr, nil)
 	} else {
-		tarStream = tarStreamAny.(StoreValue).v.(StreamValue)
 		id, _ = parseIDString(idStr, tarStream.lastID)
 	}
 
 	if id.Ms == 0 && id.Seq == 0 {
-		return "The ID specified in XADD must be greater than 0-0", ErrorType
+		return "", ErrStreamIDZero
 	}
 
 	if len(tarStream.entries) > 0 {
 		lastID := tarStream.lastID
 		if !less(lastID, id) {
-			return "The ID specified in XADD is equal or smaller than the target stream top item", ErrorType
+			return "", ErrStreamIDTooSmall
 		}
 	}
 
@@ -118,7 +134,7 @@ func (kv *KVStore) XAdd(key string, idStr string, data map[string]string) (res s
 	// log.Println("[debug] broadcasted")
 
 	resIdStr := fmt.Sprintf("%d-%d", id.Ms, id.Seq)
-	return resIdStr, StringType
+	return resIdStr, nil
 }
 
 // Find the last stream id with ms.
@@ -165,20 +181,24 @@ func (kv *KVStore) parseRangeID(entries []StreamEntry, idStr string, isStart boo
 	return StreamID{Ms: ms, Seq: seq}
 }
 
-func (kv *KVStore) getEntries(key string) ([]StreamEntry, bool) {
-	tarStreamAny, ok := kv.mp.Load(key)
+func (kv *KVStore) getEntries(key string) ([]StreamEntry, bool, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	tarStream, ok, err := kv.getStream(key)
 	if !ok {
-		return []StreamEntry{}, ok
+		return []StreamEntry{}, ok, err
 	}
-	return tarStreamAny.(StoreValue).v.(StreamValue).entries, ok
+	return tarStream.entries, ok, nil
 }
 
 // Retrieves a range of entries from a stream. The range is inclusive.
-func (kv *KVStore) XRange(key, id1, id2 string) []StreamEntry {
-	entries, ok := kv.getEntries(key)
+func (kv *KVStore) XRange(key, id1, id2 string) ([]StreamEntry, error) {
+	entries, ok, err := kv.getEntries(key)
 	if !ok {
-		log.Printf("[error]: key (%s) does not exist", key)
-		return []StreamEntry{}
+		if err == nil {
+			log.Printf("[error]: key (%s) does not exist", key)
+		}
+		return []StreamEntry{}, err
 	}
 
 	start, end := kv.parseRangeID(entries, id1, true), kv.parseRangeID(entries, id2, false)
@@ -192,15 +212,14 @@ func (kv *KVStore) XRange(key, id1, id2 string) []StreamEntry {
 		return !less(entries[i].ID, end) && !equal(end, entries[i].ID)
 	})
 
-	return entries[startIdx:endIdx]
+	return entries[startIdx:endIdx], nil
 }
 
 func (kv *KVStore) getLastID(key string) (StreamID, bool) {
-	tarStreamAny, ok := kv.mp.Load(key)
-	if !ok {
-		return StreamID{}, ok
-	}
-	return tarStreamAny.(StoreValue).v.(StreamValue).lastID, ok
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	tarStream, ok, _ := kv.getStream(key)
+	return tarStream.lastID, ok
 }
 
 // XRead reads data from one or multiple streams.
@@ -210,7 +229,7 @@ func (kv *KVStore) XRead(
 	cnt int,
 	isBlock bool,
 	timeout time.Duration,
-) [][]StreamEntry {
+) ([][]StreamEntry, error) {
 
 	n := len(keys)
 	res := make([][]StreamEntry, n)
@@ -218,7 +237,10 @@ func (kv *KVStore) XRead(
 	for {
 		gottenRes := false
 		for i := range n {
-			entries, ok := kv.getEntries(keys[i])
+			entries, ok, err := kv.getEntries(keys[i])
+			if err != nil {
+				return nil, err
+			}
 			if !ok {
 				// Key not exists
 				if ids[i] == "$" {
@@ -251,13 +273,13 @@ func (kv *KVStore) XRead(
 			endIdx := len(entries)
 
 			if cnt > 0 {
-				endIdx = startIdx + cnt
+				endIdx = min(startIdx+cnt, len(entries))
 			}
 			res[i] = entries[startIdx:endIdx]
 		}
 
 		if gottenRes || !isBlock {
-			return res
+			return res, nil
 		}
 
 		// block
@@ -283,7 +305,7 @@ func (kv *KVStore) XRead(
 		// log.Println("[debug] Before select")
 		select {
 		case <-tCtx.Done():
-			return nil
+			return nil, nil
 		case <-waitCh:
 			// log.Println("[debug] waitCh wakes up")
 		}
@@ -1,77 +1,458 @@
 package kv
 
 import (
-	"fmt"
+	"errors"
+	"math"
 	"strconv"
 	"time"
 )
 
+// Max length of a string value (proto-max-bulk-len)
+const maxStringLen = 512 * 1024 * 1024
+
+var (
+	ErrStringTooLong = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	ErrLCSNotString  = errors.New("ERR The specified keys must contain string values")
+	ErrLCSTooLarge   = errors.New("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+)
+
 type StringValue struct {
-	value     string
-	px        int // Millisecond
-	createdAt time.Time
+	value string
+	// raw replaces value once the string is modified in place, like a
+	// bitmap written bit by bit by SETBIT. It is only accessed with keyMu
+	// held, replies get a copy.
+	raw []byte
 }
 
-func NewStringValue(value string, px int) StringValue {
+func NewStringValue(value string) StringValue {
 	return StringValue{
-		value:     value,
-		px:        px,
-		createdAt: time.Now(),
+		value: value,
 	}
 }
 
-func (kv *KVStore) Set(key, value string) {
-	v := StringValue{
-		value:     value,
-		px:        -1,
-		createdAt: time.Now(),
+// Strings up to this length are allocated together with their object
+// header in Redis, the embstr encoding.
+const stringMaxEmbstrLen = 44
+
+// String returns the contents of the string.
+func (str StringValue) String() string {
+	if str.raw != nil {
+		return string(str.raw)
+	}
+	return str.value
+}
+
+func (str StringValue) len() int {
+	if str.raw != nil {
+		return len(str.raw)
 	}
-	kv.store(key, v, StringType)
+	return len(str.value)
 }
 
-func (kv *KVStore) SetExpire(key, value string, t int) {
-	v := StringValue{
-		value:     value,
-		px:        t,
-		createdAt: time.Now(),
+// byteAt returns the byte at i, or 0 past the end of the string.
+func (str StringValue) byteAt(i int) byte {
+	if i >= str.len() {
+		return 0
 	}
-	kv.store(key, v, StringType)
+	if str.raw != nil {
+		return str.raw[i]
+	}
+	return str.value[i]
+}
+
+// mutable returns the contents as bytes that can be modified in place
+// and stored back as raw. Only the first call on a string copies it.
+func (str StringValue) mutable() []byte {
+	if str.raw != nil {
+		return str.raw
+	}
+	return []byte(str.value)
 }
 
-func (kv *KVStore) Get(key string) (value any) {
-	val, ok := kv.mp.Load(key)
+func (str StringValue) Encoding() string {
+	if str.raw != nil {
+		return "raw"
+	}
+	if _, ok := parseInt(str.value); ok {
+		return "int"
+	}
+	if len(str.value) <= stringMaxEmbstrLen {
+		return "embstr"
+	}
+	return "raw"
+}
+
+// parseInt accepts only the canonical decimal form of an int64, like Redis:
+// no sign prefix, leading zeros or spaces.
+func parseInt(str string) (int64, bool) {
+	v, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != str {
+		return 0, false
+	}
+	return v, true
+}
+
+func (kv *KVStore) getString(key string) (StringValue, bool, error) {
+	val, ok, err := kv.lookup(key, StringType)
 	if !ok {
-		return nil
-	} else {
-		v := val.(StoreValue).v.(StringValue)
-		if v.px == -1 {
-			return v.value
-		} else {
-			duration := time.Duration(v.px) * time.Millisecond
-			exTime := v.createdAt.Add(duration)
-			if time.Now().Before(exTime) {
-				return v.value
-			} else {
-				return nil
-			}
+		return StringValue{}, false, err
+	}
+	return val.v.(StringValue), true, nil
+}
+
+// set stores a string value and discards any previous TTL.
+func (kv *KVStore) set(key, value string) {
+	kv.store(key, StringValue{value: value}, StringType)
+	kv.clearExpire(key)
+}
+
+func (kv *KVStore) Set(key, value string) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	kv.set(key, value)
+}
+
+// Conditions for SET
+type SetCondition int
+
+const (
+	SetAlways SetCondition = iota
+	SetNX                  // only set the key if it does not exist
+	SetXX                  // only set the key if it already exists
+)
+
+// SetOptions holds the arguments of a SET command.
+type SetOptions struct {
+	Cond     SetCondition
+	ExpireAt time.Time // zero means no expiry
+	KeepTTL  bool      // retain the TTL of the existing key
+	Get      bool      // return the old string value
+}
+
+// SetWithOptions implements SET. It returns the old value when opts.Get is
+// set (nil if the key didn't exist) and whether the value was stored.
+// With GET, a key holding a non-string value fails with ErrWrongType.
+func (kv *KVStore) SetWithOptions(key, value string, opts SetOptions) (old any, ok bool, err error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+
+	cur, exists := kv.load(key)
+	if opts.Get && exists {
+		if cur.t != StringType {
+			return nil, false, ErrWrongType
 		}
+		old = cur.v.(StringValue).String()
+	}
+	if (opts.Cond == SetNX && exists) || (opts.Cond == SetXX && !exists) {
+		return old, false, nil
 	}
+
+	if opts.KeepTTL {
+		kv.store(key, StringValue{value: value}, StringType)
+	} else {
+		kv.set(key, value)
+	}
+	if !opts.ExpireAt.IsZero() {
+		kv.setExpire(key, opts.ExpireAt)
+	}
+	return old, true, nil
 }
 
-func (kv *KVStore) Incr(key string) (any, ValueType) {
-	storeValAny, ok := kv.mp.Load(key)
-	var val int64
+// Get returns the string at key, or nil when the key does not exist.
+func (kv *KVStore) Get(key string) (any, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	str, ok, err := kv.getString(key)
 	if !ok {
-		val = 1
-	} else {
-		stringVal := storeValAny.(StoreValue).v.(StringValue).value
-		if intVal, err := strconv.ParseInt(stringVal, 10, 64); err != nil {
+		return nil, err
+	}
+	return str.String(), nil
+}
+
+// GetDel returns the string at key and deletes the key.
+func (kv *KVStore) GetDel(key string) (any, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, ok, err := kv.getString(key)
+	if !ok {
+		return nil, err
+	}
+	kv.delete(key)
+	return str.String(), nil
+}
+
+// GetEx returns the string at key and updates its expiry: a non-zero
+// expireAt sets a new one, persist removes it.
+func (kv *KVStore) GetEx(key string, expireAt time.Time, persist bool) (any, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, ok, err := kv.getString(key)
+	if !ok {
+		return nil, err
+	}
+	if persist {
+		kv.clearExpire(key)
+	} else if !expireAt.IsZero() {
+		kv.setExpire(key, expireAt)
+	}
+	return str.String(), nil
+}
+
+// IncrBy adds incr to the integer stored at key, keeping its TTL. A
+// missing key counts as 0.
+func (kv *KVStore) IncrBy(key string, incr int64) (int64, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, ok, err := kv.getString(key)
+	if err != nil {
+		return 0, err
+	}
+	var cur int64
+	if ok {
+		if cur, ok = parseInt(str.String()); !ok {
 			// not int string
-			return "value is not an integer or out of range", ErrorType
+			return 0, ErrNotInteger
+		}
+	}
+	if (incr > 0 && cur > math.MaxInt64-incr) || (incr < 0 && cur < math.MinInt64-incr) {
+		return 0, ErrOverflow
+	}
+	cur += incr
+	kv.store(key, StringValue{value: strconv.FormatInt(cur, 10)}, StringType)
+	return cur, nil
+}
+
+// IncrByFloat adds incr to the number stored at key, keeping its TTL, and
+// returns the new value formatted the way it is stored.
+func (kv *KVStore) IncrByFloat(key string, incr float64) (string, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, ok, err := kv.getString(key)
+	if err != nil {
+		return "", err
+	}
+	var cur float64
+	if ok {
+		cur, err = strconv.ParseFloat(str.String(), 64)
+		if err != nil || math.IsNaN(cur) || math.IsInf(cur, 0) {
+			return "", ErrNotFloat
+		}
+	}
+	cur += incr
+	if math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return "", ErrNaN
+	}
+	res := strconv.FormatFloat(cur, 'f', -1, 64)
+	kv.store(key, StringValue{value: res}, StringType)
+	return res, nil
+}
+
+// Append appends value to the string at key, creating it if needed.
+// Returns the length of the string after the append.
+func (kv *KVStore) Append(key, value string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, _, err := kv.getString(key)
+	if err != nil {
+		return 0, err
+	}
+	if str.len()+len(value) > maxStringLen {
+		return 0, ErrStringTooLong
+	}
+	str = StringValue{value: str.String() + value}
+	kv.store(key, str, StringType)
+	return str.len(), nil
+}
+
+func (kv *KVStore) StrLen(key string) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	str, _, err := kv.getString(key)
+	return str.len(), err
+}
+
+// GetRange returns the substring between start and end (both inclusive).
+// Negative offsets count from the end of the string.
+func (kv *KVStore) GetRange(key string, start, end int) (string, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	str, ok, err := kv.getString(key)
+	if !ok {
+		return "", err
+	}
+	length := str.len()
+	if start < 0 && end < 0 && start > end {
+		return "", nil
+	}
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if end < 0 {
+		end = max(length+end, 0)
+	}
+	end = min(end, length-1)
+	if length == 0 || start > end {
+		return "", nil
+	}
+	if str.raw != nil {
+		return string(str.raw[start : end+1]), nil
+	}
+	return str.value[start : end+1], nil
+}
+
+// SetRange overwrites part of the string at key starting at offset,
+// padding with zero bytes if the string is too short. Returns the new
+// length of the string.
+func (kv *KVStore) SetRange(key string, offset int, value string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	str, _, err := kv.getString(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) == 0 {
+		// nothing to write, don't create the key
+		return str.len(), nil
+	}
+	// offset comes from the client, compare before adding to it
+	if offset > maxStringLen-len(value) {
+		return 0, ErrStringTooLong
+	}
+	buf := growBytes(str.mutable(), uint64(offset+len(value)))
+	copy(buf[offset:], value)
+	// a missing key has no TTL to keep
+	kv.store(key, StringValue{raw: buf}, StringType)
+	return len(buf), nil
+}
+
+// MSet sets every key/value pair of the flat list in a single step.
+func (kv *KVStore) MSet(pairs []string) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		kv.set(pairs[i], pairs[i+1])
+	}
+}
+
+// MSetNX sets the pairs only if none of the keys exist. Returns 1 if
+// they were set, 0 otherwise.
+func (kv *KVStore) MSetNX(pairs []string) int {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if _, ok := kv.load(pairs[i]); ok {
+			return 0
+		}
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		kv.set(pairs[i], pairs[i+1])
+	}
+	return 1
+}
+
+// MGet returns the string at each key. Missing keys and keys holding
+// another type give nil.
+func (kv *KVStore) MGet(keys []string) []any {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	res := make([]any, len(keys))
+	for i, key := range keys {
+		if str, ok, _ := kv.getString(key); ok {
+			res[i] = str.String()
+		}
+	}
+	return res
+}
+
+// A common substring found by LCS: the inclusive ranges in both strings.
+type LCSMatch struct {
+	A, B [2]int
+	Len  int
+}
+
+type LCSResult struct {
+	Seq     string     // the longest common subsequence
+	Matches []LCSMatch // matching ranges, from the end of the strings
+}
+
+// LCS computes the longest common subsequence of the strings at key1 and
+// key2. Missing keys are treated as empty strings.
+func (kv *KVStore) LCS(key1, key2 string) (LCSResult, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	s1, _, err1 := kv.getString(key1)
+	s2, _, err2 := kv.getString(key2)
+	if err1 != nil || err2 != nil {
+		return LCSResult{}, ErrLCSNotString
+	}
+	// the table takes 4 bytes per pair of prefixes, cap it like Redis
+	if cells := (s1.len() + 1) * (s2.len() + 1); cells >= math.MaxUint32 || cells*4 > maxStringLen {
+		return LCSResult{}, ErrLCSTooLarge
+	}
+	return lcs(s1.String(), s2.String()), nil
+}
+
+func lcs(a, b string) LCSResult {
+	alen, blen := len(a), len(b)
+	// dp[i][j] is the LCS length of a[:i] and b[:j]
+	dp := make([][]uint32, alen+1)
+	for i := range dp {
+		dp[i] = make([]uint32, blen+1)
+	}
+	for i := 1; i <= alen; i++ {
+		for j := 1; j <= blen; j++ {
+			if a[i-1] == b[j-1] {
+				dp[i][j] = dp[i-1][j-1] + 1
+			} else {
+				dp[i][j] = max(dp[i-1][j], dp[i][j-1])
+			}
+		}
+	}
+
+	// Walk back from the end, collecting the sequence and the ranges of
+	// contiguous matches.
+	idx := dp[alen][blen]
+	seq := make([]byte, idx)
+	matches := []LCSMatch{}
+	i, j := alen, blen
+	aStart, aEnd, bStart, bEnd := alen, 0, 0, 0 // aStart == alen: no range
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			seq[idx-1] = a[i-1]
+			if aStart == alen {
+				aStart, aEnd = i-1, i-1
+				bStart, bEnd = j-1, j-1
+			} else if aStart == i && bStart == j {
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
 		} else {
-			val = intVal + 1
+			if dp[i-1][j] > dp[i][j-1] {
+				i--
+			} else {
+				j--
+			}
+			if aStart != alen {
+				emit = true
+			}
+		}
+		if emit {
+			matches = append(matches, LCSMatch{
+				A:   [2]int{aStart, aEnd},
+				B:   [2]int{bStart, bEnd},
+				Len: aEnd - aStart + 1,
+			})
+			aStart = alen
 		}
 	}
-	kv.Set(key, fmt.Sprintf("%d", val))
-	return val, StringType
+	return LCSResult{Seq: string(seq), Matches: matches}
 }
@@ -0,0 +1,138 @@
+package kv
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestGetRange(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("k", "This is a string")
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{-100, 3, "This"},
+		{5, 3, ""},
+		{-1, -5, ""},
+		{100, 200, ""},
+	}
+	for _, tt := range tests {
+		if got, _ := kv.GetRange("k", tt.start, tt.end); got != tt.want {
+			t.Errorf("GetRange(%d, %d) = %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+	if got, err := kv.GetRange("missing", 0, -1); got != "" || err != nil {
+		t.Errorf("GetRange of a missing key = %q, %v", got, err)
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string // "" for a missing key
+		offset  int
+		value   string
+		want    string
+		wantErr error
+	}{
+		{"overwrite", "Hello World", 6, "Redis", "Hello Redis", nil},
+		{"extend", "Hello", 3, "p me", "Help me", nil},
+		{"pad missing key", "", 3, "ab", "\x00\x00\x00ab", nil},
+		{"pad", "ab", 4, "c", "ab\x00\x00c", nil},
+		{"empty value", "ab", 100, "", "ab", nil},
+		{"past the limit", "", maxStringLen, "a", "", ErrStringTooLong},
+		{"offset overflowing with the value", "ab", math.MaxInt - 1, "abc", "ab", ErrStringTooLong},
+		{"max offset", "", math.MaxInt, "a", "", ErrStringTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := NewKVStore()
+			if tt.initial != "" {
+				kv.Set("k", tt.initial)
+			}
+			n, err := kv.SetRange("k", tt.offset, tt.value)
+			if err != tt.wantErr {
+				t.Fatalf("SetRange error = %v, want %v", err, tt.wantErr)
+			}
+			got, _ := kv.Get("k")
+			if got == nil {
+				got = ""
+			}
+			if got != tt.want || (err == nil && n != len(tt.want)) {
+				t.Errorf("SetRange = %d, value %q, want %q", n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendStrLen(t *testing.T) {
+	kv := NewKVStore()
+	if n, _ := kv.Append("k", "Hello"); n != 5 {
+		t.Errorf("Append to a missing key = %d, want 5", n)
+	}
+	if n, _ := kv.Append("k", " World"); n != 11 {
+		t.Errorf("Append = %d, want 11", n)
+	}
+	// appending to a string modified in place
+	kv.SetRange("k", 0, "J")
+	kv.Append("k", "!")
+	if got, _ := kv.Get("k"); got != "Jello World!" {
+		t.Errorf("value = %q", got)
+	}
+	if n, _ := kv.StrLen("k"); n != 12 {
+		t.Errorf("StrLen = %d, want 12", n)
+	}
+	if n, _ := kv.StrLen("missing"); n != 0 {
+		t.Errorf("StrLen of a missing key = %d", n)
+	}
+}
+
+func TestMSetMGet(t *testing.T) {
+	kv := NewKVStore()
+	kv.MSet([]string{"a", "1", "b", "2", "a", "3"})
+	kv.RPush("list", []string{"x"})
+	if got := kv.MGet([]string{"a", "b", "missing", "list"}); !slices.Equal(got, []any{"3", "2", nil, nil}) {
+		t.Errorf("MGet = %v", got)
+	}
+	if kv.MSetNX([]string{"c", "1", "a", "x"}) != 0 || kv.Exists("c") != 0 {
+		t.Error("MSetNX set keys while one existed")
+	}
+	if kv.MSetNX([]string{"c", "1", "d", "2"}) != 1 || kv.Exists("c", "d") != 2 {
+		t.Error("MSetNX did not set new keys")
+	}
+}
+
+func TestLCS(t *testing.T) {
+	kv := NewKVStore()
+	kv.MSet([]string{"key1", "ohmytext", "key2", "mynewtext"})
+	res, err := kv.LCS("key1", "key2")
+	if err != nil || res.Seq != "mytext" {
+		t.Fatalf("LCS = %q, %v, want mytext", res.Seq, err)
+	}
+	want := []LCSMatch{
+		{A: [2]int{4, 7}, B: [2]int{5, 8}, Len: 4},
+		{A: [2]int{2, 3}, B: [2]int{0, 1}, Len: 2},
+	}
+	if !slices.Equal(res.Matches, want) {
+		t.Errorf("LCS matches = %v, want %v", res.Matches, want)
+	}
+
+	if res, _ := kv.LCS("key1", "missing"); res.Seq != "" || len(res.Matches) != 0 {
+		t.Errorf("LCS with a missing key = %+v", res)
+	}
+	kv.RPush("list", []string{"x"})
+	if _, err := kv.LCS("key1", "list"); err != ErrLCSNotString {
+		t.Errorf("LCS with a list error = %v, want ErrLCSNotString", err)
+	}
+	kv.SetRange("big1", 20000, "a")
+	kv.SetRange("big2", 20000, "a")
+	if _, err := kv.LCS("big1", "big2"); err != ErrLCSTooLarge {
+		t.Errorf("LCS of two 20KB strings error = %v, want ErrLCSTooLarge", err)
+	}
+}
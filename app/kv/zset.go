@@ -1,168 +1,923 @@
 package kv
 
 import (
-	"sort"
+	"errors"
+	"iter"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMinMaxNotFloat = errors.New("ERR min or max is not a float")
+	ErrMinMaxNotLex   = errors.New("ERR min or max not valid string range item")
+	ErrScoreNaN       = errors.New("ERR resulting score is not a number (NaN)")
 )
 
 type ZSetElem struct {
-	member string
-	score  float64
+	Member string
+	Score  float64
 }
 
+// ZSetValue keeps the members ordered in a skiplist, and their scores in
+// a map for O(1) lookups by member.
 type ZSetValue struct {
-	memToScore map[string]float64
-	scores     []ZSetElem
+	memToScore *dict[float64]
+	zsl        *skiplist
+}
+
+// Sorted sets within these limits are reported with the listpack
+// encoding (zset-max-listpack-entries and zset-max-listpack-value).
+const (
+	zsetMaxListpackEntries = 128
+	zsetMaxListpackValue   = 64
+)
+
+func (zset ZSetValue) Encoding() string {
+	if zset.memToScore.len() > zsetMaxListpackEntries {
+		return "skiplist"
+	}
+	for member := range zset.memToScore.all() {
+		if len(member) > zsetMaxListpackValue {
+			return "skiplist"
+		}
+	}
+	return "listpack"
 }
 
 func NewEmptyZSetValue() ZSetValue {
 	return ZSetValue{
-		memToScore: make(map[string]float64),
-		scores:     []ZSetElem{},
+		memToScore: newDict[float64](),
+		zsl:        newSkiplist(),
 	}
 }
 
-func LowerBound(s []ZSetElem, tar ZSetElem) int {
-	return sort.Search(len(s), func(i int) bool {
-		if s[i].score == tar.score {
-			return s[i].member >= tar.member
+func (zset ZSetValue) card() int {
+	return zset.memToScore.len()
+}
+
+// add sets the score of member and returns whether it is a new member.
+func (zset ZSetValue) add(member string, score float64) bool {
+	if oldScore, ok := zset.memToScore.get(member); ok {
+		if oldScore != score {
+			zset.zsl.updateScore(oldScore, member, score)
+			zset.memToScore.set(member, score)
 		}
-		return s[i].score > tar.score
-	})
+		return false
+	}
+	zset.zsl.insert(score, member)
+	zset.memToScore.set(member, score)
+	return true
 }
 
-func (kv *KVStore) ZAdd(key string, member string, score float64) (isNew bool) {
-	storeValAny, ok := kv.mp.Load(key)
-	var newZSet ZSetValue
+// remove deletes member and returns whether it was present.
+func (zset ZSetValue) remove(member string) bool {
+	score, ok := zset.memToScore.get(member)
 	if !ok {
-		newZSet = NewEmptyZSetValue()
-	} else {
-		newZSet = storeValAny.(StoreValue).v.(ZSetValue)
+		return false
 	}
+	zset.zsl.delete(score, member)
+	zset.memToScore.delete(member)
+	return true
+}
 
-	// if member already exists, remove the original one
-	if oldScore, ok := newZSet.memToScore[member]; ok {
-		isNew = false
-		delete(newZSet.memToScore, member)
-		pos := LowerBound(newZSet.scores, ZSetElem{member, oldScore})
-		newZSet.scores = append(newZSet.scores[:pos], newZSet.scores[pos+1:]...)
-	} else {
-		isNew = true
+// rank returns the 0-based rank of member.
+func (zset ZSetValue) rank(member string) (int, bool) {
+	score, ok := zset.memToScore.get(member)
+	if !ok {
+		return 0, false
+	}
+	return zset.zsl.rank(score, member) - 1, true
+}
+
+func (zset ZSetValue) clone() ZSetValue {
+	return ZSetValue{
+		memToScore: zset.memToScore.clone(),
+		zsl:        zset.zsl.clone(),
+	}
+}
+
+// formatScore formats a score the way it is shown in replies.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
 	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
 
-	// Insert member into the zset
-	newElem := ZSetElem{member, score}
-	insertIdx := LowerBound(newZSet.scores, newElem)
+func (kv *KVStore) getZSet(key string) (ZSetValue, bool, error) {
+	val, ok, err := kv.lookup(key, ZSetType)
+	if !ok {
+		return ZSetValue{}, false, err
+	}
+	return val.v.(ZSetValue), true, nil
+}
 
-	newZSet.scores = append(newZSet.scores, ZSetElem{})
-	copy(newZSet.scores[insertIdx+1:], newZSet.scores[insertIdx:])
-	newZSet.scores[insertIdx] = newElem
+// storeZSet stores zset at key, or deletes the key when it is empty.
+func (kv *KVStore) storeZSet(key string, zset ZSetValue) {
+	if zset.card() == 0 {
+		kv.delete(key)
+		return
+	}
+	kv.store(key, zset, ZSetType)
+}
 
-	newZSet.memToScore[member] = score
+func (kv *KVStore) ZAdd(key string, member string, score float64) (isNew bool, err error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	zSet, ok, err := kv.getZSet(key)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		zSet = NewEmptyZSetValue()
+	}
+	isNew = zSet.add(member, score)
+	kv.storeZSet(key, zSet)
+	kv.wake(key)
+	return isNew, nil
+}
 
-	kv.store(key, newZSet, ZSetType)
+// ZAddOptions are the flags of ZADD. NX only adds new members, XX only
+// updates existing ones, GT and LT only update when the score grows or
+// shrinks, and CH counts updated members along with added ones.
+type ZAddOptions struct {
+	NX, XX, GT, LT, CH bool
+}
 
-	return
+// zadd sets or increments the score of member according to opts. Returns
+// the resulting score, and whether the member was added or updated. ok is
+// false when the options prevented the update.
+func (zset ZSetValue) zadd(member string, score float64, incr bool, opts ZAddOptions) (newScore float64, added, updated, ok bool, err error) {
+	cur, exists := zset.memToScore.get(member)
+	if (exists && opts.NX) || (!exists && opts.XX) {
+		return 0, false, false, false, nil
+	}
+	if !exists {
+		zset.add(member, score)
+		return score, true, false, true, nil
+	}
+	newScore = score
+	if incr {
+		newScore = cur + score
+		if math.IsNaN(newScore) {
+			return 0, false, false, false, ErrScoreNaN
+		}
+	}
+	if (opts.GT && newScore <= cur) || (opts.LT && newScore >= cur) {
+		return 0, false, false, false, nil
+	}
+	if newScore != cur {
+		zset.add(member, newScore)
+		updated = true
+	}
+	return newScore, false, updated, true, nil
 }
 
-// If the member, or the sorted set does not exist, return nil.
-// Otherwise, return the rank.
-func (kv *KVStore) ZRank(key string, member string) any {
-	storeValAny, ok := kv.mp.Load(key)
-	var zSet ZSetValue
+// ZAddMulti sets the scores of elems according to opts. Returns the
+// number of added members, plus the updated ones with CH.
+func (kv *KVStore) ZAddMulti(key string, elems []ZSetElem, opts ZAddOptions) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	zSet, ok, err := kv.getZSet(key)
+	if err != nil {
+		return 0, err
+	}
 	if !ok {
-		return nil
-	} else {
-		zSet = storeValAny.(StoreValue).v.(ZSetValue)
+		if opts.XX {
+			return 0, nil
+		}
+		zSet = NewEmptyZSetValue()
+	}
+	cnt := 0
+	for _, elem := range elems {
+		_, added, updated, _, _ := zSet.zadd(elem.Member, elem.Score, false, opts)
+		if added || (opts.CH && updated) {
+			cnt++
+		}
 	}
+	kv.storeZSet(key, zSet)
+	kv.wake(key)
+	return cnt, nil
+}
 
-	var score float64
-	if s, ok := zSet.memToScore[member]; !ok {
-		return nil
-	} else {
-		score = s
+// ZIncrBy increments the score of member, adding it if needed, and
+// returns the new score. nil is returned when opts prevented the update.
+func (kv *KVStore) ZIncrBy(key, member string, incr float64, opts ZAddOptions) (any, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	zSet, ok, err := kv.getZSet(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if opts.XX {
+			return nil, nil
+		}
+		zSet = NewEmptyZSetValue()
+	}
+	score, _, _, ok, err := zSet.zadd(member, incr, true, opts)
+	if !ok {
+		return nil, err
 	}
+	kv.storeZSet(key, zSet)
+	kv.wake(key)
+	return score, nil
+}
 
-	pos := LowerBound(zSet.scores, ZSetElem{member, score})
+// ZRank returns the 0-based rank of member and its score, counting from
+// the highest score with rev. ok is false if the member or the sorted set
+// does not exist.
+func (kv *KVStore) ZRank(key, member string, rev bool) (rank int, score float64, ok bool, err error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return 0, 0, false, err
+	}
+	rank, ok = zSet.rank(member)
+	if !ok {
+		return 0, 0, false, nil
+	}
+	if rev {
+		rank = zSet.card() - 1 - rank
+	}
+	score, _ = zSet.memToScore.get(member)
+	return rank, score, true, nil
+}
 
-	return pos
+func (kv *KVStore) ZCard(key string) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return 0, err
+	}
+	return zSet.card(), nil
 }
 
-func (kv *KVStore) ZRange(key string, start, end int) (res []string) {
-	storeValAny, ok := kv.mp.Load(key)
-	var zSet ZSetValue
+// Get member's score. If existing, return float64. Else Return nil.
+func (kv *KVStore) ZScore(key string, member string) (any, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
 	if !ok {
-		return
+		return nil, err
+	}
+	if score, ok := zSet.memToScore.get(member); !ok {
+		return nil, nil
 	} else {
-		zSet = storeValAny.(StoreValue).v.(ZSetValue)
+		return score, nil
 	}
+}
 
-	ss := zSet.scores
-	length := len(ss)
+// ZMScore returns the score of each member, nil for missing ones.
+func (kv *KVStore) ZMScore(key string, members []string) ([]any, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, len(members))
+	for i, member := range members {
+		if score, exists := zSet.memToScore.get(member); ok && exists {
+			res[i] = score
+		}
+	}
+	return res, nil
+}
 
-	if start < 0 {
-		start = length + start
+// ZRem removes members and returns how many were there.
+func (kv *KVStore) ZRem(key string, members []string) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return 0, err
 	}
-	start = max(0, start)
+	removed := 0
+	for _, member := range members {
+		if zSet.remove(member) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		kv.storeZSet(key, zSet)
+	}
+	return removed, nil
+}
+
+// ZRemRange removes the members selected by q and returns their number.
+func (kv *KVStore) ZRemRange(key string, q ZRangeQuery) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return 0, err
+	}
+	elems := zSet.query(q)
+	for _, elem := range elems {
+		zSet.remove(elem.Member)
+	}
+	if len(elems) > 0 {
+		kv.storeZSet(key, zSet)
+	}
+	return len(elems), nil
+}
 
-	if end < 0 {
-		end = length + end
+// ZRandMember returns random members with their scores, like SRandMember:
+// a positive count returns distinct members, a negative count may repeat
+// members.
+func (kv *KVStore) ZRandMember(key string, count int) ([]ZSetElem, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return []ZSetElem{}, err
+	}
+	elemAt := func(i int) ZSetElem {
+		x := zSet.zsl.byRank(i + 1)
+		return ZSetElem{Member: x.member, Score: x.score}
 	}
-	end = max(0, end)
+	res := []ZSetElem{}
+	for _, i := range sampleIndexes(zSet.card(), count) {
+		res = append(res, elemAt(i))
+	}
+	return res, nil
+}
 
-	if start >= len(ss) || start > end {
-		return
+// zslRange bounds a walk over the skiplist.
+type zslRange interface {
+	empty() bool
+	aboveMin(x *zslNode) bool
+	belowMax(x *zslNode) bool
+}
+
+// ZScoreRange is a score interval whose ends may be exclusive.
+type ZScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+// parseScoreBound parses a score bound: a float, optionally prefixed with
+// "(" to make it exclusive. "-inf" and "+inf" are accepted.
+func parseScoreBound(str string) (float64, bool, error) {
+	ex := strings.HasPrefix(str, "(")
+	if ex {
+		str = str[1:]
 	}
-	end = min(end, len(ss)-1)
+	score, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, ErrMinMaxNotFloat
+	}
+	return score, ex, nil
+}
 
-	res = make([]string, end-start+1)
-	for i := start; i <= end; i++ {
-		res[i-start] = ss[i].member
+func ParseScoreRange(min, max string) (r ZScoreRange, err error) {
+	if r.Min, r.MinEx, err = parseScoreBound(min); err != nil {
+		return r, err
 	}
-	return
+	r.Max, r.MaxEx, err = parseScoreBound(max)
+	return r, err
 }
 
-func (kv *KVStore) ZCard(key string) int {
-	storeValAny, ok := kv.mp.Load(key)
-	var zSet ZSetValue
-	if !ok {
-		return 0
+func (r ZScoreRange) empty() bool {
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinEx || r.MaxEx))
+}
+
+func (r ZScoreRange) aboveMin(x *zslNode) bool {
+	if r.MinEx {
+		return x.score > r.Min
+	}
+	return x.score >= r.Min
+}
+
+func (r ZScoreRange) belowMax(x *zslNode) bool {
+	if r.MaxEx {
+		return x.score < r.Max
+	}
+	return x.score <= r.Max
+}
+
+// lexBound is an end of a ZLexRange. inf is -1 for "-", 1 for "+".
+type lexBound struct {
+	value string
+	ex    bool
+	inf   int
+}
+
+func parseLexBound(str string) (lexBound, error) {
+	switch {
+	case str == "-":
+		return lexBound{inf: -1}, nil
+	case str == "+":
+		return lexBound{inf: 1}, nil
+	case strings.HasPrefix(str, "("):
+		return lexBound{value: str[1:], ex: true}, nil
+	case strings.HasPrefix(str, "["):
+		return lexBound{value: str[1:]}, nil
+	}
+	return lexBound{}, ErrMinMaxNotLex
+}
+
+// cmp orders a member against the bound.
+func (b lexBound) cmp(member string) int {
+	if b.inf != 0 {
+		return -b.inf
+	}
+	return strings.Compare(member, b.value)
+}
+
+// ZLexRange is a member interval, written "[a" or "(a" for inclusive and
+// exclusive ends and "-" or "+" for the smallest and largest string.
+type ZLexRange struct {
+	min, max lexBound
+}
+
+func ParseLexRange(min, max string) (r ZLexRange, err error) {
+	if r.min, err = parseLexBound(min); err != nil {
+		return r, err
+	}
+	r.max, err = parseLexBound(max)
+	return r, err
+}
+
+func (r ZLexRange) empty() bool {
+	var c int
+	switch {
+	case r.min.inf != 0 && r.min.inf == r.max.inf:
+		c = 0
+	case r.min.inf == -1 || r.max.inf == 1:
+		c = -1
+	case r.min.inf == 1 || r.max.inf == -1:
+		c = 1
+	default:
+		c = strings.Compare(r.min.value, r.max.value)
+	}
+	return c > 0 || (c == 0 && (r.min.ex || r.max.ex))
+}
+
+func (r ZLexRange) aboveMin(x *zslNode) bool {
+	c := r.min.cmp(x.member)
+	return c > 0 || (c == 0 && !r.min.ex)
+}
+
+func (r ZLexRange) belowMax(x *zslNode) bool {
+	c := r.max.cmp(x.member)
+	return c < 0 || (c == 0 && !r.max.ex)
+}
+
+// ZRangeBy selects how the ends of a ZRangeQuery are interpreted.
+type ZRangeBy int
+
+const (
+	ZRangeByRank ZRangeBy = iota
+	ZRangeByScore
+	ZRangeByLex
+)
+
+// ZRangeQuery describes a ZRANGE: by rank (Start and Stop), score or lex,
+// optionally reversed and limited to Count elements after skipping Offset
+// of them. A negative Count means no limit.
+type ZRangeQuery struct {
+	By          ZRangeBy
+	Start, Stop int
+	Score       ZScoreRange
+	Lex         ZLexRange
+	Rev         bool
+	Offset      int
+	Count       int
+}
+
+// query runs q against the sorted set.
+func (zset ZSetValue) query(q ZRangeQuery) []ZSetElem {
+	res := []ZSetElem{}
+	zsl := zset.zsl
+	if q.By == ZRangeByRank {
+		length := zsl.length
+		start, stop := q.Start, q.Stop
+		if start < 0 {
+			start += length
+		}
+		if stop < 0 {
+			stop += length
+		}
+		start = max(start, 0)
+		if start > stop || start >= length {
+			return res
+		}
+		stop = min(stop, length-1)
+		if q.Rev {
+			x := zsl.byRank(length - start)
+			for range stop - start + 1 {
+				res = append(res, ZSetElem{x.member, x.score})
+				x = x.backward
+			}
+			return res
+		}
+		x := zsl.byRank(start + 1)
+		for range stop - start + 1 {
+			res = append(res, ZSetElem{x.member, x.score})
+			x = x.next()
+		}
+		return res
+	}
+
+	var r zslRange = q.Score
+	if q.By == ZRangeByLex {
+		r = q.Lex
+	}
+	if q.Offset < 0 {
+		return res
+	}
+	var x *zslNode
+	if q.Rev {
+		x = zsl.lastInRange(r)
 	} else {
-		zSet = storeValAny.(StoreValue).v.(ZSetValue)
+		x = zsl.firstInRange(r)
+	}
+	if x != nil && q.Offset > 0 {
+		// jump over the offset by rank instead of walking
+		rank := zsl.rank(x.score, x.member)
+		if q.Rev {
+			rank -= q.Offset
+		} else {
+			rank += q.Offset
+		}
+		x = nil
+		if rank >= 1 {
+			x = zsl.byRank(rank)
+		}
+	}
+	for count := q.Count; x != nil && count != 0; count-- {
+		if q.Rev {
+			if !r.aboveMin(x) {
+				break
+			}
+			res = append(res, ZSetElem{x.member, x.score})
+			x = x.backward
+		} else {
+			if !r.belowMax(x) {
+				break
+			}
+			res = append(res, ZSetElem{x.member, x.score})
+			x = x.next()
+		}
 	}
-	return len(zSet.scores)
+	return res
 }
 
-// Get member's score. If existing, return float64. Else Return nil.
-func (kv *KVStore) ZScore(key string, member string) any {
-	storeValAny, ok := kv.mp.Load(key)
-	var zSet ZSetValue
+// count returns the number of members in r, from the ranks of its ends.
+func (zset ZSetValue) count(r zslRange) int {
+	first := zset.zsl.firstInRange(r)
+	if first == nil {
+		return 0
+	}
+	last := zset.zsl.lastInRange(r)
+	return zset.zsl.rank(last.score, last.member) - zset.zsl.rank(first.score, first.member) + 1
+}
+
+// ZRange returns the members selected by q, with their scores.
+func (kv *KVStore) ZRange(key string, q ZRangeQuery) ([]ZSetElem, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
 	if !ok {
-		return nil
-	} else {
-		zSet = storeValAny.(StoreValue).v.(ZSetValue)
+		return []ZSetElem{}, err
 	}
-	if score, ok := zSet.memToScore[member]; !ok {
-		return nil
-	} else {
+	return zSet.query(q), nil
+}
+
+// ZRangeStore stores the members of src selected by q in dst, replacing
+// it, and returns their number. An empty result deletes dst.
+func (kv *KVStore) ZRangeStore(dst, src string, q ZRangeQuery) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	zSet, ok, err := kv.getZSet(src)
+	if err != nil {
+		return 0, err
+	}
+	res := NewEmptyZSetValue()
+	if ok {
+		for _, elem := range zSet.query(q) {
+			res.add(elem.Member, elem.Score)
+		}
+	}
+	kv.delete(dst)
+	kv.storeZSet(dst, res)
+	// read before waking, blocked clients may pop from dst
+	n := res.card()
+	kv.wake(dst)
+	return n, nil
+}
+
+// ZCount returns the number of members with a score in r.
+func (kv *KVStore) ZCount(key string, r ZScoreRange) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return 0, err
+	}
+	return zSet.count(r), nil
+}
+
+// ZLexCount returns the number of members in the lexicographical range r.
+// Like in Redis, it is only meaningful when all scores are equal.
+func (kv *KVStore) ZLexCount(key string, r ZLexRange) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	zSet, ok, err := kv.getZSet(key)
+	if !ok {
+		return 0, err
+	}
+	return zSet.count(r), nil
+}
+
+// ZAggregate combines the scores of a member found in several inputs.
+type ZAggregate int
+
+const (
+	ZAggSum ZAggregate = iota
+	ZAggMin
+	ZAggMax
+)
+
+func (agg ZAggregate) combine(a, b float64) float64 {
+	switch agg {
+	case ZAggMin:
+		return min(a, b)
+	case ZAggMax:
+		return max(a, b)
+	}
+	// inf + -inf gives 0, like Redis
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// zsetInput is an input of ZUNION, ZINTER and ZDIFF: a sorted set, or a
+// plain set whose members all score 1. The zero value is a missing key.
+type zsetInput struct {
+	scores *dict[float64]
+	set    *SetValue
+}
+
+func (in zsetInput) card() int {
+	if in.set != nil {
+		return in.set.card()
+	}
+	return in.scores.len()
+}
+
+func (in zsetInput) score(member string) (float64, bool) {
+	if in.set != nil {
+		return 1, in.set.has(member)
+	}
+	return in.scores.get(member)
+}
+
+// all iterates over the members and their scores.
+func (in zsetInput) all() iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		if in.set == nil {
+			in.scores.all()(yield)
+			return
+		}
+		for member := range in.set.all() {
+			if !yield(member, 1) {
+				return
+			}
+		}
+	}
+}
+
+// zsetInputs returns the inputs at keys, failing on any other type.
+func (kv *KVStore) zsetInputs(keys []string) ([]zsetInput, error) {
+	inputs := make([]zsetInput, len(keys))
+	for i, key := range keys {
+		val, ok := kv.load(key)
+		if !ok {
+			continue
+		}
+		switch v := val.v.(type) {
+		case ZSetValue:
+			inputs[i].scores = v.memToScore
+		case SetValue:
+			inputs[i].set = &v
+		default:
+			return nil, ErrWrongType
+		}
+	}
+	return inputs, nil
+}
+
+// smallestInput returns the index of the input with the fewest members,
+// the one to iterate when intersecting.
+func smallestInput(inputs []zsetInput) int {
+	smallest := 0
+	for i := range inputs {
+		if inputs[i].card() < inputs[smallest].card() {
+			smallest = i
+		}
+	}
+	return smallest
+}
+
+// zsetAlgebra computes the union, intersection or difference of the inputs
+// at keys. The input scores are multiplied by weights, if any, and
+// combined with agg. The difference keeps the scores of the first input.
+func (kv *KVStore) zsetAlgebra(op SetOp, keys []string, weights []float64, agg ZAggregate) (ZSetValue, error) {
+	inputs, err := kv.zsetInputs(keys)
+	if err != nil {
+		return ZSetValue{}, err
+	}
+	weighted := func(i int, score float64) float64 {
+		if weights == nil {
+			return score
+		}
+		// 0 * inf gives 0, like Redis
+		if score *= weights[i]; math.IsNaN(score) {
+			return 0
+		}
 		return score
 	}
+
+	res := NewEmptyZSetValue()
+	switch op {
+	case SetUnion:
+		acc := make(map[string]float64)
+		for i, input := range inputs {
+			for member, score := range input.all() {
+				score = weighted(i, score)
+				if cur, ok := acc[member]; ok {
+					score = agg.combine(cur, score)
+				}
+				acc[member] = score
+			}
+		}
+		for member, score := range acc {
+			res.add(member, score)
+		}
+	case SetInter:
+		// iterate the smallest input, probe the others
+		smallest := smallestInput(inputs)
+		for member, score := range inputs[smallest].all() {
+			score = weighted(smallest, score)
+			inAll := true
+			for i := range inputs {
+				if i == smallest {
+					continue
+				}
+				other, ok := inputs[i].score(member)
+				if !ok {
+					inAll = false
+					break
+				}
+				score = agg.combine(score, weighted(i, other))
+			}
+			if inAll {
+				res.add(member, score)
+			}
+		}
+	default: // SetDiff
+		for member, score := range inputs[0].all() {
+			inOther := false
+			for i := 1; i < len(inputs); i++ {
+				if _, ok := inputs[i].score(member); ok {
+					inOther = true
+					break
+				}
+			}
+			if !inOther {
+				res.add(member, score)
+			}
+		}
+	}
+	return res, nil
+}
+
+// ZOp returns the result of ZUNION, ZINTER or ZDIFF ordered by score.
+func (kv *KVStore) ZOp(op SetOp, keys []string, weights []float64, agg ZAggregate) ([]ZSetElem, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	res, err := kv.zsetAlgebra(op, keys, weights, agg)
+	if err != nil {
+		return nil, err
+	}
+	return res.query(ZRangeQuery{Start: 0, Stop: -1}), nil
+}
+
+// ZOpStore stores the result of the operation in dst, overwriting it,
+// and returns its cardinality.
+func (kv *KVStore) ZOpStore(op SetOp, dst string, keys []string, weights []float64, agg ZAggregate) (int, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	res, err := kv.zsetAlgebra(op, keys, weights, agg)
+	if err != nil {
+		return 0, err
+	}
+	kv.delete(dst)
+	kv.storeZSet(dst, res)
+	n := res.card()
+	kv.wake(dst)
+	return n, nil
 }
 
-func (kv *KVStore) ZRem(key, member string) int {
-	storeValAny, ok := kv.mp.Load(key)
-	var newZSet ZSetValue
+// ZInterCard returns the cardinality of the intersection, stopping early
+// once limit is reached (0 means no limit).
+func (kv *KVStore) ZInterCard(keys []string, limit int) (int, error) {
+	kv.keyMu.RLock()
+	defer kv.keyMu.RUnlock()
+	inputs, err := kv.zsetInputs(keys)
+	if err != nil {
+		return 0, err
+	}
+	smallest := smallestInput(inputs)
+	cnt := 0
+	for member := range inputs[smallest].all() {
+		inAll := true
+		for i := range inputs {
+			if _, ok := inputs[i].score(member); i != smallest && !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			cnt++
+			if cnt == limit {
+				break
+			}
+		}
+	}
+	return cnt, nil
+}
+
+// zpop removes up to count members with the lowest scores, or the
+// highest with max, in pop order. The caller must hold keyMu.
+func (kv *KVStore) zpop(key string, count int, max bool) ([]ZSetElem, error) {
+	zSet, ok, err := kv.getZSet(key)
 	if !ok {
-		return 0
-	} else {
-		newZSet = storeValAny.(StoreValue).v.(ZSetValue)
+		return nil, err
 	}
-	if oldScore, ok := newZSet.memToScore[member]; !ok {
-		return 0
-	} else {
-		delete(newZSet.memToScore, member)
-		pos := LowerBound(newZSet.scores, ZSetElem{member, oldScore})
-		newZSet.scores = append(newZSet.scores[:pos], newZSet.scores[pos+1:]...)
-		kv.store(key, newZSet, ZSetType)
-		return 1
+	elems := make([]ZSetElem, 0, min(count, zSet.card()))
+	for len(elems) < cap(elems) {
+		x := zSet.zsl.first()
+		if max {
+			x = zSet.zsl.tail
+		}
+		elems = append(elems, ZSetElem{Member: x.member, Score: x.score})
+		zSet.remove(x.member)
+	}
+	kv.storeZSet(key, zSet)
+	return elems, nil
+}
+
+// ZPop implements ZPOPMIN and ZPOPMAX.
+func (kv *KVStore) ZPop(key string, count int, max bool) ([]ZSetElem, error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	return kv.zpop(key, count, max)
+}
+
+// ZMPop pops up to count members from the first non-empty sorted set of
+// keys, and returns its key. elems is empty when all keys are empty.
+func (kv *KVStore) ZMPop(keys []string, count int, max bool) (key string, elems []ZSetElem, err error) {
+	kv.keyMu.Lock()
+	defer kv.keyMu.Unlock()
+	for _, key := range keys {
+		elems, err := kv.zpop(key, count, max)
+		if len(elems) > 0 || err != nil {
+			return key, elems, err
+		}
 	}
+	return "", nil, nil
+}
+
+// BZMPop is ZMPop, but waits for one of the keys to receive members.
+// Clients blocked on the same key are served first come, first served.
+func (kv *KVStore) BZMPop(keys []string, count int, max bool, opts BlockOptions) (key string, elems []ZSetElem, err error) {
+	res, err := kv.blockingOp(keys, ZSetType, opts, func(db *KVStore, key string) (any, bool, error) {
+		elems, err := db.zpop(key, count, max)
+		if len(elems) == 0 {
+			return nil, false, err
+		}
+		opts.served(key, len(elems))
+		return keyedZSetElems{key, elems}, true, nil
+	})
+	if res == nil {
+		return "", nil, err
+	}
+	kze := res.(keyedZSetElems)
+	return kze.key, kze.elems, nil
+}
+
+type keyedZSetElems struct {
+	key   string
+	elems []ZSetElem
 }
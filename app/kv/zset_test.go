@@ -0,0 +1,719 @@
+package kv
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newZSet returns a store holding elems at "z".
+func newZSet(t *testing.T, elems ...ZSetElem) *KVStore {
+	t.Helper()
+	kv := NewKVStore()
+	if _, err := kv.ZAddMulti("z", elems, ZAddOptions{}); err != nil {
+		t.Fatalf("ZAddMulti: %v", err)
+	}
+	return kv
+}
+
+func members(elems []ZSetElem) []string {
+	res := make([]string, len(elems))
+	for i, e := range elems {
+		res[i] = e.Member
+	}
+	return res
+}
+
+func TestZSetEncoding(t *testing.T) {
+	kv := NewKVStore()
+	for i := range zsetMaxListpackEntries {
+		kv.ZAdd("z", strconv.Itoa(i), float64(i))
+	}
+	if enc, _ := kv.ObjectEncoding("z"); enc != "listpack" {
+		t.Errorf("encoding of %d members = %s, want listpack", zsetMaxListpackEntries, enc)
+	}
+	kv.ZAdd("z", "one more", 0)
+	if enc, _ := kv.ObjectEncoding("z"); enc != "skiplist" {
+		t.Errorf("encoding of %d members = %s, want skiplist", zsetMaxListpackEntries+1, enc)
+	}
+
+	kv.ZAdd("long", strings.Repeat("x", zsetMaxListpackValue+1), 1)
+	if enc, _ := kv.ObjectEncoding("long"); enc != "skiplist" {
+		t.Errorf("encoding with a long member = %s, want skiplist", enc)
+	}
+}
+
+// Ranks follow score updates, ties being ordered by member.
+func TestZRank(t *testing.T) {
+	kv := NewKVStore()
+	scores := map[string]float64{}
+	rng := rand.New(rand.NewSource(1))
+	for range 3000 {
+		member := strconv.Itoa(rng.Intn(1000))
+		score := float64(rng.Intn(100))
+		kv.ZAdd("z", member, score)
+		scores[member] = score
+	}
+	var sorted []ZSetElem
+	for member, score := range scores {
+		sorted = append(sorted, ZSetElem{member, score})
+	}
+	slices.SortFunc(sorted, func(a, b ZSetElem) int {
+		return compareEntries(zslEntry{a.Score, a.Member}, zslEntry{b.Score, b.Member})
+	})
+
+	for i, e := range sorted {
+		rank, score, ok, _ := kv.ZRank("z", e.Member, false)
+		if rank != i || score != e.Score || !ok {
+			t.Fatalf("ZRank(%s) = %d, %v, %v, want %d, %v", e.Member, rank, score, ok, i, e.Score)
+		}
+		if rank, _, _, _ := kv.ZRank("z", e.Member, true); rank != len(sorted)-1-i {
+			t.Fatalf("ZRank(%s, rev) = %d, want %d", e.Member, rank, len(sorted)-1-i)
+		}
+	}
+	if _, _, ok, err := kv.ZRank("z", "missing", false); ok || err != nil {
+		t.Errorf("ZRank of a missing member = %v, %v", ok, err)
+	}
+	if _, _, ok, err := kv.ZRank("missing", "a", false); ok || err != nil {
+		t.Errorf("ZRank of a missing key = %v, %v", ok, err)
+	}
+
+	got, _ := kv.ZRange("z", ZRangeQuery{Start: 100, Stop: 199})
+	if !slices.Equal(got, sorted[100:200]) {
+		t.Errorf("ZRange 100 199 differs from the sorted members")
+	}
+}
+
+func TestZRangeByRank(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 1}, ZSetElem{"b", 2}, ZSetElem{"c", 3}, ZSetElem{"d", 4})
+	tests := []struct {
+		start, stop int
+		rev         bool
+		want        []string
+	}{
+		{0, -1, false, []string{"a", "b", "c", "d"}},
+		{1, 2, false, []string{"b", "c"}},
+		{-2, -1, false, []string{"c", "d"}},
+		{-100, 0, false, []string{"a"}},
+		{2, 100, false, []string{"c", "d"}},
+		{0, 1, true, []string{"d", "c"}},
+		{-1, -1, true, []string{"a"}},
+		{3, 1, false, []string{}},
+		{4, 10, false, []string{}},
+		{0, -5, false, []string{}},
+	}
+	for _, tt := range tests {
+		got, _ := kv.ZRange("z", ZRangeQuery{Start: tt.start, Stop: tt.stop, Rev: tt.rev})
+		if !slices.Equal(members(got), tt.want) {
+			t.Errorf("ZRange(%d, %d, rev %v) = %q, want %q", tt.start, tt.stop, tt.rev, members(got), tt.want)
+		}
+	}
+}
+
+// A copied sorted set has its own skiplist.
+func TestZSetCopy(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 1}, ZSetElem{"b", 2})
+	kv.Copy("z", kv, "c", false)
+	kv.ZAdd("c", "a", 3)
+	kv.ZAdd("c", "new", 0)
+	if rank, _, _, _ := kv.ZRank("z", "a", false); rank != 0 {
+		t.Errorf("ZRank in the source after updating the copy = %d, want 0", rank)
+	}
+	if n, _ := kv.ZCard("z"); n != 2 {
+		t.Errorf("ZCard of the source = %d, want 2", n)
+	}
+	got, _ := kv.ZRange("c", ZRangeQuery{Start: 0, Stop: -1})
+	if want := []string{"new", "b", "a"}; !slices.Equal(members(got), want) {
+		t.Errorf("copy = %q, want %q", members(got), want)
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	scoreTests := []struct {
+		min, max string
+		want     ZScoreRange
+		err      error
+	}{
+		{"1", "2", ZScoreRange{Min: 1, Max: 2}, nil},
+		{"(1.5", "(2", ZScoreRange{Min: 1.5, Max: 2, MinEx: true, MaxEx: true}, nil},
+		{"-inf", "+inf", ZScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, nil},
+		{"a", "1", ZScoreRange{}, ErrMinMaxNotFloat},
+		{"1", "(", ZScoreRange{}, ErrMinMaxNotFloat},
+		{"nan", "1", ZScoreRange{}, ErrMinMaxNotFloat},
+		{"[1", "2", ZScoreRange{}, ErrMinMaxNotFloat},
+	}
+	for _, tt := range scoreTests {
+		got, err := ParseScoreRange(tt.min, tt.max)
+		if err != tt.err || (err == nil && got != tt.want) {
+			t.Errorf("ParseScoreRange(%q, %q) = %+v, %v, want %+v, %v", tt.min, tt.max, got, err, tt.want, tt.err)
+		}
+	}
+
+	for _, tt := range []struct {
+		min, max string
+		err      error
+	}{
+		{"[a", "(b", nil},
+		{"-", "+", nil},
+		{"[", "(", nil},
+		{"a", "[b", ErrMinMaxNotLex},
+		{"[a", "", ErrMinMaxNotLex},
+		{"-a", "+", ErrMinMaxNotLex},
+	} {
+		if _, err := ParseLexRange(tt.min, tt.max); err != tt.err {
+			t.Errorf("ParseLexRange(%q, %q) error = %v, want %v", tt.min, tt.max, err, tt.err)
+		}
+	}
+}
+
+func scoreRange(t *testing.T, min, max string) ZScoreRange {
+	t.Helper()
+	r, err := ParseScoreRange(min, max)
+	if err != nil {
+		t.Fatalf("ParseScoreRange(%q, %q): %v", min, max, err)
+	}
+	return r
+}
+
+func lexRange(t *testing.T, min, max string) ZLexRange {
+	t.Helper()
+	r, err := ParseLexRange(min, max)
+	if err != nil {
+		t.Fatalf("ParseLexRange(%q, %q): %v", min, max, err)
+	}
+	return r
+}
+
+func TestZRangeByScore(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 1}, ZSetElem{"b", 2}, ZSetElem{"c", 2}, ZSetElem{"d", 3}, ZSetElem{"e", 4})
+	tests := []struct {
+		min, max      string
+		rev           bool
+		offset, count int
+		want          []string
+	}{
+		{"-inf", "+inf", false, 0, -1, []string{"a", "b", "c", "d", "e"}},
+		{"2", "3", false, 0, -1, []string{"b", "c", "d"}},
+		{"(2", "3", false, 0, -1, []string{"d"}},
+		{"2", "(3", false, 0, -1, []string{"b", "c"}},
+		{"1.5", "2.5", true, 0, -1, []string{"c", "b"}},
+		{"-inf", "+inf", true, 0, -1, []string{"e", "d", "c", "b", "a"}},
+		{"-inf", "+inf", false, 1, 2, []string{"b", "c"}},
+		{"-inf", "+inf", true, 1, 2, []string{"d", "c"}},
+		{"2", "4", false, 2, -1, []string{"d", "e"}},
+		{"2", "4", false, 10, -1, []string{}},
+		{"2", "4", false, 0, 0, []string{}},
+		{"2", "4", false, -1, 1, []string{}},
+		{"5", "+inf", false, 0, -1, []string{}},
+		{"3", "2", false, 0, -1, []string{}},
+		{"(2", "2", false, 0, -1, []string{}},
+	}
+	for _, tt := range tests {
+		q := ZRangeQuery{By: ZRangeByScore, Score: scoreRange(t, tt.min, tt.max), Rev: tt.rev, Offset: tt.offset, Count: tt.count}
+		got, _ := kv.ZRange("z", q)
+		if !slices.Equal(members(got), tt.want) {
+			t.Errorf("ZRange BYSCORE %s %s rev %v limit %d %d = %q, want %q", tt.min, tt.max, tt.rev, tt.offset, tt.count, members(got), tt.want)
+		}
+	}
+}
+
+func TestZRangeByLex(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 0}, ZSetElem{"b", 0}, ZSetElem{"ba", 0}, ZSetElem{"c", 0}, ZSetElem{"d", 0})
+	tests := []struct {
+		min, max      string
+		rev           bool
+		offset, count int
+		want          []string
+	}{
+		{"-", "+", false, 0, -1, []string{"a", "b", "ba", "c", "d"}},
+		{"[b", "[c", false, 0, -1, []string{"b", "ba", "c"}},
+		{"(b", "(c", false, 0, -1, []string{"ba"}},
+		{"[b", "(b\xff", false, 0, -1, []string{"b", "ba"}},
+		{"-", "(b", false, 0, -1, []string{"a"}},
+		{"[c", "+", true, 0, -1, []string{"d", "c"}},
+		{"-", "+", true, 1, 2, []string{"c", "ba"}},
+		{"[", "[a", false, 0, -1, []string{"a"}},
+		{"+", "-", false, 0, -1, []string{}},
+		{"[c", "[b", false, 0, -1, []string{}},
+		{"(a", "[a", false, 0, -1, []string{}},
+		{"+", "+", false, 0, -1, []string{}},
+	}
+	for _, tt := range tests {
+		q := ZRangeQuery{By: ZRangeByLex, Lex: lexRange(t, tt.min, tt.max), Rev: tt.rev, Offset: tt.offset, Count: tt.count}
+		got, _ := kv.ZRange("z", q)
+		if !slices.Equal(members(got), tt.want) {
+			t.Errorf("ZRange BYLEX %q %q rev %v limit %d %d = %q, want %q", tt.min, tt.max, tt.rev, tt.offset, tt.count, members(got), tt.want)
+		}
+		if !tt.rev && tt.offset == 0 {
+			if n, _ := kv.ZLexCount("z", q.Lex); n != len(tt.want) {
+				t.Errorf("ZLexCount %q %q = %d, want %d", tt.min, tt.max, n, len(tt.want))
+			}
+		}
+	}
+}
+
+// ZCount, computed from ranks, matches counting the members one by one.
+func TestZCount(t *testing.T) {
+	kv := NewKVStore()
+	rng := rand.New(rand.NewSource(1))
+	var scores []float64
+	for i := range 500 {
+		score := float64(rng.Intn(100))
+		kv.ZAdd("z", strconv.Itoa(i), score)
+		scores = append(scores, score)
+	}
+	for range 200 {
+		r := ZScoreRange{Min: float64(rng.Intn(110) - 5), Max: float64(rng.Intn(110) - 5), MinEx: rng.Intn(2) == 0, MaxEx: rng.Intn(2) == 0}
+		want := 0
+		for _, score := range scores {
+			if (score > r.Min || !r.MinEx && score == r.Min) && (score < r.Max || !r.MaxEx && score == r.Max) {
+				want++
+			}
+		}
+		if got, _ := kv.ZCount("z", r); got != want {
+			t.Fatalf("ZCount(%+v) = %d, want %d", r, got, want)
+		}
+	}
+	if n, err := kv.ZCount("missing", ZScoreRange{Max: 1}); n != 0 || err != nil {
+		t.Errorf("ZCount of a missing key = %d, %v", n, err)
+	}
+}
+
+func TestZRangeStore(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 1}, ZSetElem{"b", 2}, ZSetElem{"c", 3})
+	kv.Set("dst", "string")
+	n, err := kv.ZRangeStore("dst", "z", ZRangeQuery{By: ZRangeByScore, Score: scoreRange(t, "(1", "+inf"), Count: -1})
+	if n != 2 || err != nil {
+		t.Fatalf("ZRangeStore = %d, %v, want 2", n, err)
+	}
+	got, _ := kv.ZRange("dst", ZRangeQuery{Start: 0, Stop: -1})
+	if want := []ZSetElem{{"b", 2}, {"c", 3}}; !slices.Equal(got, want) {
+		t.Errorf("stored range = %v, want %v", got, want)
+	}
+
+	if n, _ := kv.ZRangeStore("dst", "z", ZRangeQuery{Start: 5, Stop: 10}); n != 0 || kv.Exists("dst") != 0 {
+		t.Errorf("empty ZRangeStore = %d, dst exists %d", n, kv.Exists("dst"))
+	}
+	if n, _ := kv.ZRangeStore("dst", "missing", ZRangeQuery{Start: 0, Stop: -1}); n != 0 || kv.Exists("dst") != 0 {
+		t.Errorf("ZRangeStore from a missing key = %d, dst exists %d", n, kv.Exists("dst"))
+	}
+	kv.Set("s", "v")
+	if _, err := kv.ZRangeStore("dst", "s", ZRangeQuery{}); err != ErrWrongType {
+		t.Errorf("ZRangeStore from a string error = %v", err)
+	}
+}
+
+func TestZAddOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  ZAddOptions
+		score float64 // the new score of "a", which has 5
+		n     int
+		a     float64 // the resulting score of "a"
+		added bool    // whether "new" was added
+	}{
+		{"plain", ZAddOptions{}, 7, 1, 7, true},
+		{"CH", ZAddOptions{CH: true}, 7, 2, 7, true},
+		{"CH same score", ZAddOptions{CH: true}, 5, 1, 5, true},
+		{"NX", ZAddOptions{NX: true}, 7, 1, 5, true},
+		{"XX", ZAddOptions{XX: true}, 7, 0, 7, false},
+		{"XX CH", ZAddOptions{XX: true, CH: true}, 7, 1, 7, false},
+		{"GT higher", ZAddOptions{GT: true, CH: true}, 7, 2, 7, true},
+		{"GT lower", ZAddOptions{GT: true, CH: true}, 3, 1, 5, true},
+		{"LT lower", ZAddOptions{LT: true, CH: true}, 3, 2, 3, true},
+		{"LT higher", ZAddOptions{LT: true, CH: true}, 7, 1, 5, true},
+		{"XX GT", ZAddOptions{XX: true, GT: true, CH: true}, 7, 1, 7, false},
+		{"inf", ZAddOptions{}, math.Inf(-1), 1, math.Inf(-1), true},
+	}
+	for _, tt := range tests {
+		kv := newZSet(t, ZSetElem{"a", 5})
+		n, err := kv.ZAddMulti("z", []ZSetElem{{"a", tt.score}, {"new", 1}}, tt.opts)
+		if n != tt.n || err != nil {
+			t.Errorf("%s: ZAddMulti = %d, %v, want %d", tt.name, n, err, tt.n)
+		}
+		if a, _ := kv.ZScore("z", "a"); a != tt.a {
+			t.Errorf("%s: score of a = %v, want %v", tt.name, a, tt.a)
+		}
+		if _, _, added, _ := kv.ZRank("z", "new", false); added != tt.added {
+			t.Errorf("%s: new member added = %v, want %v", tt.name, added, tt.added)
+		}
+	}
+
+	kv := NewKVStore()
+	if n, _ := kv.ZAddMulti("z", []ZSetElem{{"a", 1}}, ZAddOptions{XX: true}); n != 0 || kv.Exists("z") != 0 {
+		t.Errorf("ZAddMulti XX on a missing key = %d, exists %d", n, kv.Exists("z"))
+	}
+	// the last score of a repeated member wins
+	kv.ZAddMulti("z", []ZSetElem{{"a", 1}, {"a", 2}}, ZAddOptions{})
+	if a, _ := kv.ZScore("z", "a"); a != 2.0 {
+		t.Errorf("score of a member added twice = %v, want 2", a)
+	}
+}
+
+func TestZIncrBy(t *testing.T) {
+	kv := NewKVStore()
+	if got, _ := kv.ZIncrBy("z", "a", 2.5, ZAddOptions{}); got != 2.5 {
+		t.Errorf("ZIncrBy of a new member = %v, want 2.5", got)
+	}
+	if got, _ := kv.ZIncrBy("z", "a", -1, ZAddOptions{}); got != 1.5 {
+		t.Errorf("ZIncrBy = %v, want 1.5", got)
+	}
+	if got, _ := kv.ZIncrBy("z", "a", 1, ZAddOptions{LT: true}); got != nil {
+		t.Errorf("ZIncrBy LT growing the score = %v, want nil", got)
+	}
+	if got, _ := kv.ZIncrBy("z", "a", 1, ZAddOptions{GT: true}); got != 2.5 {
+		t.Errorf("ZIncrBy GT = %v, want 2.5", got)
+	}
+	if got, _ := kv.ZIncrBy("z", "b", 1, ZAddOptions{XX: true}); got != nil {
+		t.Errorf("ZIncrBy XX of a new member = %v, want nil", got)
+	}
+	if got, _ := kv.ZIncrBy("z", "a", 1, ZAddOptions{NX: true}); got != nil {
+		t.Errorf("ZIncrBy NX of an existing member = %v, want nil", got)
+	}
+	if got, _ := kv.ZIncrBy("missing", "a", 1, ZAddOptions{XX: true}); got != nil || kv.Exists("missing") != 0 {
+		t.Errorf("ZIncrBy XX on a missing key = %v, exists %d", got, kv.Exists("missing"))
+	}
+
+	kv.ZIncrBy("z", "inf", math.Inf(1), ZAddOptions{})
+	if _, err := kv.ZIncrBy("z", "inf", math.Inf(-1), ZAddOptions{}); err != ErrScoreNaN {
+		t.Errorf("ZIncrBy to NaN error = %v, want %v", err, ErrScoreNaN)
+	}
+	if got, _ := kv.ZScore("z", "inf"); got != math.Inf(1) {
+		t.Errorf("score after a NaN increment = %v, want +inf", got)
+	}
+
+	// the member moves in the order
+	kv.ZAdd("z", "b", 10)
+	kv.ZIncrBy("z", "a", 10, ZAddOptions{})
+	got, _ := kv.ZRange("z", ZRangeQuery{Start: 0, Stop: -1})
+	if want := []string{"b", "a", "inf"}; !slices.Equal(members(got), want) {
+		t.Errorf("order after ZIncrBy = %q, want %q", members(got), want)
+	}
+}
+
+func TestZOp(t *testing.T) {
+	kv := NewKVStore()
+	kv.ZAddMulti("a", []ZSetElem{{"x", 1}, {"y", 2}, {"z", 3}}, ZAddOptions{})
+	kv.ZAddMulti("b", []ZSetElem{{"y", 10}, {"z", 20}, {"w", 30}}, ZAddOptions{})
+	kv.SAdd("s", []string{"z", "w", "v"})
+	inf := math.Inf(1)
+	kv.ZAddMulti("inf", []ZSetElem{{"x", inf}, {"y", -inf}}, ZAddOptions{})
+	kv.ZAddMulti("ninf", []ZSetElem{{"x", -inf}}, ZAddOptions{})
+
+	tests := []struct {
+		name    string
+		op      SetOp
+		keys    []string
+		weights []float64
+		agg     ZAggregate
+		want    []ZSetElem
+	}{
+		{"union", SetUnion, []string{"a", "b"}, nil, ZAggSum, []ZSetElem{{"x", 1}, {"y", 12}, {"z", 23}, {"w", 30}}},
+		{"union min", SetUnion, []string{"a", "b"}, nil, ZAggMin, []ZSetElem{{"x", 1}, {"y", 2}, {"z", 3}, {"w", 30}}},
+		{"union max", SetUnion, []string{"a", "b"}, nil, ZAggMax, []ZSetElem{{"x", 1}, {"y", 10}, {"z", 20}, {"w", 30}}},
+		{"union weights", SetUnion, []string{"a", "b"}, []float64{2, -1}, ZAggSum, []ZSetElem{{"w", -30}, {"z", -14}, {"y", -6}, {"x", 2}}},
+		{"union missing", SetUnion, []string{"missing", "a"}, nil, ZAggSum, []ZSetElem{{"x", 1}, {"y", 2}, {"z", 3}}},
+		{"union set", SetUnion, []string{"a", "s"}, nil, ZAggSum, []ZSetElem{{"v", 1}, {"w", 1}, {"x", 1}, {"y", 2}, {"z", 4}}},
+		{"inter", SetInter, []string{"a", "b"}, nil, ZAggSum, []ZSetElem{{"y", 12}, {"z", 23}}},
+		{"inter max", SetInter, []string{"a", "b"}, nil, ZAggMax, []ZSetElem{{"y", 10}, {"z", 20}}},
+		{"inter set weights", SetInter, []string{"b", "s"}, []float64{1, 5}, ZAggSum, []ZSetElem{{"z", 25}, {"w", 35}}},
+		{"inter missing", SetInter, []string{"a", "missing"}, nil, ZAggSum, []ZSetElem{}},
+		{"inter same key", SetInter, []string{"a", "a"}, nil, ZAggSum, []ZSetElem{{"x", 2}, {"y", 4}, {"z", 6}}},
+		{"diff", SetDiff, []string{"a", "b"}, nil, ZAggSum, []ZSetElem{{"x", 1}}},
+		{"diff set", SetDiff, []string{"b", "s"}, nil, ZAggSum, []ZSetElem{{"y", 10}}},
+		{"diff missing first", SetDiff, []string{"missing", "a"}, nil, ZAggSum, []ZSetElem{}},
+		{"inf plus -inf", SetUnion, []string{"inf", "ninf"}, nil, ZAggSum, []ZSetElem{{"y", -inf}, {"x", 0}}},
+		{"inf times 0", SetUnion, []string{"inf"}, []float64{0}, ZAggSum, []ZSetElem{{"x", 0}, {"y", 0}}},
+	}
+	for _, tt := range tests {
+		got, err := kv.ZOp(tt.op, tt.keys, tt.weights, tt.agg)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: ZOp = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	kv.Set("str", "v")
+	if _, err := kv.ZOp(SetUnion, []string{"a", "str"}, nil, ZAggSum); err != ErrWrongType {
+		t.Errorf("ZOp with a string input error = %v", err)
+	}
+}
+
+func TestZOpStore(t *testing.T) {
+	kv := NewKVStore()
+	kv.ZAddMulti("a", []ZSetElem{{"x", 1}, {"y", 2}}, ZAddOptions{})
+	kv.ZAddMulti("b", []ZSetElem{{"y", 3}}, ZAddOptions{})
+
+	// the destination may be one of the inputs
+	if n, err := kv.ZOpStore(SetUnion, "a", []string{"a", "b"}, nil, ZAggSum); n != 2 || err != nil {
+		t.Fatalf("ZOpStore = %d, %v, want 2", n, err)
+	}
+	got, _ := kv.ZRange("a", ZRangeQuery{Start: 0, Stop: -1})
+	if want := []ZSetElem{{"x", 1}, {"y", 5}}; !slices.Equal(got, want) {
+		t.Errorf("stored union = %v, want %v", got, want)
+	}
+
+	// an empty result deletes the destination, whatever its type
+	kv.Set("dst", "v")
+	if n, _ := kv.ZOpStore(SetDiff, "dst", []string{"b", "a"}, nil, ZAggSum); n != 0 || kv.Exists("dst") != 0 {
+		t.Errorf("empty ZOpStore = %d, dst exists %d", n, kv.Exists("dst"))
+	}
+
+	// a failing input leaves the destination alone
+	kv.Set("str", "v")
+	if _, err := kv.ZOpStore(SetUnion, "a", []string{"str"}, nil, ZAggSum); err != ErrWrongType {
+		t.Errorf("ZOpStore with a string input error = %v", err)
+	}
+	if n, _ := kv.ZCard("a"); n != 2 {
+		t.Errorf("destination changed by a failed ZOpStore, %d members", n)
+	}
+}
+
+func TestZInterCard(t *testing.T) {
+	kv := NewKVStore()
+	var elems []ZSetElem
+	for i := range 100 {
+		elems = append(elems, ZSetElem{strconv.Itoa(i), float64(i)})
+	}
+	kv.ZAddMulti("a", elems, ZAddOptions{})
+	kv.ZAddMulti("b", elems[50:], ZAddOptions{})
+	kv.SAdd("s", numbers(60))
+	tests := []struct {
+		keys  []string
+		limit int
+		want  int
+	}{
+		{[]string{"a", "b"}, 0, 50},
+		{[]string{"a", "b", "s"}, 0, 10},
+		{[]string{"a", "b"}, 20, 20},
+		{[]string{"a", "b"}, 500, 50},
+		{[]string{"a", "missing"}, 0, 0},
+		{[]string{"s"}, 0, 60},
+	}
+	for _, tt := range tests {
+		if got, err := kv.ZInterCard(tt.keys, tt.limit); got != tt.want || err != nil {
+			t.Errorf("ZInterCard(%v, %d) = %d, %v, want %d", tt.keys, tt.limit, got, err, tt.want)
+		}
+	}
+}
+
+func TestZPop(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 1}, ZSetElem{"b", 2}, ZSetElem{"c", 3}, ZSetElem{"d", 4})
+	if got, _ := kv.ZPop("z", 1, false); !slices.Equal(got, []ZSetElem{{"a", 1}}) {
+		t.Errorf("ZPop min = %v", got)
+	}
+	if got, _ := kv.ZPop("z", 2, true); !slices.Equal(got, []ZSetElem{{"d", 4}, {"c", 3}}) {
+		t.Errorf("ZPop max 2 = %v", got)
+	}
+	if got, _ := kv.ZPop("z", 0, false); got == nil || len(got) != 0 {
+		t.Errorf("ZPop 0 = %#v, want an empty slice", got)
+	}
+	if got, _ := kv.ZPop("z", 10, false); !slices.Equal(got, []ZSetElem{{"b", 2}}) {
+		t.Errorf("ZPop 10 = %v", got)
+	}
+	if kv.Exists("z") != 0 {
+		t.Errorf("popping the last member left the key")
+	}
+	if got, err := kv.ZPop("z", 1, false); got != nil || err != nil {
+		t.Errorf("ZPop of a missing key = %#v, %v, want nil", got, err)
+	}
+	kv.Set("s", "v")
+	if _, err := kv.ZPop("s", 1, false); err != ErrWrongType {
+		t.Errorf("ZPop of a string error = %v", err)
+	}
+}
+
+func TestZMPop(t *testing.T) {
+	kv := NewKVStore()
+	kv.ZAddMulti("b", []ZSetElem{{"x", 1}, {"y", 2}, {"z", 3}}, ZAddOptions{})
+	kv.ZAddMulti("c", []ZSetElem{{"w", 1}}, ZAddOptions{})
+	key, elems, _ := kv.ZMPop([]string{"a", "b", "c"}, 2, true)
+	if key != "b" || !slices.Equal(elems, []ZSetElem{{"z", 3}, {"y", 2}}) {
+		t.Errorf("ZMPop = %s %v", key, elems)
+	}
+	if key, elems, _ := kv.ZMPop([]string{"a", "missing"}, 1, false); key != "" || elems != nil {
+		t.Errorf("ZMPop of missing keys = %q %v", key, elems)
+	}
+	kv.Set("s", "v")
+	if _, _, err := kv.ZMPop([]string{"s", "b"}, 1, false); err != ErrWrongType {
+		t.Errorf("ZMPop with a string first error = %v", err)
+	}
+}
+
+func bzpop(kv *KVStore, max bool, keys ...string) <-chan any {
+	return blockOn(func() any {
+		key, elems, err := kv.BZMPop(keys, 1, max, BlockOptions{})
+		if err != nil {
+			return err
+		}
+		if elems == nil {
+			return nil
+		}
+		return key + ":" + elems[0].Member
+	})
+}
+
+// Every write that may add members serves the clients blocked on the key.
+func TestBZMPop(t *testing.T) {
+	kv := NewKVStore()
+	kv.ZAdd("src", "m", 1)
+	writes := []struct {
+		name  string
+		write func()
+		want  string
+	}{
+		{"ZAdd", func() { kv.ZAdd("k", "a", 1) }, "k:a"},
+		{"ZAddMulti", func() { kv.ZAddMulti("k", []ZSetElem{{"b", 2}, {"c", 1}}, ZAddOptions{}) }, "k:c"},
+		{"ZIncrBy", func() { kv.ZIncrBy("k", "d", 1, ZAddOptions{}) }, "k:d"},
+		{"ZOpStore", func() { kv.ZOpStore(SetUnion, "k", []string{"src"}, nil, ZAggSum) }, "k:m"},
+		{"ZRangeStore", func() { kv.ZRangeStore("k", "src", ZRangeQuery{Start: 0, Stop: -1}) }, "k:m"},
+	}
+	for _, tt := range writes {
+		kv.Del("k")
+		done := bzpop(kv, false, "other", "k")
+		tt.write()
+		if got := waitFor(t, done); got != tt.want {
+			t.Errorf("%s: BZMPop = %v, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// clients are served in the order they blocked, from the end asked
+	kv.Del("k")
+	first := bzpop(kv, true, "k")
+	second := bzpop(kv, false, "k")
+	kv.ZAddMulti("k", []ZSetElem{{"lo", 1}, {"mid", 2}, {"hi", 3}}, ZAddOptions{})
+	if got := waitFor(t, first); got != "k:hi" {
+		t.Errorf("first client = %v, want k:hi", got)
+	}
+	if got := waitFor(t, second); got != "k:lo" {
+		t.Errorf("second client = %v, want k:lo", got)
+	}
+	if n, _ := kv.ZCard("k"); n != 1 {
+		t.Errorf("ZCard after serving two clients = %d, want 1", n)
+	}
+
+	// a list pushed to the key doesn't serve a sorted set client
+	kv.Del("k")
+	done := bzpop(kv, false, "k")
+	kv.RPush("k", []string{"x"})
+	select {
+	case got := <-done:
+		t.Fatalf("BZMPop served by a list with %v", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	kv.Del("k")
+	kv.ZAdd("k", "z", 0)
+	if got := waitFor(t, done); got != "k:z" {
+		t.Errorf("BZMPop = %v, want k:z", got)
+	}
+
+	_, elems, err := kv.BZMPop([]string{"missing"}, 1, false, BlockOptions{Timeout: 10 * time.Millisecond})
+	if elems != nil || err != nil {
+		t.Errorf("BZMPop timing out = %v, %v", elems, err)
+	}
+}
+
+func TestZMScore(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 1}, ZSetElem{"b", 2.5})
+	got, _ := kv.ZMScore("z", []string{"b", "missing", "a"})
+	if want := []any{2.5, nil, 1.0}; !slices.Equal(got, want) {
+		t.Errorf("ZMScore = %v, want %v", got, want)
+	}
+	got, err := kv.ZMScore("missing", []string{"a", "b"})
+	if want := []any{nil, nil}; !slices.Equal(got, want) || err != nil {
+		t.Errorf("ZMScore of a missing key = %v, %v, want %v", got, err, want)
+	}
+	kv.Set("s", "v")
+	if _, err := kv.ZMScore("s", []string{"a"}); err != ErrWrongType {
+		t.Errorf("ZMScore of a string error = %v", err)
+	}
+}
+
+func TestZRem(t *testing.T) {
+	kv := newZSet(t, ZSetElem{"a", 1}, ZSetElem{"b", 2}, ZSetElem{"c", 3})
+	if n, _ := kv.ZRem("z", []string{"a", "missing", "c", "a"}); n != 2 {
+		t.Errorf("ZRem = %d, want 2", n)
+	}
+	got, _ := kv.ZRange("z", ZRangeQuery{Start: 0, Stop: -1})
+	if !slices.Equal(members(got), []string{"b"}) {
+		t.Errorf("members after ZRem = %q", members(got))
+	}
+	if n, _ := kv.ZRem("z", []string{"b"}); n != 1 || kv.Exists("z") != 0 {
+		t.Errorf("removing the last member = %d, key left %v", n, kv.Exists("z") != 0)
+	}
+	if n, err := kv.ZRem("z", []string{"a"}); n != 0 || err != nil {
+		t.Errorf("ZRem of a missing key = %d, %v", n, err)
+	}
+}
+
+func TestZRemRange(t *testing.T) {
+	elems := []ZSetElem{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}, {"e", 5}}
+	tests := []struct {
+		name string
+		q    ZRangeQuery
+		n    int
+		left []string
+	}{
+		{"rank", ZRangeQuery{Start: 1, Stop: -2}, 3, []string{"a", "e"}},
+		{"rank out of range", ZRangeQuery{Start: 5, Stop: 10}, 0, []string{"a", "b", "c", "d", "e"}},
+		{"score", ZRangeQuery{By: ZRangeByScore, Score: scoreRange(t, "(2", "4")}, 2, []string{"a", "b", "e"}},
+		{"lex", ZRangeQuery{By: ZRangeByLex, Lex: lexRange(t, "-", "[b")}, 2, []string{"c", "d", "e"}},
+	}
+	for _, tt := range tests {
+		tt.q.Count = -1
+		kv := newZSet(t, elems...)
+		if n, _ := kv.ZRemRange("z", tt.q); n != tt.n {
+			t.Errorf("%s: ZRemRange = %d, want %d", tt.name, n, tt.n)
+		}
+		got, _ := kv.ZRange("z", ZRangeQuery{Start: 0, Stop: -1})
+		if !slices.Equal(members(got), tt.left) {
+			t.Errorf("%s: members left = %q, want %q", tt.name, members(got), tt.left)
+		}
+	}
+
+	kv := newZSet(t, elems...)
+	if n, _ := kv.ZRemRange("z", ZRangeQuery{Start: 0, Stop: -1, Count: -1}); n != 5 || kv.Exists("z") != 0 {
+		t.Errorf("removing every member = %d, key left %v", n, kv.Exists("z") != 0)
+	}
+}
+
+func TestZRandMember(t *testing.T) {
+	var elems []ZSetElem
+	for i, s := range numbers(10) {
+		elems = append(elems, ZSetElem{s, float64(i)})
+	}
+	kv := newZSet(t, elems...)
+	valid := func(e ZSetElem) bool {
+		i, err := strconv.Atoi(e.Member)
+		return err == nil && e.Score == float64(i) && i < 10
+	}
+
+	for _, count := range []int{1, 3, 10, 20} {
+		got, _ := kv.ZRandMember("z", count)
+		if len(got) != min(count, 10) {
+			t.Errorf("ZRandMember(%d) returned %d members", count, len(got))
+		}
+		seen := map[string]bool{}
+		for _, e := range got {
+			if !valid(e) || seen[e.Member] {
+				t.Errorf("ZRandMember(%d) returned %v twice or invalid", count, e)
+			}
+			seen[e.Member] = true
+		}
+	}
+	got, _ := kv.ZRandMember("z", -30)
+	if len(got) != 30 {
+		t.Errorf("ZRandMember(-30) returned %d members", len(got))
+	}
+	for _, e := range got {
+		if !valid(e) {
+			t.Errorf("ZRandMember(-30) returned %v", e)
+		}
+	}
+	if got, err := kv.ZRandMember("missing", 5); len(got) != 0 || err != nil {
+		t.Errorf("ZRandMember of a missing key = %v, %v", got, err)
+	}
+}
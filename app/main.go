@@ -20,6 +20,7 @@ func main() {
 	replicaof := flag.String("replicaof", "", "replication of")
 	dir := flag.String("dir", "", "directory where RDB file is stored")
 	dbfilename := flag.String("dbfilename", "", "the name of RDB file")
+	databases := flag.Int("databases", 16, "number of logical databases")
 
 	flag.Parse()
 
@@ -40,6 +41,7 @@ func main() {
 		*replicaof,
 		*dir,
 		*dbfilename,
+		max(*databases, 1),
 	)
 
 	s.Run()
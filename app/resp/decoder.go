@@ -2,62 +2,266 @@ package resp
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+const (
+	maxMultibulkLen = 1024 * 1024       // Max number of elements in a request array
+	maxBulkLen      = 512 * 1024 * 1024 // Max size of a single bulk string (512MB)
+	maxInlineLen    = 64 * 1024         // Max size of an inline request, or of a header line
+	bulkReadChunk   = 32 * 1024         // Initial buffer size for reading a bulk string
+)
+
+// ErrProtocol is wrapped by every error caused by a malformed request.
+// The connection should reply with the error and then be closed.
+var ErrProtocol = errors.New("Protocol error")
+
+func protocolError(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", ErrProtocol, fmt.Sprintf(format, a...))
+}
+
+// errLineTooLong is returned by readLine, callers turn it into the
+// protocol error describing the line.
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads a CRLF terminated line and returns it without the CRLF.
+// It stops with errLineTooLong once limit bytes were read without
+// finding the end of the line, so a client can't make it buffer more.
+func readLine(reader *bufio.Reader, limit int) (string, int, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > limit {
+			return "", len(line) + len(chunk), errLineTooLong
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return "", len(line), io.ErrUnexpectedEOF
+			}
+			return "", len(line), err
+		}
+		break
+	}
+	n := len(line)
+	return strings.TrimSuffix(string(line[:n-1]), "\r"), n, nil
+}
+
+// readBulk reads n bytes. The buffer starts small and doubles as the data
+// arrives, instead of being sized from the length the client declared.
+func readBulk(reader *bufio.Reader, n int) ([]byte, error) {
+	buf := make([]byte, 0, min(n, bulkReadChunk))
+	for len(buf) < n {
+		if len(buf) == cap(buf) {
+			buf = slices.Grow(buf, min(n-len(buf), len(buf)))
+		}
+		read, err := reader.Read(buf[len(buf):min(cap(buf), n)])
+		buf = buf[:len(buf)+read]
+		if err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
 func DecodeArray(reader *bufio.Reader) ([]string, int, error) {
 	totalBytes := 0
 
-	numberLine, err := reader.ReadString('\n')
+	numberLine, n, err := readLine(reader, maxInlineLen)
+	totalBytes += n
+	if err == errLineTooLong {
+		return nil, totalBytes, protocolError("too big mbulk count string")
+	}
 	if err != nil {
-		// log.Printf("Error reading numberLine: %s\n", err.Error())
-		return nil, totalBytes, fmt.Errorf("invalid first line")
+		return nil, totalBytes, err
 	}
-	totalBytes += len(numberLine)
 
 	if !strings.HasPrefix(numberLine, "*") {
-		// log.Printf("Missing * as the first byte. Received: %s\n", numberLine)
-		return nil, totalBytes, fmt.Errorf("invalid array prefix")
+		return nil, totalBytes, protocolError("expected '*', got '%s'", numberLine[:min(1, len(numberLine))])
 	}
 
-	count, err := strconv.Atoi(strings.TrimSpace(numberLine[1:]))
-	if err != nil {
-		log.Println("Invalid array length. Error: ", err.Error())
-		return nil, totalBytes, err
+	count, err := strconv.Atoi(numberLine[1:])
+	if err != nil || count > maxMultibulkLen {
+		return nil, totalBytes, protocolError("invalid multibulk length")
+	}
+	if count <= 0 {
+		return []string{}, totalBytes, nil
 	}
 
-	parts := make([]string, count)
-	for i := range parts {
-		lenLine, err := reader.ReadString('\n')
+	// the declared sizes are only trusted as far as the data that arrived,
+	// so a header alone can't make the server allocate much
+	parts := make([]string, 0, min(count, 1024))
+	for range count {
+		lenLine, n, err := readLine(reader, maxInlineLen)
+		totalBytes += n
+		if err == errLineTooLong {
+			return nil, totalBytes, protocolError("too big bulk count string")
+		}
 		if err != nil {
-			log.Println(err.Error())
 			return nil, totalBytes, err
 		}
-		totalBytes += len(lenLine)
 
 		if !strings.HasPrefix(lenLine, "$") {
-			log.Println("Missing $ as the first byte. Received: ", lenLine)
-			return nil, totalBytes, fmt.Errorf("invalid bulk string prefix")
+			return nil, totalBytes, protocolError("expected '$', got '%s'", lenLine[:min(1, len(lenLine))])
 		}
 
-		_, err = strconv.Atoi(strings.TrimSpace(lenLine[1:]))
-		if err != nil {
-			log.Println(err.Error())
-			return nil, totalBytes, err
+		length, err := strconv.Atoi(lenLine[1:])
+		if err != nil || length < 0 || length > maxBulkLen {
+			return nil, totalBytes, protocolError("invalid bulk length")
 		}
 
-		str, err := reader.ReadString('\n')
+		// Read exactly the declared payload followed by CRLF.
+		buf, err := readBulk(reader, length+2)
+		totalBytes += len(buf)
 		if err != nil {
-			log.Println(err.Error())
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
 			return nil, totalBytes, err
 		}
-		totalBytes += len(str)
+		if buf[length] != '\r' || buf[length+1] != '\n' {
+			return nil, totalBytes, protocolError("bulk string is not terminated by CRLF")
+		}
 
-		parts[i] = strings.TrimSpace(str)
+		parts = append(parts, string(buf[:length]))
 	}
 
 	return parts, totalBytes, nil
 }
+
+// DecodeCommand reads one request from the reader, accepting both the
+// multibulk format (`*<n>\r\n$<len>\r\n...`) and the inline format
+// (`PING\r\n`) used by telnet sessions and simple scripts.
+func DecodeCommand(reader *bufio.Reader) ([]string, int, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if first[0] == '*' {
+		return DecodeArray(reader)
+	}
+	return DecodeInline(reader)
+}
+
+// DecodeInline reads a single line and splits it into arguments.
+func DecodeInline(reader *bufio.Reader) ([]string, int, error) {
+	line, n, err := readLine(reader, maxInlineLen)
+	if err == errLineTooLong {
+		return nil, n, protocolError("too big inline request")
+	}
+	if err != nil {
+		return nil, n, err
+	}
+
+	parts, err := SplitArgs(line)
+	if err != nil {
+		return nil, n, err
+	}
+	return parts, n, nil
+}
+
+// SplitArgs splits an inline request into arguments the same way
+// redis-cli does: arguments are separated by spaces, and may be wrapped
+// in double quotes (supporting \n, \r, \t, \b, \a, \\, \" and \xHH
+// escapes) or single quotes (supporting only \').
+func SplitArgs(line string) ([]string, error) {
+	args := []string{}
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var (
+			cur     []byte
+			inDq    bool // inside "double quotes"
+			inSq    bool // inside 'single quotes'
+			argDone bool
+		)
+		for !argDone {
+			if i >= len(line) {
+				if inDq || inSq {
+					return nil, protocolError("unbalanced quotes in request")
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDq:
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					cur = append(cur, byte(b))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						cur = append(cur, '\n')
+					case 'r':
+						cur = append(cur, '\r')
+					case 't':
+						cur = append(cur, '\t')
+					case 'b':
+						cur = append(cur, '\b')
+					case 'a':
+						cur = append(cur, '\a')
+					default:
+						cur = append(cur, line[i])
+					}
+				} else if c == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					argDone = true
+				} else {
+					cur = append(cur, c)
+				}
+			case inSq:
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					cur = append(cur, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protocolError("unbalanced quotes in request")
+					}
+					argDone = true
+				} else {
+					cur = append(cur, c)
+				}
+			default:
+				switch c {
+				case ' ', '\n', '\r', '\t', 0:
+					argDone = true
+				case '"':
+					inDq = true
+				case '\'':
+					inSq = true
+				default:
+					cur = append(cur, c)
+				}
+			}
+			i++
+		}
+		args = append(args, string(cur))
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
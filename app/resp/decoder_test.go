@@ -0,0 +1,168 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func reader(s string) *bufio.Reader {
+	return bufio.NewReader(strings.NewReader(s))
+}
+
+func TestDecodeArray(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		want  []string
+		bytes int
+	}{
+		{"simple", "*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n", []string{"ECHO", "hi"}, 22},
+		{"empty bulk", "*1\r\n$0\r\n\r\n", []string{""}, 10},
+		{"CRLF in payload", "*1\r\n$4\r\na\r\nb\r\n", []string{"a\r\nb"}, 14},
+		{"binary payload", "*1\r\n$3\r\n\x00\xff\n\r\n", []string{"\x00\xff\n"}, 13},
+		{"empty array", "*0\r\n", []string{}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := DecodeArray(reader(tt.in))
+			if err != nil {
+				t.Fatalf("DecodeArray(%q) error: %v", tt.in, err)
+			}
+			if !slices.Equal(got, tt.want) || n != tt.bytes {
+				t.Errorf("DecodeArray(%q) = %q, %d, want %q, %d", tt.in, got, n, tt.want, tt.bytes)
+			}
+		})
+	}
+}
+
+func TestDecodeArrayErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string // "" for io.ErrUnexpectedEOF
+	}{
+		{"not an array", "$1\r\na\r\n", "expected '*'"},
+		{"bad count", "*x\r\n", "invalid multibulk length"},
+		{"count too big", "*1048577\r\n", "invalid multibulk length"},
+		{"not a bulk", "*1\r\n:1\r\n", "expected '$'"},
+		{"negative length", "*1\r\n$-1\r\n", "invalid bulk length"},
+		{"length too big", "*1\r\n$536870913\r\n", "invalid bulk length"},
+		{"missing CRLF", "*1\r\n$1\r\nabc\r\n", "not terminated by CRLF"},
+		{"header too long", "*" + strings.Repeat("1", maxInlineLen) + "\r\n", "too big mbulk count string"},
+		{"bulk header too long", "*1\r\n$" + strings.Repeat("1", maxInlineLen) + "\r\n", "too big bulk count string"},
+		{"truncated payload", "*1\r\n$10\r\nabc", ""},
+		{"truncated array", "*2\r\n$1\r\na\r\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := DecodeArray(reader(tt.in))
+			if tt.want == "" {
+				if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+					t.Errorf("DecodeArray(%q) error = %v, want EOF", tt.in, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DecodeArray(%q) error = %v, want protocol error %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
+// A huge declared length must not be allocated before the data arrives.
+func TestReadBulkDeclaredSize(t *testing.T) {
+	buf, err := readBulk(reader("abc"), maxBulkLen)
+	if err == nil || string(buf) != "abc" {
+		t.Fatalf("readBulk = %q, %v, want the data read so far and an error", buf, err)
+	}
+	if cap(buf) > bulkReadChunk {
+		t.Errorf("readBulk allocated %d bytes for 3 bytes of data", cap(buf))
+	}
+
+	data := strings.Repeat("x", 3*bulkReadChunk+5)
+	buf, err = readBulk(reader(data), len(data))
+	if err != nil || string(buf) != data {
+		t.Errorf("readBulk of %d bytes = %d bytes, %v", len(data), len(buf), err)
+	}
+}
+
+func TestDecodeArraySequence(t *testing.T) {
+	r := reader("*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\n")
+	for _, want := range [][]string{{"PING"}, {"GET", "k"}} {
+		got, _, err := DecodeArray(r)
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf("DecodeArray = %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, _, err := DecodeArray(r); err != io.EOF {
+		t.Errorf("DecodeArray at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"PING", []string{"PING"}},
+		{"  SET  k   v ", []string{"SET", "k", "v"}},
+		{"", []string{}},
+		{`SET k "hello world"`, []string{"SET", "k", "hello world"}},
+		{`SET k "a\n\t\"\x41"`, []string{"SET", "k", "a\n\t\"A"}},
+		{`SET k "\xZZ"`, []string{"SET", "k", "xZZ"}},
+		{`SET k 'it\'s "raw" \n'`, []string{"SET", "k", `it's "raw" \n`}},
+		{`SET k ""`, []string{"SET", "k", ""}},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.in)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestSplitArgsUnbalanced(t *testing.T) {
+	for _, in := range []string{`SET "k`, `SET 'k`, `SET "k"v`, `SET 'k'v`} {
+		if _, err := SplitArgs(in); !errors.Is(err, ErrProtocol) {
+			t.Errorf("SplitArgs(%q) error = %v, want unbalanced quotes", in, err)
+		}
+	}
+}
+
+func TestDecodeCommand(t *testing.T) {
+	r := reader("PING\r\n*1\r\n$4\r\nPING\r\nECHO \"a b\"\n")
+	for _, want := range []struct {
+		args  []string
+		bytes int
+	}{
+		{[]string{"PING"}, 6},
+		{[]string{"PING"}, 14},
+		{[]string{"ECHO", "a b"}, 11},
+	} {
+		got, n, err := DecodeCommand(r)
+		if err != nil || !slices.Equal(got, want.args) || n != want.bytes {
+			t.Fatalf("DecodeCommand = %q, %d, %v, want %q, %d", got, n, err, want.args, want.bytes)
+		}
+	}
+}
+
+func TestDecodeInlineTooLong(t *testing.T) {
+	// no newline at all, the limit must be enforced while reading
+	line := strings.Repeat("a", maxInlineLen+1)
+	_, n, err := DecodeInline(reader(line))
+	if !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), "too big inline request") {
+		t.Errorf("DecodeInline error = %v, want too big inline request", err)
+	}
+	if n > maxInlineLen+4096 { // at most one more bufio.Reader buffer
+		t.Errorf("DecodeInline read %d bytes before failing", n)
+	}
+
+	ok := strings.Repeat("a", maxInlineLen-2) + "\r\n"
+	if got, _, err := DecodeInline(reader(ok)); err != nil || len(got) != 1 {
+		t.Errorf("DecodeInline of a line at the limit = %d args, %v", len(got), err)
+	}
+}
@@ -2,6 +2,8 @@ package resp
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 
 	"github.com/codecrafters-io/redis-starter-go/app/kv"
 )
@@ -54,6 +56,108 @@ func EncodeSimpleError(str string) (res []byte) {
 	return
 }
 
+// Error reply from an error whose message starts with its error code.
+func EncodeError(err error) []byte {
+	return EncodeRawError(err.Error())
+}
+
+// Error reply with a custom error code, e.g. "NOPROTO ..." or "WRONGTYPE ...".
+func EncodeRawError(str string) (res []byte) {
+	res = fmt.Appendf(res, "-%s\r\n", str)
+	return
+}
+
+func EncodeArrayHeader(n int) (res []byte) {
+	res = fmt.Appendf(res, "*%d\r\n", n)
+	return
+}
+
+// RESP3 types
+
+func EncodeNull() []byte {
+	return []byte("_\r\n")
+}
+
+func EncodeBoolean(b bool) []byte {
+	if b {
+		return []byte("#t\r\n")
+	}
+	return []byte("#f\r\n")
+}
+
+func EncodeDouble(f float64) (res []byte) {
+	res = fmt.Appendf(res, ",%s\r\n", FormatDouble(f))
+	return
+}
+
+func EncodeBigNumber(num string) (res []byte) {
+	res = fmt.Appendf(res, "(%s\r\n", num)
+	return
+}
+
+// Format is a three characters type hint such as "txt" or "mkd".
+func EncodeVerbatimString(format, str string) (res []byte) {
+	res = fmt.Appendf(res, "=%d\r\n%s:%s\r\n", len(str)+4, format, str)
+	return
+}
+
+// Header of a map with n key/value pairs. The 2*n elements must follow.
+func EncodeMapHeader(n int) (res []byte) {
+	res = fmt.Appendf(res, "%%%d\r\n", n)
+	return
+}
+
+func EncodeSetHeader(n int) (res []byte) {
+	res = fmt.Appendf(res, "~%d\r\n", n)
+	return
+}
+
+func EncodePushHeader(n int) (res []byte) {
+	res = fmt.Appendf(res, ">%d\r\n", n)
+	return
+}
+
+// All bulkstring map
+func EncodeMap(m map[string]string) (res []byte) {
+	res = EncodeMapHeader(len(m))
+	for k, v := range m {
+		res = append(res, EncodeBulkString(k)...)
+		res = append(res, EncodeBulkString(v)...)
+	}
+	return
+}
+
+// All bulkstring set
+func EncodeSet(l []string) (res []byte) {
+	res = EncodeSetHeader(len(l))
+	for _, str := range l {
+		res = append(res, EncodeBulkString(str)...)
+	}
+	return
+}
+
+// All bulkstring push frame
+func EncodePush(l []string) (res []byte) {
+	res = EncodePushHeader(len(l))
+	for _, str := range l {
+		res = append(res, EncodeBulkString(str)...)
+	}
+	return
+}
+
+// FormatDouble formats a float the way Redis does in replies.
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
 func EncodeStreamEntries(entries []kv.StreamEntry) (res []byte) {
 	res = fmt.Appendf(res, "*%d\r\n", len(entries))
 	for _, entry := range entries {
@@ -93,6 +197,24 @@ func EncodeStreamEntriesWithKeys(keys []string, mulEntries [][]kv.StreamEntry) (
 	return
 }
 
+// RESP3 variant of EncodeStreamEntriesWithKeys, keyed by stream name.
+func EncodeStreamEntriesMap(keys []string, mulEntries [][]kv.StreamEntry) (res []byte) {
+	cnt := 0
+	for i := range len(keys) {
+		if len(mulEntries[i]) == 0 {
+			continue
+		}
+		cnt++
+		res = append(res, EncodeBulkString(keys[i])...)
+		res = append(res, EncodeStreamEntries(mulEntries[i])...)
+	}
+	if cnt == 0 {
+		return EncodeNull()
+	}
+	res = append(EncodeMapHeader(cnt), res...)
+	return
+}
+
 func EncodeRDBFile(content []byte) (res []byte) {
 	res = fmt.Appendf(res, "$%d\r\n", len(content))
 	res = append(res, content...)
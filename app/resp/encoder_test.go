@@ -0,0 +1,50 @@
+package resp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodeResp3(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"null", EncodeNull(), "_\r\n"},
+		{"true", EncodeBoolean(true), "#t\r\n"},
+		{"false", EncodeBoolean(false), "#f\r\n"},
+		{"double", EncodeDouble(1.5), ",1.5\r\n"},
+		{"inf", EncodeDouble(math.Inf(1)), ",inf\r\n"},
+		{"-inf", EncodeDouble(math.Inf(-1)), ",-inf\r\n"},
+		{"big number", EncodeBigNumber("12345678901234567890"), "(12345678901234567890\r\n"},
+		{"verbatim", EncodeVerbatimString("txt", "hi"), "=6\r\ntxt:hi\r\n"},
+		{"map", EncodeMap(map[string]string{"a": "1"}), "%1\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{"set", EncodeSet([]string{"a", "b"}), "~2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"push", EncodePush([]string{"message", "ch", "hi"}), ">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n"},
+	}
+	for _, tt := range tests {
+		if string(tt.got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestFormatDouble(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{3, "3"},
+		{-2.5, "-2.5"},
+		{0.1, "0.1"},
+		{1e21, "1000000000000000000000"},
+		{math.NaN(), "nan"},
+	}
+	for _, tt := range tests {
+		if got := FormatDouble(tt.in); got != tt.want {
+			t.Errorf("FormatDouble(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
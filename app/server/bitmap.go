@@ -0,0 +1,261 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// parseBitOffset parses a bit offset. With bits > 0 the "#N" form is
+// accepted too, meaning the N-th field of that width. The whole field,
+// not just its first bit, must fit within kv.MaxBitOffset.
+func parseBitOffset(arg string, bits int) (uint64, []byte) {
+	errReply := resp.EncodeSimpleError("bit offset is not an integer or out of range")
+	multiplier := int64(1)
+	if bits > 0 && strings.HasPrefix(arg, "#") {
+		arg = arg[1:]
+		multiplier = int64(bits)
+	}
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 || offset > kv.MaxBitOffset/multiplier {
+		return 0, errReply
+	}
+	offset *= multiplier
+	if offset > kv.MaxBitOffset-int64(max(bits, 1)-1) {
+		return 0, errReply
+	}
+	return uint64(offset), nil
+}
+
+// parseBitRange parses the optional [start [end [BYTE | BIT]]] arguments.
+// BITCOUNT requires both start and end when a range is given.
+func parseBitRange(args []string, needEnd bool) (kv.BitRange, []byte) {
+	r := kv.BitRange{}
+	if len(args) > 3 || (needEnd && len(args) == 1) {
+		return r, resp.EncodeSimpleError("syntax error")
+	}
+	if len(args) >= 1 {
+		start, err := strconv.Atoi(args[0])
+		if err != nil {
+			return r, resp.EncodeSimpleError("value is not an integer or out of range")
+		}
+		r.Start, r.HasStart = start, true
+	}
+	if len(args) >= 2 {
+		end, err := strconv.Atoi(args[1])
+		if err != nil {
+			return r, resp.EncodeSimpleError("value is not an integer or out of range")
+		}
+		r.End, r.HasEnd = end, true
+	}
+	if len(args) == 3 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			r.IsBit = true
+		default:
+			return r, resp.EncodeSimpleError("syntax error")
+		}
+	}
+	return r, nil
+}
+
+// SETBIT key offset value
+func (h *ConnHandler) handleSETBIT(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	offset, errReply := parseBitOffset(cmd.Args[1], 0)
+	if errReply != nil {
+		return errReply
+	}
+	if cmd.Args[2] != "0" && cmd.Args[2] != "1" {
+		return resp.EncodeSimpleError("bit is not an integer or out of range")
+	}
+	res, err := h.db().SetBit(cmd.Args[0], offset, int(cmd.Args[2][0]-'0'))
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// GETBIT key offset
+func (h *ConnHandler) handleGETBIT(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	offset, errReply := parseBitOffset(cmd.Args[1], 0)
+	if errReply != nil {
+		return errReply
+	}
+	res, err := h.db().GetBit(cmd.Args[0], offset)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// BITCOUNT key [start end [BYTE | BIT]]
+func (h *ConnHandler) handleBITCOUNT(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	r, errReply := parseBitRange(cmd.Args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	res, err := h.db().BitCount(cmd.Args[0], r)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// BITPOS key bit [start [end [BYTE | BIT]]]
+func (h *ConnHandler) handleBITPOS(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	if cmd.Args[1] != "0" && cmd.Args[1] != "1" {
+		return resp.EncodeSimpleError("The bit argument must be 1 or 0.")
+	}
+	r, errReply := parseBitRange(cmd.Args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	res, err := h.db().BitPos(cmd.Args[0], int(cmd.Args[1][0]-'0'), r)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// BITOP <AND | OR | XOR | NOT> destkey key [key ...]
+func (h *ConnHandler) handleBITOP(cmd CMD) []byte {
+	if len(cmd.Args) < 3 {
+		return wrongArgs(cmd)
+	}
+	var op kv.BitOpKind
+	switch strings.ToUpper(cmd.Args[0]) {
+	case "AND":
+		op = kv.BitAnd
+	case "OR":
+		op = kv.BitOr
+	case "XOR":
+		op = kv.BitXor
+	case "NOT":
+		op = kv.BitNot
+		if len(cmd.Args) != 3 {
+			return resp.EncodeSimpleError("BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return resp.EncodeSimpleError("syntax error")
+	}
+	res, err := h.db().BitOp(op, cmd.Args[1], cmd.Args[2:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// parseBitFieldType parses i<bits> or u<bits>. u64 is not supported.
+func parseBitFieldType(arg string) (signed bool, bits int, ok bool) {
+	if len(arg) < 2 {
+		return false, 0, false
+	}
+	switch arg[0] {
+	case 'i', 'I':
+		signed = true
+	case 'u', 'U':
+	default:
+		return false, 0, false
+	}
+	bits, err := strconv.Atoi(arg[1:])
+	if err != nil || bits < 1 || bits > 64 || (!signed && bits == 64) {
+		return false, 0, false
+	}
+	return signed, bits, true
+}
+
+// BITFIELD key [GET encoding offset | [OVERFLOW <WRAP | SAT | FAIL>]
+// <SET encoding offset value | INCRBY encoding offset increment> ...]
+// BITFIELD_RO key [GET encoding offset ...]
+func (h *ConnHandler) handleBITFIELD(cmd CMD, readOnly bool) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	ops := []kv.BitFieldOp{}
+	overflow := kv.OverflowWrap
+	args := cmd.Args[1:]
+	for i := 0; i < len(args); i++ {
+		sub := strings.ToUpper(args[i])
+		if sub == "OVERFLOW" && i+1 < len(args) {
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				overflow = kv.OverflowWrap
+			case "SAT":
+				overflow = kv.OverflowSat
+			case "FAIL":
+				overflow = kv.OverflowFail
+			default:
+				return resp.EncodeSimpleError("Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		}
+
+		op := kv.BitFieldOp{Overflow: overflow}
+		nargs := 3
+		switch sub {
+		case "GET":
+			op.Kind, nargs = kv.BitFieldGet, 2
+		case "SET":
+			op.Kind = kv.BitFieldSet
+		case "INCRBY":
+			op.Kind = kv.BitFieldIncrBy
+		default:
+			return resp.EncodeSimpleError("syntax error")
+		}
+		if i+nargs >= len(args) {
+			return resp.EncodeSimpleError("syntax error")
+		}
+		signed, bits, ok := parseBitFieldType(args[i+1])
+		if !ok {
+			return resp.EncodeSimpleError("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		op.Signed, op.Bits = signed, bits
+		offset, errReply := parseBitOffset(args[i+2], bits)
+		if errReply != nil {
+			return errReply
+		}
+		op.Offset = offset
+		if op.Kind != kv.BitFieldGet {
+			if readOnly {
+				return resp.EncodeSimpleError("BITFIELD_RO only supports the GET subcommand")
+			}
+			value, err := strconv.ParseInt(args[i+3], 10, 64)
+			if err != nil {
+				return resp.EncodeSimpleError("value is not an integer or out of range")
+			}
+			op.Value = value
+		}
+		ops = append(ops, op)
+		i += nargs
+	}
+
+	res, err := h.db().BitField(cmd.Args[0], ops)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	out := resp.EncodeArrayHeader(len(res))
+	for _, v := range res {
+		if v == nil {
+			out = append(out, h.encodeNullBulkString()...)
+		} else {
+			out = append(out, resp.EncodeInt64(v.(int64))...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+)
+
+func TestParseBitOffset(t *testing.T) {
+	tests := []struct {
+		arg  string
+		bits int
+		want uint64
+		ok   bool
+	}{
+		{"0", 0, 0, true},
+		{"4294967295", 0, kv.MaxBitOffset, true},
+		{"4294967296", 0, 0, false},
+		{"-1", 0, 0, false},
+		{"#2", 0, 0, false}, // SETBIT has no #N form
+		{"#3", 8, 24, true},
+		{"#536870911", 8, kv.MaxBitOffset - 7, true},
+		{"#536870912", 8, 0, false},
+		{"4294967288", 8, kv.MaxBitOffset - 7, true},
+		{"4294967289", 8, 0, false}, // the last bit of the field is past the limit
+		{"#9223372036854775807", 64, 0, false},
+	}
+	for _, tt := range tests {
+		got, errReply := parseBitOffset(tt.arg, tt.bits)
+		if (errReply == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseBitOffset(%q, %d) = %d, %q, want %d, ok %v", tt.arg, tt.bits, got, errReply, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseBitFieldType(t *testing.T) {
+	tests := []struct {
+		arg    string
+		signed bool
+		bits   int
+		ok     bool
+	}{
+		{"u8", false, 8, true},
+		{"I64", true, 64, true},
+		{"u63", false, 63, true},
+		{"u64", false, 0, false},
+		{"i0", false, 0, false},
+		{"i65", false, 0, false},
+		{"x8", false, 0, false},
+		{"u", false, 0, false},
+	}
+	for _, tt := range tests {
+		signed, bits, ok := parseBitFieldType(tt.arg)
+		if signed != tt.signed || bits != tt.bits || ok != tt.ok {
+			t.Errorf("parseBitFieldType(%q) = %v, %d, %v", tt.arg, signed, bits, ok)
+		}
+	}
+}
+
+func TestBitmapCommands(t *testing.T) {
+	runSteps(t, newTestHandler(t), []step{
+		{[]string{"SETBIT", "k", "7", "1"}, ":0\r\n"},
+		{[]string{"SETBIT", "k", "7", "2"}, "-ERR bit is not an integer or out of range\r\n"},
+		{[]string{"GETBIT", "k", "7"}, ":1\r\n"},
+		{[]string{"BITCOUNT", "k", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"BITCOUNT", "k", "0", "-1", "BIT"}, ":1\r\n"},
+		{[]string{"BITPOS", "k", "1"}, ":7\r\n"},
+		{[]string{"BITOP", "NOT", "d", "k", "k"}, "-ERR BITOP NOT must be called with a single source key.\r\n"},
+		{[]string{"BITOP", "NOT", "d", "k"}, ":1\r\n"},
+		{[]string{"GET", "d"}, "$1\r\n\xfe\r\n"},
+		{[]string{"BITFIELD", "k", "INCRBY", "u2", "#0", "1", "OVERFLOW", "FAIL", "INCRBY", "u2", "0", "3", "GET", "u8", "0"},
+			"*3\r\n:1\r\n$-1\r\n:65\r\n"},
+		{[]string{"BITFIELD", "k", "GET", "u64", "0"}, "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n"},
+		{[]string{"BITFIELD", "k", "OVERFLOW", "FOO"}, "-ERR Invalid OVERFLOW type specified\r\n"},
+		{[]string{"BITFIELD_RO", "k", "SET", "u8", "0", "1"}, "-ERR BITFIELD_RO only supports the GET subcommand\r\n"},
+	})
+}
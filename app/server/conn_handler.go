@@ -2,9 +2,10 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"strconv"
@@ -19,10 +20,19 @@ type ConnHandler struct {
 	conn   net.Conn
 	reader *bufio.Reader
 	in     chan CMD
+	// ctx is cancelled once the client is gone, which wakes up the
+	// blocking command it may be running
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	inTransaction bool
 	commandQueue  []CMD
 
+	id       int64
+	name     string
+	protocol int // RESP version, 2 by default and switched by HELLO
+	dbIndex  int // Database selected with SELECT
+
 	s *Server
 }
 
@@ -30,25 +40,85 @@ type CMD struct {
 	Command   string
 	Args      []string
 	RespBytes int
+	Err       error // Set when the request could not be decoded
 }
 
 var writeCommands = map[string]bool{
-	"SET":      true,
-	"DEL":      true,
-	"INCR":     true,
-	"DECR":     true,
-	"RPUSH":    true,
-	"LPUSH":    true,
-	"LPOP":     true,
-	"RPOP":     true,
-	"XADD":     true,
-	"HMSET":    true,
-	"HSET":     true,
-	"HDEL":     true,
-	"EXPIRE":   true,
-	"PEXPIRE":  true,
-	"FLUSHDB":  true,
-	"FLUSHALL": true,
+	"SET":              true,
+	"SETNX":            true,
+	"SETEX":            true,
+	"PSETEX":           true,
+	"GETSET":           true,
+	"GETDEL":           true,
+	"GETEX":            true,
+	"APPEND":           true,
+	"SETRANGE":         true,
+	"MSET":             true,
+	"MSETNX":           true,
+	"SETBIT":           true,
+	"BITOP":            true,
+	"BITFIELD":         true,
+	"PFADD":            true,
+	"PFMERGE":          true,
+	"DEL":              true,
+	"UNLINK":           true,
+	"RENAME":           true,
+	"RENAMENX":         true,
+	"COPY":             true,
+	"MOVE":             true,
+	"SWAPDB":           true,
+	"INCR":             true,
+	"DECR":             true,
+	"INCRBY":           true,
+	"DECRBY":           true,
+	"INCRBYFLOAT":      true,
+	"RPUSH":            true,
+	"LPUSH":            true,
+	"LPOP":             true,
+	"RPOP":             true,
+	"LMPOP":            true,
+	"LPUSHX":           true,
+	"RPUSHX":           true,
+	"LSET":             true,
+	"LINSERT":          true,
+	"LREM":             true,
+	"LTRIM":            true,
+	"LMOVE":            true,
+	"RPOPLPUSH":        true,
+	"XADD":             true,
+	"HMSET":            true,
+	"HSET":             true,
+	"HSETNX":           true,
+	"HDEL":             true,
+	"HINCRBY":          true,
+	"HINCRBYFLOAT":     true,
+	"SADD":             true,
+	"SREM":             true,
+	"SPOP":             true,
+	"SMOVE":            true,
+	"SUNIONSTORE":      true,
+	"SINTERSTORE":      true,
+	"SDIFFSTORE":       true,
+	"ZADD":             true,
+	"ZINCRBY":          true,
+	"ZRANGESTORE":      true,
+	"ZUNIONSTORE":      true,
+	"ZINTERSTORE":      true,
+	"ZDIFFSTORE":       true,
+	"ZPOPMIN":          true,
+	"ZPOPMAX":          true,
+	"ZMPOP":            true,
+	"ZREM":             true,
+	"ZREMRANGEBYRANK":  true,
+	"ZREMRANGEBYSCORE": true,
+	"ZREMRANGEBYLEX":   true,
+	"EXPIRE":           true,
+	"PEXPIRE":          true,
+	"EXPIREAT":         true,
+	"PEXPIREAT":        true,
+	"PERSIST":          true,
+	"FLUSHDB":          true,
+	"FLUSHALL":         true,
 }
 
 var subModeCommands = map[string]bool{
@@ -61,28 +131,27 @@ var subModeCommands = map[string]bool{
 }
 
 func NewConnHandler(conn net.Conn, s *Server) *ConnHandler {
-	return &ConnHandler{
-		conn:          conn,
-		reader:        bufio.NewReader(conn),
-		in:            make(chan CMD),
-		inTransaction: false,
-		commandQueue:  []CMD{},
-		s:             s,
-	}
+	return NewConnHandlerWithReader(conn, s, bufio.NewReader(conn))
 }
 
 func NewConnHandlerWithReader(conn net.Conn, s *Server, reader *bufio.Reader) *ConnHandler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ConnHandler{
 		conn:          conn,
 		reader:        reader,
 		in:            make(chan CMD),
+		ctx:           ctx,
+		cancel:        cancel,
 		inTransaction: false,
 		commandQueue:  []CMD{},
+		id:            s.nextClientID.Add(1),
+		protocol:      2,
 		s:             s,
 	}
 }
 
 func (h *ConnHandler) close() {
+	h.cancel()
 	h.conn.Close()
 }
 
@@ -98,8 +167,13 @@ func (h *ConnHandler) Handle(isSlave bool) {
 	go h.readCMD()
 
 	for cmd := range h.in {
-		// master propagate write commands to its slavers
-		h.propagateCMD(cmd)
+		// malformed request: reply with the protocol error and drop the connection
+		if cmd.Err != nil {
+			if !isSlave {
+				h.conn.Write(resp.EncodeSimpleError(cmd.Err.Error()))
+			}
+			return
+		}
 
 		// execute cmd
 		res := h.run(cmd)
@@ -144,33 +218,81 @@ func isSubModCommand(cmd CMD) bool {
 	return subModeCommands[strings.ToUpper(cmd.Command)]
 }
 
+// Commands whose effect doesn't depend on the selected database
+func isDBAgnostic(cmd CMD) bool {
+	switch strings.ToUpper(cmd.Command) {
+	case "FLUSHALL", "SWAPDB":
+		return true
+	}
+	return false
+}
+
+func wrongArgs(cmd CMD) []byte {
+	return resp.EncodeSimpleError(fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(cmd.Command)))
+}
+
+// Write commands whose effect would differ if replayed as sent, like
+// SPOP picking other random members or EXPIRE counting from the time the
+// slave receives it. Their handlers propagate the effect they actually
+// had instead, see propagate.
+var rewrittenCommands = map[string]bool{
+	"SPOP":    true,
+	"SET":     true,
+	"SETEX":   true,
+	"PSETEX":  true,
+	"GETEX":   true,
+	"EXPIRE":  true,
+	"PEXPIRE": true,
+}
+
 func (h *ConnHandler) propagateCMD(cmd CMD) {
-	if !writeCommands[strings.ToUpper(cmd.Command)] {
+	name := strings.ToUpper(cmd.Command)
+	if !writeCommands[name] || rewrittenCommands[name] {
 		return
 	}
-	h.s.SlaveMu.RLock()
+	h.propagate(append([]string{cmd.Command}, cmd.Args...)...)
+}
+
+// propagate sends a command to the slaves, in the database selected by
+// the connection.
+func (h *ConnHandler) propagate(args ...string) {
+	cmd := CMD{Command: args[0], Args: args[1:]}
+	// Slaves always receive the multibulk form, which may differ in size
+	// from what the client sent (e.g. inline commands).
+	encoded := resp.EncodeArray(args)
+
+	h.s.SlaveMu.Lock()
+	// Switch the replication stream to this client's database first
+	if h.s.replDB != h.dbIndex && !isDBAgnostic(cmd) {
+		selectCmd := resp.EncodeArray([]string{"SELECT", strconv.Itoa(h.dbIndex)})
+		encoded = append(selectCmd, encoded...)
+		h.s.replDB = h.dbIndex
+	}
 	for _, slave := range h.s.SlaveConns {
-		strs := append([]string{cmd.Command}, cmd.Args...)
-		slave.Write(resp.EncodeArray(strs))
+		slave.Write(encoded)
 	}
-	h.s.SlaveMu.RUnlock()
+	h.s.SlaveMu.Unlock()
 
 	h.s.MasterOffsetMu.Lock()
-	h.s.MasterReplOffset += cmd.RespBytes
+	h.s.MasterReplOffset += len(encoded)
 	h.s.MasterOffsetMu.Unlock()
 }
 
 func (h *ConnHandler) readCMD() {
-	// reader := bufio.NewReader(h.conn)
+	// Closing `h.in` lets `Handle` return and close the connection.
+	defer close(h.in)
+	// Handle may be stuck in a blocking command meanwhile, end it now
+	defer h.cancel()
+
 	reader := h.reader
 	for {
-		parts, n, err := resp.DecodeArray(reader)
-		if err == io.EOF {
-			// log.Println("Received EOF")
+		parts, n, err := resp.DecodeCommand(reader)
+		if errors.Is(err, resp.ErrProtocol) {
+			h.in <- CMD{Err: err}
 			return
 		} else if err != nil {
-			// log.Println(err.Error())
-			continue
+			// EOF or broken connection
+			return
 		}
 		cmd := CMD{RespBytes: n}
 		if len(parts) > 0 {
@@ -185,7 +307,8 @@ func (h *ConnHandler) readCMD() {
 
 func (h *ConnHandler) run(cmd CMD) []byte {
 	isSubMode := h.isInSubMode()
-	if isSubMode && !isSubModCommand(cmd) {
+	// RESP3 clients can keep issuing regular commands while subscribed.
+	if isSubMode && !h.isResp3() && !isSubModCommand(cmd) {
 		return resp.EncodeSimpleError(
 			fmt.Sprintf("Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", cmd.Command),
 		)
@@ -196,57 +319,142 @@ func (h *ConnHandler) run(cmd CMD) []byte {
 		return resp.EncodeSimpleString("QUEUED")
 	}
 
+	// master propagate write commands to its slavers, when they run: the
+	// commands of a transaction at EXEC, in order with those its handlers
+	// propagate themselves
+	h.propagateCMD(cmd)
+
 	switch strings.ToUpper(cmd.Command) {
 	case "COMMAND":
 		return []byte("*0\r\n")
 	case "PING":
 		return h.handlePING(isSubMode)
+	case "HELLO":
+		return h.handleHELLO(cmd)
 	case "ECHO":
 		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(cmd.Args[0]), cmd.Args[0]))
 	case "SET":
-		key, value := cmd.Args[0], cmd.Args[1]
-		if len(cmd.Args) == 2 {
-			h.s.KVStore.Set(key, value)
-		} else if len(cmd.Args) == 4 {
-			t, _ := strconv.Atoi(cmd.Args[3])
-			if strings.ToUpper(cmd.Args[2]) == "EX" {
-				t *= 1000
-			}
-			h.s.KVStore.SetExpire(key, value, t)
-		}
-		return []byte("+OK\r\n")
+		return h.handleSET(cmd)
+	case "SETNX":
+		return h.handleSETNX(cmd)
+	case "SETEX":
+		return h.handleSETEX(cmd, time.Second)
+	case "PSETEX":
+		return h.handleSETEX(cmd, time.Millisecond)
 	case "GET":
-		key := cmd.Args[0]
-		val := h.s.KVStore.Get(key)
-		if val != nil {
-			return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(val.(string)), val.(string)))
-		} else {
-			return []byte("$-1\r\n")
-		}
+		return h.handleGET(cmd)
+	case "GETSET":
+		return h.handleGETSET(cmd)
+	case "GETDEL":
+		return h.handleGETDEL(cmd)
+	case "GETEX":
+		return h.handleGETEX(cmd)
+	case "APPEND":
+		return h.handleAPPEND(cmd)
+	case "STRLEN":
+		return h.handleSTRLEN(cmd)
+	case "GETRANGE":
+		return h.handleGETRANGE(cmd)
+	case "SETRANGE":
+		return h.handleSETRANGE(cmd)
+	case "MSET":
+		return h.handleMSET(cmd)
+	case "MSETNX":
+		return h.handleMSETNX(cmd)
+	case "MGET":
+		return h.handleMGET(cmd)
+	case "LCS":
+		return h.handleLCS(cmd)
+	case "SETBIT":
+		return h.handleSETBIT(cmd)
+	case "GETBIT":
+		return h.handleGETBIT(cmd)
+	case "BITCOUNT":
+		return h.handleBITCOUNT(cmd)
+	case "BITPOS":
+		return h.handleBITPOS(cmd)
+	case "BITOP":
+		return h.handleBITOP(cmd)
+	case "BITFIELD":
+		return h.handleBITFIELD(cmd, false)
+	case "BITFIELD_RO":
+		return h.handleBITFIELD(cmd, true)
+	case "PFADD":
+		return h.handlePFADD(cmd)
+	case "PFCOUNT":
+		return h.handlePFCOUNT(cmd)
+	case "PFMERGE":
+		return h.handlePFMERGE(cmd)
 	case "RPUSH":
 		key := cmd.Args[0]
 		value := cmd.Args[1:]
-		length := h.s.KVStore.RPush(key, value)
+		length, err := h.db().RPush(key, value)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
 		return resp.EncodeInt(length)
 	case "LPUSH":
 		key := cmd.Args[0]
 		value := cmd.Args[1:]
-		length := h.s.KVStore.LPush(key, value)
+		length, err := h.db().LPush(key, value)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
 		return resp.EncodeInt(length)
 	case "LRANGE":
 		key := cmd.Args[0]
 		start, _ := strconv.Atoi(cmd.Args[1])
 		stop, _ := strconv.Atoi(cmd.Args[2])
-		l := h.s.KVStore.LRange(key, start, stop)
+		l, err := h.db().LRange(key, start, stop)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
 		return resp.EncodeArray(l)
 	case "LLEN":
 		key := cmd.Args[0]
-		length := h.s.KVStore.LLen(key)
+		length, err := h.db().LLen(key)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
 		return resp.EncodeInt(length)
 	case "LPOP":
-		return h.handleLPOP(cmd)
+		return h.handlePOP(cmd, true)
+	case "RPOP":
+		return h.handlePOP(cmd, false)
+	case "LPUSHX":
+		return h.handlePUSHX(cmd, true)
+	case "RPUSHX":
+		return h.handlePUSHX(cmd, false)
+	case "LINDEX":
+		return h.handleLINDEX(cmd)
+	case "LSET":
+		return h.handleLSET(cmd)
+	case "LINSERT":
+		return h.handleLINSERT(cmd)
+	case "LREM":
+		return h.handleLREM(cmd)
+	case "LTRIM":
+		return h.handleLTRIM(cmd)
+	case "LPOS":
+		return h.handleLPOS(cmd)
 	case "BLPOP":
-		return h.handleBLPOP(cmd)
+		return h.handleBPOP(cmd, true)
+	case "BRPOP":
+		return h.handleBPOP(cmd, false)
+	case "LMPOP":
+		return h.handleLMPOP(cmd)
+	case "BLMPOP":
+		return h.handleBLMPOP(cmd)
+	case "LMOVE":
+		return h.handleLMOVE(cmd)
+	case "RPOPLPUSH":
+		return h.handleRPOPLPUSH(cmd)
+	case "BLMOVE":
+		return h.handleBLMOVE(cmd)
+	case "BRPOPLPUSH":
+		return h.handleBRPOPLPUSH(cmd)
+	case "OBJECT":
+		return h.handleOBJECT(cmd)
 	case "TYPE":
 		return h.handleType(cmd)
 	case "XADD":
@@ -256,7 +464,15 @@ func (h *ConnHandler) run(cmd CMD) []byte {
 	case "XREAD":
 		return h.handleXREAD(cmd)
 	case "INCR":
-		return h.handleINCR(cmd)
+		return h.handleINCR(cmd, 1)
+	case "DECR":
+		return h.handleINCR(cmd, -1)
+	case "INCRBY":
+		return h.handleINCRBY(cmd, 1)
+	case "DECRBY":
+		return h.handleINCRBY(cmd, -1)
+	case "INCRBYFLOAT":
+		return h.handleINCRBYFLOAT(cmd)
 	case "MULTI":
 		return h.handleMULTI()
 	case "EXEC":
@@ -275,6 +491,52 @@ func (h *ConnHandler) run(cmd CMD) []byte {
 		return h.handleCONFIG(cmd)
 	case "KEYS":
 		return h.handleKEYS(cmd)
+	case "SCAN":
+		return h.handleSCAN(cmd)
+	case "EXPIRE":
+		return h.handleEXPIRE(cmd, time.Second, false)
+	case "PEXPIRE":
+		return h.handleEXPIRE(cmd, time.Millisecond, false)
+	case "EXPIREAT":
+		return h.handleEXPIRE(cmd, time.Second, true)
+	case "PEXPIREAT":
+		return h.handleEXPIRE(cmd, time.Millisecond, true)
+	case "TTL":
+		return h.handleTTL(cmd, time.Second)
+	case "PTTL":
+		return h.handleTTL(cmd, time.Millisecond)
+	case "EXPIRETIME":
+		return h.handleEXPIRETIME(cmd, time.Second)
+	case "PEXPIRETIME":
+		return h.handleEXPIRETIME(cmd, time.Millisecond)
+	case "PERSIST":
+		return h.handlePERSIST(cmd)
+	case "DEL":
+		return h.handleDEL(cmd, false)
+	case "UNLINK":
+		return h.handleDEL(cmd, true)
+	case "EXISTS":
+		return h.handleEXISTS(cmd)
+	case "TOUCH":
+		return h.handleTOUCH(cmd)
+	case "RENAME":
+		return h.handleRENAME(cmd, false)
+	case "RENAMENX":
+		return h.handleRENAME(cmd, true)
+	case "COPY":
+		return h.handleCOPY(cmd)
+	case "RANDOMKEY":
+		return h.handleRANDOMKEY(cmd)
+	case "DBSIZE":
+		return h.handleDBSIZE(cmd)
+	case "FLUSHDB", "FLUSHALL":
+		return h.handleFLUSH(cmd)
+	case "SELECT":
+		return h.handleSELECT(cmd)
+	case "MOVE":
+		return h.handleMOVE(cmd)
+	case "SWAPDB":
+		return h.handleSWAPDB(cmd)
 	case "SUBSCRIBE":
 		return h.handleSUBSCRIBE(cmd)
 	case "PUBLISH":
@@ -283,16 +545,138 @@ func (h *ConnHandler) run(cmd CMD) []byte {
 		return h.handleUNSUBSCRIBE(cmd)
 	case "ZADD":
 		return h.handleZADD(cmd)
+	case "ZINCRBY":
+		return h.handleZINCRBY(cmd)
 	case "ZRANK":
-		return h.handleZRANK(cmd)
+		return h.handleZRANK(cmd, false)
+	case "ZREVRANK":
+		return h.handleZRANK(cmd, true)
 	case "ZRANGE":
 		return h.handleZRANGE(cmd)
+	case "ZRANGESTORE":
+		return h.handleZRANGESTORE(cmd)
+	case "ZREVRANGE":
+		return h.handleZRANGEBY(cmd, kv.ZRangeByRank, true)
+	case "ZRANGEBYSCORE":
+		return h.handleZRANGEBY(cmd, kv.ZRangeByScore, false)
+	case "ZREVRANGEBYSCORE":
+		return h.handleZRANGEBY(cmd, kv.ZRangeByScore, true)
+	case "ZRANGEBYLEX":
+		return h.handleZRANGEBY(cmd, kv.ZRangeByLex, false)
+	case "ZREVRANGEBYLEX":
+		return h.handleZRANGEBY(cmd, kv.ZRangeByLex, true)
+	case "ZCOUNT":
+		return h.handleZCOUNT(cmd)
+	case "ZLEXCOUNT":
+		return h.handleZLEXCOUNT(cmd)
 	case "ZCARD":
 		return h.handleZCARD(cmd)
 	case "ZSCORE":
 		return h.handleZSCORE(cmd)
 	case "ZREM":
 		return h.handleZREM(cmd)
+	case "ZMSCORE":
+		return h.handleZMSCORE(cmd)
+	case "ZRANDMEMBER":
+		return h.handleZRANDMEMBER(cmd)
+	case "ZREMRANGEBYRANK":
+		return h.handleZREMRANGEBY(cmd, kv.ZRangeByRank)
+	case "ZREMRANGEBYSCORE":
+		return h.handleZREMRANGEBY(cmd, kv.ZRangeByScore)
+	case "ZREMRANGEBYLEX":
+		return h.handleZREMRANGEBY(cmd, kv.ZRangeByLex)
+	case "ZSCAN":
+		return h.handleZSCAN(cmd)
+	case "ZUNION":
+		return h.handleZSetOp(cmd, kv.SetUnion)
+	case "ZINTER":
+		return h.handleZSetOp(cmd, kv.SetInter)
+	case "ZDIFF":
+		return h.handleZSetOp(cmd, kv.SetDiff)
+	case "ZUNIONSTORE":
+		return h.handleZSetOpStore(cmd, kv.SetUnion)
+	case "ZINTERSTORE":
+		return h.handleZSetOpStore(cmd, kv.SetInter)
+	case "ZDIFFSTORE":
+		return h.handleZSetOpStore(cmd, kv.SetDiff)
+	case "ZINTERCARD":
+		return h.handleZINTERCARD(cmd)
+	case "ZPOPMIN":
+		return h.handleZPOP(cmd, false)
+	case "ZPOPMAX":
+		return h.handleZPOP(cmd, true)
+	case "ZMPOP":
+		return h.handleZMPOP(cmd)
+	case "BZPOPMIN":
+		return h.handleBZPOP(cmd, false)
+	case "BZPOPMAX":
+		return h.handleBZPOP(cmd, true)
+	case "BZMPOP":
+		return h.handleBZMPOP(cmd)
+	case "HSET", "HMSET":
+		return h.handleHSET(cmd)
+	case "HSETNX":
+		return h.handleHSETNX(cmd)
+	case "HGET":
+		return h.handleHGET(cmd)
+	case "HMGET":
+		return h.handleHMGET(cmd)
+	case "HGETALL":
+		return h.handleHGETALL(cmd)
+	case "HKEYS":
+		return h.handleHKEYS(cmd, false)
+	case "HVALS":
+		return h.handleHKEYS(cmd, true)
+	case "HDEL":
+		return h.handleHDEL(cmd)
+	case "HEXISTS":
+		return h.handleHEXISTS(cmd)
+	case "HLEN":
+		return h.handleHLEN(cmd)
+	case "HSTRLEN":
+		return h.handleHSTRLEN(cmd)
+	case "HINCRBY":
+		return h.handleHINCRBY(cmd)
+	case "HINCRBYFLOAT":
+		return h.handleHINCRBYFLOAT(cmd)
+	case "HRANDFIELD":
+		return h.handleHRANDFIELD(cmd)
+	case "HSCAN":
+		return h.handleHSCAN(cmd)
+	case "SADD":
+		return h.handleSADD(cmd)
+	case "SREM":
+		return h.handleSREM(cmd)
+	case "SMEMBERS":
+		return h.handleSMEMBERS(cmd)
+	case "SISMEMBER":
+		return h.handleSISMEMBER(cmd)
+	case "SMISMEMBER":
+		return h.handleSMISMEMBER(cmd)
+	case "SCARD":
+		return h.handleSCARD(cmd)
+	case "SPOP":
+		return h.handleSPOP(cmd)
+	case "SRANDMEMBER":
+		return h.handleSRANDMEMBER(cmd)
+	case "SMOVE":
+		return h.handleSMOVE(cmd)
+	case "SUNION":
+		return h.handleSetOp(cmd, kv.SetUnion)
+	case "SINTER":
+		return h.handleSetOp(cmd, kv.SetInter)
+	case "SDIFF":
+		return h.handleSetOp(cmd, kv.SetDiff)
+	case "SUNIONSTORE":
+		return h.handleSetOpStore(cmd, kv.SetUnion)
+	case "SINTERSTORE":
+		return h.handleSetOpStore(cmd, kv.SetInter)
+	case "SDIFFSTORE":
+		return h.handleSetOpStore(cmd, kv.SetDiff)
+	case "SINTERCARD":
+		return h.handleSINTERCARD(cmd)
+	case "SSCAN":
+		return h.handleSSCAN(cmd)
 	case "GEOADD":
 		return h.handleGeoAdd(cmd)
 	case "GEOPOS":
@@ -307,57 +691,61 @@ func (h *ConnHandler) run(cmd CMD) []byte {
 }
 
 func (h *ConnHandler) handlePING(isSubMod bool) []byte {
-	if !isSubMod {
+	if !isSubMod || h.isResp3() {
 		return []byte("+PONG\r\n")
 	} else {
 		return resp.EncodeArray([]string{"pong", ""})
 	}
 }
 
-func (h *ConnHandler) handleLPOP(cmd CMD) []byte {
+// LPOP / RPOP key [count]
+func (h *ConnHandler) handlePOP(cmd CMD, left bool) []byte {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return wrongArgs(cmd)
+	}
 	key := cmd.Args[0]
-	var elem any
 
-	switch len(cmd.Args) {
-	case 1:
-		elem = h.s.KVStore.LPop(key)
-	case 2:
-		num, _ := strconv.Atoi(cmd.Args[1])
-		elem = h.s.KVStore.LPopN(key, num)
+	if len(cmd.Args) == 1 {
+		var (
+			elem any
+			err  error
+		)
+		if left {
+			elem, err = h.db().LPop(key)
+		} else {
+			elem, err = h.db().RPop(key)
+		}
+		if err != nil {
+			return resp.EncodeError(err)
+		}
+		if elem == nil {
+			return h.encodeNullBulkString()
+		}
+		return resp.EncodeBulkString(elem.(string))
 	}
 
-	if elem == nil {
-		return resp.EncodeNullBulkString()
+	num, err := strconv.Atoi(cmd.Args[1])
+	if err != nil || num < 0 {
+		return resp.EncodeSimpleError("value is out of range, must be positive")
 	}
-
-	switch v := elem.(type) {
-	case string:
-		return resp.EncodeBulkString(v)
-	case []string:
-		return resp.EncodeArray(v)
+	var elems []string
+	if left {
+		elems, err = h.db().LPopN(key, num)
+	} else {
+		elems, err = h.db().RPopN(key, num)
 	}
-	return []byte{}
-}
-
-func (h *ConnHandler) handleBLPOP(cmd CMD) []byte {
-	key := cmd.Args[0]
-	seconds, ok := strconv.ParseFloat(cmd.Args[1], 64)
-	if ok != nil {
-		log.Printf("Unexpected string for float64 waiting time: %s\n", cmd.Args[1])
+	if err != nil {
+		return resp.EncodeError(err)
 	}
-	timeout := time.Duration(seconds * float64(time.Second))
-
-	elem := h.s.KVStore.BLPop(key, timeout)
-	if elem == nil {
-		return resp.EncodeNullArray()
+	if elems == nil {
+		return h.encodeNullArray()
 	}
-	res := []string{key, elem.(string)}
-	return resp.EncodeArray(res)
+	return resp.EncodeArray(elems)
 }
 
 func (h *ConnHandler) handleType(cmd CMD) []byte {
 	key := cmd.Args[0]
-	t := h.s.KVStore.Type(key)
+	t := h.db().Type(key)
 	return resp.EncodeSimpleString(t)
 }
 
@@ -370,21 +758,21 @@ func (h *ConnHandler) handleXADD(cmd CMD) []byte {
 		k, v := cmd.Args[i], cmd.Args[i+1]
 		data[k] = v
 	}
-	res, t := h.s.KVStore.XAdd(key, id, data)
-	if t == kv.ErrorType {
-		return resp.EncodeSimpleError(res)
-	} else if t == kv.StringType {
-		return resp.EncodeBulkString(res)
-	} else {
-		return []byte{}
+	res, err := h.db().XAdd(key, id, data)
+	if err != nil {
+		return resp.EncodeError(err)
 	}
+	return resp.EncodeBulkString(res)
 }
 
 func (h *ConnHandler) handleXRANGE(cmd CMD) []byte {
 	key := cmd.Args[0]
 	id1, id2 := cmd.Args[1], cmd.Args[2]
 
-	resEntries := h.s.KVStore.XRange(key, id1, id2)
+	resEntries, err := h.db().XRange(key, id1, id2)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
 	return resp.EncodeStreamEntries(resEntries)
 }
 
@@ -424,26 +812,21 @@ func (h *ConnHandler) handleXREAD(cmd CMD) []byte {
 			keys[i] = cmd.Args[baseIdx+i+1]
 			ids[i] = cmd.Args[baseIdx+num+i+1]
 		}
-		resEntries := h.s.KVStore.XRead(keys, ids, count, isBlock, timeout)
+		resEntries, err := h.db().XRead(keys, ids, count, isBlock, timeout)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
 		if resEntries == nil {
-			return resp.EncodeNullArray()
+			return h.encodeNullArray()
+		}
+		if h.isResp3() {
+			return resp.EncodeStreamEntriesMap(keys, resEntries)
 		}
 		return resp.EncodeStreamEntriesWithKeys(keys, resEntries)
 	}
 	return []byte{}
 }
 
-func (h *ConnHandler) handleINCR(cmd CMD) []byte {
-	key := cmd.Args[0]
-	res, t := h.s.KVStore.Incr(key)
-
-	if t == kv.ErrorType {
-		return resp.EncodeSimpleError(res.(string))
-	}
-
-	return resp.EncodeInt64(res.(int64))
-}
-
 func (h *ConnHandler) handleMULTI() []byte {
 	h.inTransaction = true
 	return []byte("+OK\r\n")
@@ -482,26 +865,31 @@ func (h *ConnHandler) handleDISCARD() []byte {
 }
 
 func (h *ConnHandler) handleINFO(cmd CMD) []byte {
-	res := []byte{}
+	section := "default"
 	if len(cmd.Args) > 0 {
-		switch strings.ToLower(cmd.Args[0]) {
-		case "replication":
-			h.s.MasterOffsetMu.RLock()
-			infoStr := fmt.Sprintf(`# Replication
+		section = strings.ToLower(cmd.Args[0])
+	}
+	all := section == "default" || section == "all" || section == "everything"
+
+	sections := []string{}
+	if all || section == "replication" {
+		h.s.MasterOffsetMu.RLock()
+		infoStr := fmt.Sprintf(`# Replication
 role:%s
 master_replid:%s
 master_repl_offset:%d
 `,
-				h.s.Role,
-				h.s.MasterReplId,
-				h.s.MasterReplOffset,
-			)
-			h.s.MasterOffsetMu.RUnlock()
-
-			res = resp.EncodeBulkString(infoStr)
-		}
+			h.s.Role,
+			h.s.MasterReplId,
+			h.s.MasterReplOffset,
+		)
+		h.s.MasterOffsetMu.RUnlock()
+		sections = append(sections, infoStr)
 	}
-	return res
+	if all || section == "keyspace" {
+		sections = append(sections, h.keyspaceInfo())
+	}
+	return h.encodeVerbatimString(strings.Join(sections, "\n"))
 }
 
 func (h *ConnHandler) handleREPLCONF(cmd CMD) []byte {
@@ -539,6 +927,7 @@ func (h *ConnHandler) handlePSYNC() []byte {
 
 	h.s.SlaveMu.Lock()
 	h.s.SlaveConns = append(h.s.SlaveConns, h.conn)
+	h.s.replDB = -1 // the new slave needs an explicit SELECT
 	h.s.SlaveMu.Unlock()
 
 	return res
@@ -626,7 +1015,7 @@ func (h *ConnHandler) handleCONFIG(cmd CMD) []byte {
 
 func (h *ConnHandler) handleKEYS(cmd CMD) []byte {
 	query := cmd.Args[0]
-	keys := h.s.KVStore.Keys(query)
+	keys := h.db().Keys(query)
 	return resp.EncodeArray(keys)
 }
 
@@ -656,39 +1045,35 @@ func (h *ConnHandler) handleSUBSCRIBE(cmd CMD) []byte {
 	sub := psMan.subscribers[h.conn]
 	psMan.mu.RUnlock()
 
-	sub.mu.RLock()
-	_, ok = sub.Channels[chName]
-	sub.mu.RUnlock()
-
-	if !ok {
-		sub.mu.Lock()
-		sub.Channels[chName] = true
-		sub.mu.Unlock()
-	}
-
-	sub.mu.RLock()
+	sub.mu.Lock()
+	sub.Proto = h.protocol
+	sub.Channels[chName] = true
 	cnt := len(sub.Channels)
-	sub.mu.RUnlock()
+	sub.mu.Unlock()
 
-	res := fmt.Appendf([]byte{}, "*%d\r\n", 3)
-	res = append(res, resp.EncodeBulkString("subscribe")...)
-	res = append(res, resp.EncodeBulkString(chName)...)
-	res = append(res, resp.EncodeInt(cnt)...)
-	return res
+	return encodePushWithCount(h.protocol, "subscribe", chName, cnt)
 }
 
 func (h *ConnHandler) handlePUBLISH(cmd CMD) []byte {
 	chName, msg := cmd.Args[0], cmd.Args[1]
 
-	encodedMsg := resp.EncodeArray([]string{"message", chName, msg})
+	// Encode once per protocol version
+	encodedMsg := map[int][]byte{}
 
 	// Get all the clients conn
 	psMan := h.s.PubSub
 
 	psMan.mu.RLock()
 	cnt := len(psMan.channels[chName])
-	for conn := range psMan.channels[chName] {
-		conn.Write(encodedMsg)
+	for conn, sub := range psMan.channels[chName] {
+		sub.mu.RLock()
+		proto := sub.Proto
+		sub.mu.RUnlock()
+
+		if _, ok := encodedMsg[proto]; !ok {
+			encodedMsg[proto] = encodePush(proto, []string{"message", chName, msg})
+		}
+		conn.Write(encodedMsg[proto])
 	}
 	psMan.mu.RUnlock()
 
@@ -716,82 +1101,69 @@ func (h *ConnHandler) handleUNSUBSCRIBE(cmd CMD) []byte {
 	cnt := len(sub.Channels)
 	sub.mu.RUnlock()
 
-	res := fmt.Appendf([]byte{}, "*%d\r\n", 3)
-	res = append(res, resp.EncodeBulkString("unsubscribe")...)
-	res = append(res, resp.EncodeBulkString(chName)...)
-	res = append(res, resp.EncodeInt(cnt)...)
-	return res
-
+	return encodePushWithCount(h.protocol, "unsubscribe", chName, cnt)
 }
 
-func (h *ConnHandler) handleZADD(cmd CMD) []byte {
-	key := cmd.Args[0]
-	score, err := strconv.ParseFloat(cmd.Args[1], 64)
-	if err != nil {
-		log.Println(err.Error())
-		return []byte{}
-	}
-	member := cmd.Args[2]
-	isNew := h.s.KVStore.ZAdd(key, member, score)
-	if isNew {
-		return resp.EncodeInt(1)
-	} else {
-		return resp.EncodeInt(0)
+// ZRANK key member [WITHSCORE]
+// ZREVRANK key member [WITHSCORE]
+func (h *ConnHandler) handleZRANK(cmd CMD, rev bool) []byte {
+	if len(cmd.Args) < 2 || len(cmd.Args) > 3 {
+		return wrongArgs(cmd)
 	}
-}
-
-func (h *ConnHandler) handleZRANK(cmd CMD) []byte {
-	key := cmd.Args[0]
-	member := cmd.Args[1]
-
-	rnk := h.s.KVStore.ZRank(key, member)
-	if rnk == nil {
-		return resp.EncodeNullBulkString()
-	} else {
-		return resp.EncodeInt(rnk.(int))
+	withScore := len(cmd.Args) == 3
+	if withScore && !strings.EqualFold(cmd.Args[2], "WITHSCORE") {
+		return resp.EncodeSimpleError("syntax error")
 	}
-}
-
-func (h *ConnHandler) handleZRANGE(cmd CMD) []byte {
-	key := cmd.Args[0]
-
-	start, err := strconv.Atoi(cmd.Args[1])
+	rnk, score, ok, err := h.db().ZRank(cmd.Args[0], cmd.Args[1], rev)
 	if err != nil {
-		log.Println(err.Error())
-		return []byte{}
+		return resp.EncodeError(err)
 	}
-
-	end, err := strconv.Atoi(cmd.Args[2])
-	if err != nil {
-		log.Println(err.Error())
-		return []byte{}
+	if !withScore {
+		if !ok {
+			return h.encodeNullBulkString()
+		}
+		return resp.EncodeInt(rnk)
 	}
-
-	members := h.s.KVStore.ZRange(key, start, end)
-	return resp.EncodeArray(members)
+	if !ok {
+		return h.encodeNullArray()
+	}
+	res := resp.EncodeArrayHeader(2)
+	res = append(res, resp.EncodeInt(rnk)...)
+	return append(res, h.encodeDouble(score)...)
 }
 
 func (h *ConnHandler) handleZCARD(cmd CMD) []byte {
 	key := cmd.Args[0]
-	length := h.s.KVStore.ZCard(key)
+	length, err := h.db().ZCard(key)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
 	return resp.EncodeInt(length)
 }
 
 func (h *ConnHandler) handleZSCORE(cmd CMD) []byte {
 	key := cmd.Args[0]
 	member := cmd.Args[1]
-	score := h.s.KVStore.ZScore(key, member)
+	score, err := h.db().ZScore(key, member)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
 	if score == nil {
-		return resp.EncodeNullBulkString()
+		return h.encodeNullBulkString()
 	} else {
-		return resp.EncodeBulkString(strconv.FormatFloat(score.(float64), 'f', -1, 64))
+		return h.encodeDouble(score.(float64))
 	}
 }
 
+// ZREM key member [member ...]
 func (h *ConnHandler) handleZREM(cmd CMD) []byte {
-	key := cmd.Args[0]
-	member := cmd.Args[1]
-	rmNum := h.s.KVStore.ZRem(key, member)
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	rmNum, err := h.db().ZRem(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
 	return resp.EncodeInt(rmNum)
 }
 
@@ -801,9 +1173,9 @@ func (h *ConnHandler) handleGeoAdd(cmd CMD) []byte {
 	latitude, _ := strconv.ParseFloat(cmd.Args[2], 64)
 	member := cmd.Args[3]
 
-	num, err := h.s.KVStore.GEOADD(key, member, longitude, latitude)
+	num, err := h.db().GEOADD(key, member, longitude, latitude)
 	if err != nil {
-		return resp.EncodeSimpleError(fmt.Sprintf("invalid longitude,latitude pair %f,%f", longitude, latitude))
+		return resp.EncodeError(err)
 	}
 	return resp.EncodeInt(num)
 }
@@ -813,9 +1185,12 @@ func (h *ConnHandler) handleGEOPOS(cmd CMD) []byte {
 	members := cmd.Args[1:]
 	res := fmt.Appendf([]byte{}, "*%d\r\n", len(members))
 	for _, member := range members {
-		longitude, latitude, err := h.s.KVStore.GEOPOS(key, member)
+		longitude, latitude, ok, err := h.db().GEOPOS(key, member)
 		if err != nil {
-			res = append(res, resp.EncodeNullArray()...)
+			return resp.EncodeError(err)
+		}
+		if !ok {
+			res = append(res, h.encodeNullArray()...)
 		} else {
 			res = append(res, resp.EncodeArray([]string{
 				strconv.FormatFloat(longitude, 'f', -1, 64),
@@ -829,8 +1204,14 @@ func (h *ConnHandler) handleGEOPOS(cmd CMD) []byte {
 func (h *ConnHandler) handleGEODIST(cmd CMD) []byte {
 	key := cmd.Args[0]
 	m1, m2 := cmd.Args[1], cmd.Args[2]
-	distance := h.s.KVStore.GEODIST(key, m1, m2)
-	return resp.EncodeBulkString(strconv.FormatFloat(distance, 'f', -1, 64))
+	distance, err := h.db().GEODIST(key, m1, m2)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if distance == nil {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(strconv.FormatFloat(distance.(float64), 'f', -1, 64))
 }
 
 func (h *ConnHandler) hendleGEOSEARCH(cmd CMD) []byte {
@@ -847,7 +1228,10 @@ func (h *ConnHandler) hendleGEOSEARCH(cmd CMD) []byte {
 		radius *= 1609
 	}
 
-	locations := h.s.KVStore.GEOSEARCH_FROMLONLAT_BYRADIUS(key, longitude, latitude, radius)
+	locations, err := h.db().GEOSEARCH_FROMLONLAT_BYRADIUS(key, longitude, latitude, radius)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
 
 	return resp.EncodeArray(locations)
 }
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// DB returns the logical database at index i.
+func (s *Server) DB(i int) *kv.KVStore {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	return s.DBs[i]
+}
+
+func (s *Server) NumDBs() int {
+	return len(s.DBs)
+}
+
+// SwapDB exchanges two databases, so every client connected to one of
+// them immediately sees the data of the other. Blocked clients keep
+// waiting on their database index too.
+func (s *Server) SwapDB(a, b int) {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	s.DBs[a], s.DBs[b] = s.DBs[b], s.DBs[a]
+	kv.SwapWaiters(s.DBs[a], s.DBs[b])
+}
+
+// The database currently selected by the connection.
+func (h *ConnHandler) db() *kv.KVStore {
+	return h.s.DB(h.dbIndex)
+}
+
+// parseDBIndex returns the index and an error reply if it is not valid.
+func (h *ConnHandler) parseDBIndex(str string) (int, []byte) {
+	idx, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if idx < 0 || idx >= h.s.NumDBs() {
+		return 0, resp.EncodeSimpleError("DB index is out of range")
+	}
+	return idx, nil
+}
+
+// SELECT index
+func (h *ConnHandler) handleSELECT(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	idx, errReply := h.parseDBIndex(cmd.Args[0])
+	if errReply != nil {
+		return errReply
+	}
+	h.dbIndex = idx
+	return resp.EncodeSimpleString("OK")
+}
+
+// MOVE key db
+func (h *ConnHandler) handleMOVE(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	idx, errReply := h.parseDBIndex(cmd.Args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if idx == h.dbIndex {
+		return resp.EncodeSimpleError("source and destination objects are the same")
+	}
+	return resp.EncodeInt(kv.Move(h.db(), h.s.DB(idx), cmd.Args[0]))
+}
+
+// SWAPDB index1 index2
+func (h *ConnHandler) handleSWAPDB(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	a, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeSimpleError("invalid first DB index")
+	}
+	b, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return resp.EncodeSimpleError("invalid second DB index")
+	}
+	if a < 0 || a >= h.s.NumDBs() || b < 0 || b >= h.s.NumDBs() {
+		return resp.EncodeSimpleError("DB index is out of range")
+	}
+	h.s.SwapDB(a, b)
+	return resp.EncodeSimpleString("OK")
+}
+
+// keyspaceInfo builds the `# Keyspace` section of INFO, listing only
+// non-empty databases.
+func (h *ConnHandler) keyspaceInfo() string {
+	var sb strings.Builder
+	sb.WriteString("# Keyspace\n")
+	for i := range h.s.NumDBs() {
+		keys, expires, avgTTL := h.s.DB(i).KeyspaceInfo()
+		if keys == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "db%d:keys=%d,expires=%d,avg_ttl=%d\n", i, keys, expires, avgTTL)
+	}
+	return sb.String()
+}
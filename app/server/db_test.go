@@ -0,0 +1,85 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSELECT(t *testing.T) {
+	h := newTestHandler(t)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SET", "k", "db0"}, "+OK\r\n"},
+		{[]string{"SELECT", "1"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$-1\r\n"},
+		{[]string{"SET", "k", "db1"}, "+OK\r\n"},
+		{[]string{"SELECT", "16"}, "-ERR DB index is out of range\r\n"},
+		{[]string{"SELECT", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"SELECT", "0"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$3\r\ndb0\r\n"},
+		{[]string{"MOVE", "k", "0"}, "-ERR source and destination objects are the same\r\n"},
+		{[]string{"MOVE", "k", "1"}, ":0\r\n"}, // exists in db 1
+		{[]string{"MOVE", "k", "2"}, ":1\r\n"},
+		{[]string{"EXISTS", "k"}, ":0\r\n"},
+		{[]string{"SWAPDB", "0", "1"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$3\r\ndb1\r\n"},
+		{[]string{"SWAPDB", "0", "x"}, "-ERR invalid second DB index\r\n"},
+		{[]string{"SWAPDB", "0", "99"}, "-ERR DB index is out of range\r\n"},
+	}
+	for _, tt := range tests {
+		if got := h.do(tt.args...); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	got := h.keyspaceInfo()
+	want := "# Keyspace\ndb0:keys=1,expires=0,avg_ttl=0\ndb2:keys=1,expires=0,avg_ttl=0\n"
+	if got != want {
+		t.Errorf("keyspaceInfo = %q, want %q", got, want)
+	}
+}
+
+// A client blocked on database 1 keeps waiting on database 1 after
+// SWAPDB, and is served if the swapped in data has its key.
+func TestSWAPDBBlockedClient(t *testing.T) {
+	h := newTestHandler(t)
+	blocked := newTestClient(t, h.s)
+	blocked.do("SELECT", "1")
+	done := make(chan string)
+	go func() {
+		done <- blocked.do("BLPOP", "l", "5")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	h.do("RPUSH", "l", "x")
+	h.do("SWAPDB", "0", "1")
+	select {
+	case got := <-done:
+		if want := "*2\r\n$1\r\nl\r\n$1\r\nx\r\n"; got != want {
+			t.Errorf("BLPOP = %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLPOP not served after SWAPDB")
+	}
+}
+
+// The replication stream switches database before commands of another one.
+func TestSELECTPropagation(t *testing.T) {
+	h := newTestHandler(t)
+	stream := replicaStream(t, h)
+	h.do("SET", "a", "1")
+	h.do("SELECT", "3")
+	h.do("SET", "b", "1")
+	h.do("SET", "c", "1")
+
+	got := stream()
+	if n := strings.Count(got, "SELECT"); n != 2 {
+		t.Errorf("stream has %d SELECT, want 2: %q", n, got)
+	}
+	if !strings.Contains(got, "SELECT\r\n$1\r\n3\r\n*3\r\n$3\r\nSET\r\n$1\r\nb") {
+		t.Errorf("SET b not preceded by SELECT 3: %q", got)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// EXPIRE / PEXPIRE / EXPIREAT / PEXPIREAT key time [NX | XX | GT | LT]
+func (h *ConnHandler) handleEXPIRE(cmd CMD, unit time.Duration, absolute bool) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	key := cmd.Args[0]
+	t, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+
+	flag := kv.ExpireAlways
+	nx, xx, gt, lt := false, false, false, false
+	for _, opt := range cmd.Args[2:] {
+		switch strings.ToUpper(opt) {
+		case "NX":
+			nx, flag = true, kv.ExpireNX
+		case "XX":
+			xx, flag = true, kv.ExpireXX
+		case "GT":
+			gt, flag = true, kv.ExpireGT
+		case "LT":
+			lt, flag = true, kv.ExpireLT
+		default:
+			return resp.EncodeSimpleError(fmt.Sprintf("Unsupported option %s", opt))
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return resp.EncodeSimpleError("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return resp.EncodeSimpleError("GT and LT options at the same time are not compatible")
+	}
+
+	ms := t
+	if unit == time.Second {
+		if t > math.MaxInt64/1000 || t < math.MinInt64/1000 {
+			return invalidExpireTime(cmd)
+		}
+		ms = t * 1000
+	}
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if (ms > 0 && now > math.MaxInt64-ms) || (ms < 0 && now < math.MinInt64-ms) {
+			return invalidExpireTime(cmd)
+		}
+		ms += now
+	}
+
+	res := h.db().Expire(key, time.UnixMilli(ms), flag)
+	if res == 1 && !absolute {
+		// slaves expire the key at the same time as we do
+		h.propagate("PEXPIREAT", key, strconv.FormatInt(ms, 10))
+	}
+	return resp.EncodeInt(res)
+}
+
+func invalidExpireTime(cmd CMD) []byte {
+	return resp.EncodeSimpleError(fmt.Sprintf("invalid expire time in '%s' command", strings.ToLower(cmd.Command)))
+}
+
+// TTL / PTTL key
+func (h *ConnHandler) handleTTL(cmd CMD, unit time.Duration) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	at := h.db().ExpireTime(cmd.Args[0])
+	if at < 0 {
+		return resp.EncodeInt64(at)
+	}
+	ttl := max(at-time.Now().UnixMilli(), 0)
+	if unit == time.Second {
+		ttl = (ttl + 500) / 1000
+	}
+	return resp.EncodeInt64(ttl)
+}
+
+// EXPIRETIME / PEXPIRETIME key
+func (h *ConnHandler) handleEXPIRETIME(cmd CMD, unit time.Duration) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	at := h.db().ExpireTime(cmd.Args[0])
+	if at > 0 && unit == time.Second {
+		at /= 1000
+	}
+	return resp.EncodeInt64(at)
+}
+
+func (h *ConnHandler) handlePERSIST(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	return resp.EncodeInt(h.db().Persist(cmd.Args[0]))
+}
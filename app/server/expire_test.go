@@ -0,0 +1,65 @@
+package server
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEXPIRE(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("SET", "k", "v")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"EXPIRE", "k", "100"}, ":1\r\n"},
+		{[]string{"TTL", "k"}, ":100\r\n"},
+		{[]string{"EXPIRE", "k", "50", "GT"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k", "50", "LT"}, ":1\r\n"},
+		{[]string{"TTL", "k"}, ":50\r\n"},
+		{[]string{"EXPIRE", "k", "10", "NX", "XX"}, "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n"},
+		{[]string{"EXPIRE", "k", "10", "GT", "LT"}, "-ERR GT and LT options at the same time are not compatible\r\n"},
+		{[]string{"EXPIRE", "k", "10", "FOO"}, "-ERR Unsupported option FOO\r\n"},
+		{[]string{"EXPIRE", "k", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"EXPIRE", "k", "9223372036854775807"}, "-ERR invalid expire time in 'expire' command\r\n"},
+		{[]string{"PEXPIRE", "k", "9223372036854775807"}, "-ERR invalid expire time in 'pexpire' command\r\n"},
+		{[]string{"EXPIREAT", "k", "4102444800"}, ":1\r\n"},
+		{[]string{"EXPIRETIME", "k"}, ":4102444800\r\n"},
+		{[]string{"PEXPIRETIME", "k"}, ":4102444800000\r\n"},
+		{[]string{"PERSIST", "k"}, ":1\r\n"},
+		{[]string{"PTTL", "k"}, ":-1\r\n"},
+		{[]string{"PTTL", "missing"}, ":-2\r\n"},
+		{[]string{"EXPIRE", "k", "-1"}, ":1\r\n"},
+		{[]string{"EXISTS", "k"}, ":0\r\n"},
+	}
+	for _, tt := range tests {
+		if got := h.do(tt.args...); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// Relative TTLs reach the slaves as absolute times, so a slow link
+// doesn't make the copy live longer.
+func TestEXPIREPropagation(t *testing.T) {
+	h := newTestHandler(t)
+	stream := replicaStream(t, h)
+	h.do("SET", "k", "v", "EX", "100")
+	h.do("EXPIRE", "k", "200")
+
+	re := regexp.MustCompile(`(?s)PXAT\r\n\$\d+\r\n(\d+)\r\n.*PEXPIREAT\r\n\$1\r\nk\r\n\$\d+\r\n(\d+)\r\n`)
+	m := re.FindStringSubmatch(stream())
+	if m == nil {
+		t.Fatalf("propagated %q, want SET PXAT and PEXPIREAT", stream())
+	}
+	now := time.Now().UnixMilli()
+	for i, ttl := range []int64{100_000, 200_000} {
+		at, _ := strconv.ParseInt(m[i+1], 10, 64)
+		if at < now+ttl-1000 || at > now+ttl {
+			t.Errorf("propagated expiry %d, want about %d", at, now+ttl)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// HSET / HMSET key field value [field value ...]
+func (h *ConnHandler) handleHSET(cmd CMD) []byte {
+	if len(cmd.Args) < 3 || len(cmd.Args)%2 == 0 {
+		return wrongArgs(cmd)
+	}
+	added, err := h.db().HSet(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if strings.EqualFold(cmd.Command, "HMSET") {
+		return resp.EncodeSimpleString("OK")
+	}
+	return resp.EncodeInt(added)
+}
+
+// HSETNX key field value
+func (h *ConnHandler) handleHSETNX(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().HSetNX(cmd.Args[0], cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// HGET key field
+func (h *ConnHandler) handleHGET(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	val, err := h.db().HGet(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if val == nil {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(val.(string))
+}
+
+// HMGET key field [field ...]
+func (h *ConnHandler) handleHMGET(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	vals, err := h.db().HMGet(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeNullableArray(vals)
+}
+
+// HGETALL key
+func (h *ConnHandler) handleHGETALL(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	pairs, err := h.db().HGetAll(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodePairs(pairs)
+}
+
+// HKEYS / HVALS key
+func (h *ConnHandler) handleHKEYS(cmd CMD, values bool) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().HKeys(cmd.Args[0], values)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeArray(res)
+}
+
+// HDEL key field [field ...]
+func (h *ConnHandler) handleHDEL(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().HDel(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// HEXISTS key field
+func (h *ConnHandler) handleHEXISTS(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().HExists(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// HLEN key
+func (h *ConnHandler) handleHLEN(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().HLen(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// HSTRLEN key field
+func (h *ConnHandler) handleHSTRLEN(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().HStrLen(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// HINCRBY key field increment
+func (h *ConnHandler) handleHINCRBY(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	incr, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	res, err := h.db().HIncrBy(cmd.Args[0], cmd.Args[1], incr)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt64(res)
+}
+
+// HINCRBYFLOAT key field increment
+func (h *ConnHandler) handleHINCRBYFLOAT(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	incr, err := strconv.ParseFloat(cmd.Args[2], 64)
+	if err != nil || math.IsNaN(incr) {
+		return resp.EncodeSimpleError("value is not a valid float")
+	}
+	res, err := h.db().HIncrByFloat(cmd.Args[0], cmd.Args[1], incr)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeBulkString(res)
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func (h *ConnHandler) handleHRANDFIELD(cmd CMD) []byte {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 3 {
+		return wrongArgs(cmd)
+	}
+	if len(cmd.Args) == 1 {
+		pairs, err := h.db().HRandField(cmd.Args[0], 1)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
+		if len(pairs) == 0 {
+			return h.encodeNullBulkString()
+		}
+		return resp.EncodeBulkString(pairs[0])
+	}
+
+	count, errRes := parseRandCount(cmd.Args[1])
+	if errRes != nil {
+		return errRes
+	}
+	withValues := false
+	if len(cmd.Args) == 3 {
+		if !strings.EqualFold(cmd.Args[2], "WITHVALUES") {
+			return resp.EncodeSimpleError("syntax error")
+		}
+		withValues = true
+	}
+	pairs, err := h.db().HRandField(cmd.Args[0], count)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if !withValues {
+		return resp.EncodeArray(dropValues(pairs, true))
+	}
+	return h.encodePairList(pairs)
+}
+
+// encodePairList encodes a flat pair list that may contain repeated
+// members: nested [member, value] arrays for RESP3, a flat array for RESP2.
+func (h *ConnHandler) encodePairList(pairs []string) []byte {
+	if !h.isResp3() {
+		return resp.EncodeArray(pairs)
+	}
+	res := resp.EncodeArrayHeader(len(pairs) / 2)
+	for i := 0; i < len(pairs); i += 2 {
+		res = append(res, resp.EncodeArray(pairs[i:i+2])...)
+	}
+	return res
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func (h *ConnHandler) handleHSCAN(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	opts, errReply := parseScanOptions(cmd.Args[1:], false, "NOVALUES")
+	if errReply != nil {
+		return errReply
+	}
+	cursor, elems, err := h.db().HScan(cmd.Args[0], opts.cursor, opts.count, opts.pattern)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return encodeScanReply(cursor, dropValues(elems, opts.noValues))
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// PFADD key [element [element ...]]
+func (h *ConnHandler) handlePFADD(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().PFAdd(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// PFCOUNT key [key ...]
+func (h *ConnHandler) handlePFCOUNT(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().PFCount(cmd.Args)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt64(int64(res))
+}
+
+// PFMERGE destkey [sourcekey [sourcekey ...]]
+func (h *ConnHandler) handlePFMERGE(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	if err := h.db().PFMerge(cmd.Args[0], cmd.Args[1:]); err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeSimpleString("OK")
+}
@@ -0,0 +1,26 @@
+package server
+
+import "testing"
+
+func TestHyperLogLogCommands(t *testing.T) {
+	h := newTestHandler(t)
+	runSteps(t, h, []step{
+		{[]string{"PFADD", "a", "x", "y", "z"}, ":1\r\n"},
+		{[]string{"PFADD", "a", "x"}, ":0\r\n"},
+		{[]string{"PFADD", "b", "z", "w"}, ":1\r\n"},
+		{[]string{"PFCOUNT", "a"}, ":3\r\n"},
+		{[]string{"PFCOUNT", "a", "b", "missing"}, ":4\r\n"},
+		{[]string{"PFMERGE", "c", "a", "b"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "c"}, ":4\r\n"},
+		{[]string{"TYPE", "c"}, "+string\r\n"},
+		{[]string{"SET", "s", "hello"}, "+OK\r\n"},
+		{[]string{"PFADD", "s", "x"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"PFCOUNT", "s"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"PFCOUNT"}, "-ERR wrong number of arguments for 'pfcount' command\r\n"},
+	})
+
+	// the HLL survives a GET and SET round trip
+	str, _ := h.db().Get("c")
+	h.db().Set("d", str.(string))
+	runSteps(t, h, []step{{[]string{"PFCOUNT", "d"}, ":4\r\n"}})
+}
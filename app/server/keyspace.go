@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// DEL / UNLINK key [key ...]
+func (h *ConnHandler) handleDEL(cmd CMD, lazy bool) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	if lazy {
+		return resp.EncodeInt(h.db().Unlink(cmd.Args...))
+	}
+	return resp.EncodeInt(h.db().Del(cmd.Args...))
+}
+
+// EXISTS key [key ...]
+func (h *ConnHandler) handleEXISTS(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	return resp.EncodeInt(h.db().Exists(cmd.Args...))
+}
+
+// TOUCH key [key ...]
+func (h *ConnHandler) handleTOUCH(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	return resp.EncodeInt(h.db().Touch(cmd.Args...))
+}
+
+// RENAME / RENAMENX key newkey
+func (h *ConnHandler) handleRENAME(cmd CMD, nx bool) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().Rename(cmd.Args[0], cmd.Args[1], nx)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if nx {
+		return resp.EncodeInt(res)
+	}
+	return resp.EncodeSimpleString("OK")
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func (h *ConnHandler) handleCOPY(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	replace := false
+	dstDB := h.dbIndex
+	for i := 2; i < len(cmd.Args); i++ {
+		switch {
+		case strings.EqualFold(cmd.Args[i], "REPLACE"):
+			replace = true
+		case strings.EqualFold(cmd.Args[i], "DB") && i+1 < len(cmd.Args):
+			idx, errReply := h.parseDBIndex(cmd.Args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			dstDB = idx
+			i++
+		default:
+			return resp.EncodeSimpleError("syntax error")
+		}
+	}
+	res, err := h.db().Copy(cmd.Args[0], h.s.DB(dstDB), cmd.Args[1], replace)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+func (h *ConnHandler) handleRANDOMKEY(cmd CMD) []byte {
+	if len(cmd.Args) != 0 {
+		return wrongArgs(cmd)
+	}
+	key, ok := h.db().RandomKey()
+	if !ok {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(key)
+}
+
+func (h *ConnHandler) handleDBSIZE(cmd CMD) []byte {
+	if len(cmd.Args) != 0 {
+		return wrongArgs(cmd)
+	}
+	return resp.EncodeInt(h.db().DBSize())
+}
+
+// FLUSHDB / FLUSHALL [ASYNC | SYNC]
+func (h *ConnHandler) handleFLUSH(cmd CMD) []byte {
+	if len(cmd.Args) > 1 {
+		return resp.EncodeSimpleError("syntax error")
+	}
+	async := false
+	if len(cmd.Args) == 1 {
+		switch strings.ToUpper(cmd.Args[0]) {
+		case "ASYNC":
+			async = true
+		case "SYNC":
+		default:
+			return resp.EncodeSimpleError("syntax error")
+		}
+	}
+	if strings.EqualFold(cmd.Command, "FLUSHALL") {
+		for i := range h.s.NumDBs() {
+			h.s.DB(i).Flush(async)
+		}
+	} else {
+		h.db().Flush(async)
+	}
+	return resp.EncodeSimpleString("OK")
+}
+
+// OBJECT ENCODING key
+func (h *ConnHandler) handleOBJECT(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	sub := strings.ToUpper(cmd.Args[0])
+	if sub != "ENCODING" {
+		return resp.EncodeSimpleError(fmt.Sprintf("unknown subcommand '%s'. Try OBJECT HELP.", cmd.Args[0]))
+	}
+	if len(cmd.Args) != 2 {
+		return resp.EncodeSimpleError("wrong number of arguments for 'object|encoding' command")
+	}
+	enc, ok := h.db().ObjectEncoding(cmd.Args[1])
+	if !ok {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(enc)
+}
@@ -0,0 +1,398 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// LPUSHX / RPUSHX key element [element ...]
+func (h *ConnHandler) handlePUSHX(cmd CMD, left bool) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	var (
+		length int
+		err    error
+	)
+	if left {
+		length, err = h.db().LPushX(cmd.Args[0], cmd.Args[1:])
+	} else {
+		length, err = h.db().RPushX(cmd.Args[0], cmd.Args[1:])
+	}
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(length)
+}
+
+// LINDEX key index
+func (h *ConnHandler) handleLINDEX(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	index, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	elem, err := h.db().LIndex(cmd.Args[0], index)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if elem == nil {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(elem.(string))
+}
+
+// LSET key index element
+func (h *ConnHandler) handleLSET(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	index, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if err := h.db().LSet(cmd.Args[0], index, cmd.Args[2]); err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeSimpleString("OK")
+}
+
+// LINSERT key <BEFORE | AFTER> pivot element
+func (h *ConnHandler) handleLINSERT(cmd CMD) []byte {
+	if len(cmd.Args) != 4 {
+		return wrongArgs(cmd)
+	}
+	var before bool
+	switch strings.ToUpper(cmd.Args[1]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+	default:
+		return resp.EncodeSimpleError("syntax error")
+	}
+	res, err := h.db().LInsert(cmd.Args[0], before, cmd.Args[2], cmd.Args[3])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// LREM key count element
+func (h *ConnHandler) handleLREM(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	count, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	res, err := h.db().LRem(cmd.Args[0], count, cmd.Args[2])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// LTRIM key start stop
+func (h *ConnHandler) handleLTRIM(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	start, err1 := strconv.Atoi(cmd.Args[1])
+	stop, err2 := strconv.Atoi(cmd.Args[2])
+	if err1 != nil || err2 != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if err := h.db().LTrim(cmd.Args[0], start, stop); err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeSimpleString("OK")
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func (h *ConnHandler) handleLPOS(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	rank, count, maxLen := 1, 0, 0
+	hasCount := false
+	for i := 2; i < len(cmd.Args); i += 2 {
+		if i+1 >= len(cmd.Args) {
+			return resp.EncodeSimpleError("syntax error")
+		}
+		n, err := strconv.Atoi(cmd.Args[i+1])
+		if err != nil {
+			return resp.EncodeSimpleError("value is not an integer or out of range")
+		}
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "RANK":
+			if n == 0 || n == math.MinInt {
+				return resp.EncodeSimpleError("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return resp.EncodeSimpleError("COUNT can't be negative")
+			}
+			count, hasCount = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return resp.EncodeSimpleError("MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return resp.EncodeSimpleError("syntax error")
+		}
+	}
+
+	limit := count
+	if !hasCount {
+		limit = 1
+	}
+	res, err := h.db().LPos(cmd.Args[0], cmd.Args[1], rank, limit, maxLen)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if !hasCount {
+		if len(res) == 0 {
+			return h.encodeNullBulkString()
+		}
+		return resp.EncodeInt(res[0])
+	}
+	out := resp.EncodeArrayHeader(len(res))
+	for _, i := range res {
+		out = append(out, resp.EncodeInt(i)...)
+	}
+	return out
+}
+
+// parseListEnd parses the LEFT | RIGHT argument of the move commands.
+func parseListEnd(arg string) (left bool, ok bool) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// parseTimeout parses the timeout of a blocking command, in seconds with
+// an optional fraction. Zero means block forever.
+func parseTimeout(arg string) (time.Duration, []byte) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, resp.EncodeSimpleError("timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, resp.EncodeSimpleError("timeout is negative")
+	}
+	// past this the duration in nanoseconds overflows
+	if seconds > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, resp.EncodeSimpleError("timeout is out of range")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// LMOVE source destination <LEFT | RIGHT> <LEFT | RIGHT>
+func (h *ConnHandler) handleLMOVE(cmd CMD) []byte {
+	if len(cmd.Args) != 4 {
+		return wrongArgs(cmd)
+	}
+	fromLeft, ok1 := parseListEnd(cmd.Args[2])
+	toLeft, ok2 := parseListEnd(cmd.Args[3])
+	if !ok1 || !ok2 {
+		return resp.EncodeSimpleError("syntax error")
+	}
+	return h.encodeMove(h.db().LMove(cmd.Args[0], cmd.Args[1], fromLeft, toLeft))
+}
+
+// RPOPLPUSH source destination
+func (h *ConnHandler) handleRPOPLPUSH(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	return h.encodeMove(h.db().LMove(cmd.Args[0], cmd.Args[1], false, true))
+}
+
+func (h *ConnHandler) encodeMove(elem any, err error) []byte {
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if elem == nil {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(elem.(string))
+}
+
+// BLMOVE source destination <LEFT | RIGHT> <LEFT | RIGHT> timeout
+func (h *ConnHandler) handleBLMOVE(cmd CMD) []byte {
+	if len(cmd.Args) != 5 {
+		return wrongArgs(cmd)
+	}
+	fromLeft, ok1 := parseListEnd(cmd.Args[2])
+	toLeft, ok2 := parseListEnd(cmd.Args[3])
+	if !ok1 || !ok2 {
+		return resp.EncodeSimpleError("syntax error")
+	}
+	timeout, errRes := parseTimeout(cmd.Args[4])
+	if errRes != nil {
+		return errRes
+	}
+	opts := h.blockOptions(timeout, func(string, int) []string {
+		return []string{"LMOVE", cmd.Args[0], cmd.Args[1], cmd.Args[2], cmd.Args[3]}
+	})
+	return h.encodeBlockingMove(h.db().BLMove(cmd.Args[0], cmd.Args[1], fromLeft, toLeft, opts))
+}
+
+// BRPOPLPUSH source destination timeout
+func (h *ConnHandler) handleBRPOPLPUSH(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	timeout, errRes := parseTimeout(cmd.Args[2])
+	if errRes != nil {
+		return errRes
+	}
+	opts := h.blockOptions(timeout, func(string, int) []string {
+		return []string{"RPOPLPUSH", cmd.Args[0], cmd.Args[1]}
+	})
+	return h.encodeBlockingMove(h.db().BLMove(cmd.Args[0], cmd.Args[1], false, true, opts))
+}
+
+// blockOptions returns the options of a blocking command. Once served, it
+// is replicated as the command returned by replicate, which performs the
+// same pop or move without blocking.
+func (h *ConnHandler) blockOptions(timeout time.Duration, replicate func(key string, n int) []string) kv.BlockOptions {
+	return kv.BlockOptions{
+		Ctx:     h.ctx,
+		Timeout: timeout,
+		Served: func(key string, n int) {
+			h.propagate(replicate(key, n)...)
+		},
+	}
+}
+
+// listPopCommand names the non-blocking pop from the given end.
+func listPopCommand(left bool) string {
+	if left {
+		return "LPOP"
+	}
+	return "RPOP"
+}
+
+// encodeBlockingMove is encodeMove, except that a timeout gives a null
+// array like the other blocking list commands.
+func (h *ConnHandler) encodeBlockingMove(elem any, err error) []byte {
+	if err == nil && elem == nil {
+		return h.encodeNullArray()
+	}
+	return h.encodeMove(elem, err)
+}
+
+// BLPOP / BRPOP key [key ...] timeout
+func (h *ConnHandler) handleBPOP(cmd CMD, left bool) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	keys := cmd.Args[:len(cmd.Args)-1]
+	timeout, errRes := parseTimeout(cmd.Args[len(cmd.Args)-1])
+	if errRes != nil {
+		return errRes
+	}
+	opts := h.blockOptions(timeout, func(key string, _ int) []string {
+		return []string{listPopCommand(left), key}
+	})
+	key, elems, err := h.db().BLMPop(keys, left, 1, opts)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if len(elems) == 0 {
+		return h.encodeNullArray()
+	}
+	return resp.EncodeArray([]string{key, elems[0]})
+}
+
+// parseMPopArgs parses numkeys key [key ...] <end> [COUNT count], where
+// parseEnd parses the end to pop from: LEFT | RIGHT for lists, MIN | MAX
+// for sorted sets.
+func parseMPopArgs(args []string, parseEnd func(string) (bool, bool)) (keys []string, end bool, count int, errRes []byte) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, resp.EncodeSimpleError("numkeys should be greater than 0")
+	}
+	// compare without adding to numKeys, which may be as large as MaxInt
+	if numKeys > len(args)-2 {
+		return nil, false, 0, resp.EncodeSimpleError("Number of keys can't be greater than number of args")
+	}
+	keys = args[1 : numKeys+1]
+	end, ok := parseEnd(args[numKeys+1])
+	if !ok {
+		return nil, false, 0, resp.EncodeSimpleError("syntax error")
+	}
+	rest := args[numKeys+2:]
+	switch {
+	case len(rest) == 0:
+		count = 1
+	case len(rest) == 2 && strings.ToUpper(rest[0]) == "COUNT":
+		count, err = strconv.Atoi(rest[1])
+		if err != nil || count <= 0 {
+			return nil, false, 0, resp.EncodeSimpleError("count should be greater than 0")
+		}
+	default:
+		return nil, false, 0, resp.EncodeSimpleError("syntax error")
+	}
+	return keys, end, count, nil
+}
+
+// LMPOP numkeys key [key ...] <LEFT | RIGHT> [COUNT count]
+func (h *ConnHandler) handleLMPOP(cmd CMD) []byte {
+	if len(cmd.Args) < 3 {
+		return wrongArgs(cmd)
+	}
+	keys, left, count, errRes := parseMPopArgs(cmd.Args, parseListEnd)
+	if errRes != nil {
+		return errRes
+	}
+	return h.encodeMPop(h.db().LMPop(keys, left, count))
+}
+
+// BLMPOP timeout numkeys key [key ...] <LEFT | RIGHT> [COUNT count]
+func (h *ConnHandler) handleBLMPOP(cmd CMD) []byte {
+	if len(cmd.Args) < 4 {
+		return wrongArgs(cmd)
+	}
+	timeout, errRes := parseTimeout(cmd.Args[0])
+	if errRes != nil {
+		return errRes
+	}
+	keys, left, count, errRes := parseMPopArgs(cmd.Args[1:], parseListEnd)
+	if errRes != nil {
+		return errRes
+	}
+	opts := h.blockOptions(timeout, func(key string, n int) []string {
+		return []string{listPopCommand(left), key, strconv.Itoa(n)}
+	})
+	return h.encodeMPop(h.db().BLMPop(keys, left, count, opts))
+}
+
+// encodeMPop replies with the key and the popped elements, or a null
+// array when nothing was popped.
+func (h *ConnHandler) encodeMPop(key string, elems []string, err error) []byte {
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if len(elems) == 0 {
+		return h.encodeNullArray()
+	}
+	res := resp.EncodeArrayHeader(2)
+	res = append(res, resp.EncodeBulkString(key)...)
+	return append(res, resp.EncodeArray(elems)...)
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want time.Duration
+		err  string
+	}{
+		{"0", 0, ""},
+		{"1", time.Second, ""},
+		{"0.25", 250 * time.Millisecond, ""},
+		{"1e-3", time.Millisecond, ""},
+		{"-1", 0, "-ERR timeout is negative\r\n"},
+		{"abc", 0, "-ERR timeout is not a float or out of range\r\n"},
+		{"nan", 0, "-ERR timeout is not a float or out of range\r\n"},
+		{"inf", 0, "-ERR timeout is not a float or out of range\r\n"},
+		{"1e300", 0, "-ERR timeout is out of range\r\n"},
+		{"9223372037", 0, "-ERR timeout is out of range\r\n"},
+		{"9223372036", 9223372036 * time.Second, ""},
+	}
+	for _, tt := range tests {
+		got, errRes := parseTimeout(tt.arg)
+		if got != tt.want || string(errRes) != tt.err {
+			t.Errorf("parseTimeout(%q) = %v, %q, want %v, %q", tt.arg, got, errRes, tt.want, tt.err)
+		}
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	h := newTestHandler(t)
+	runSteps(t, h, []step{
+		{[]string{"RPUSHX", "l", "a"}, ":0\r\n"},
+		{[]string{"RPUSH", "l", "a", "b", "c", "b"}, ":4\r\n"},
+		{[]string{"LPUSHX", "l", "z"}, ":5\r\n"},
+		{[]string{"LINDEX", "l", "-1"}, "$1\r\nb\r\n"},
+		{[]string{"LINDEX", "l", "10"}, "$-1\r\n"},
+		{[]string{"LINDEX", "l", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"LSET", "l", "0", "y"}, "+OK\r\n"},
+		{[]string{"LSET", "l", "10", "y"}, "-ERR index out of range\r\n"},
+		{[]string{"LSET", "missing", "0", "y"}, "-ERR no such key\r\n"},
+		{[]string{"LINSERT", "l", "before", "c", "x"}, ":6\r\n"},
+		{[]string{"LINSERT", "l", "AFTER", "nope", "x"}, ":-1\r\n"},
+		{[]string{"LINSERT", "l", "AROUND", "c", "x"}, "-ERR syntax error\r\n"},
+		{[]string{"LRANGE", "l", "0", "-1"}, "*6\r\n$1\r\ny\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nx\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{[]string{"LPOS", "l", "b"}, ":2\r\n"},
+		{[]string{"LPOS", "l", "b", "RANK", "-1"}, ":5\r\n"},
+		{[]string{"LPOS", "l", "b", "COUNT", "0"}, "*2\r\n:2\r\n:5\r\n"},
+		{[]string{"LPOS", "l", "b", "MAXLEN", "2"}, "$-1\r\n"},
+		{[]string{"LPOS", "l", "b", "COUNT", "5", "MAXLEN", "2"}, "*0\r\n"},
+		{[]string{"LPOS", "l", "b", "RANK", "0"}, "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n"},
+		{[]string{"LPOS", "l", "b", "RANK", "-9223372036854775808"}, "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n"},
+		{[]string{"LPOS", "l", "b", "COUNT", "-1"}, "-ERR COUNT can't be negative\r\n"},
+		{[]string{"LPOS", "l", "b", "MAXLEN", "-1"}, "-ERR MAXLEN can't be negative\r\n"},
+		{[]string{"LPOS", "l", "b", "COUNT"}, "-ERR syntax error\r\n"},
+		{[]string{"LPOS", "l", "b", "FOO", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"LREM", "l", "-1", "b"}, ":1\r\n"},
+		{[]string{"LTRIM", "l", "1", "-2"}, "+OK\r\n"},
+		{[]string{"LRANGE", "l", "0", "-1"}, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nx\r\n"},
+		{[]string{"RPOP", "l"}, "$1\r\nx\r\n"},
+		{[]string{"RPOP", "l", "5"}, "*2\r\n$1\r\nb\r\n$1\r\na\r\n"},
+		{[]string{"EXISTS", "l"}, ":0\r\n"},
+		{[]string{"RPOP", "l"}, "$-1\r\n"},
+		{[]string{"RPOP", "l", "2"}, "*-1\r\n"},
+		{[]string{"RPOP", "l", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"LTRIM", "l", "a", "1"}, "-ERR value is not an integer or out of range\r\n"},
+	})
+}
+
+func TestMoveCommands(t *testing.T) {
+	h := newTestHandler(t)
+	runSteps(t, h, []step{
+		{[]string{"RPUSH", "src", "a", "b", "c"}, ":3\r\n"},
+		{[]string{"LMOVE", "src", "dst", "LEFT", "RIGHT"}, "$1\r\na\r\n"},
+		{[]string{"LMOVE", "src", "dst", "right", "left"}, "$1\r\nc\r\n"},
+		{[]string{"RPOPLPUSH", "src", "dst"}, "$1\r\nb\r\n"},
+		{[]string{"LRANGE", "dst", "0", "-1"}, "*3\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\na\r\n"},
+		{[]string{"LMOVE", "src", "dst", "LEFT", "RIGHT"}, "$-1\r\n"},
+		{[]string{"LMOVE", "src", "dst", "UP", "RIGHT"}, "-ERR syntax error\r\n"},
+		{[]string{"BLMOVE", "dst", "src", "LEFT", "LEFT", "0"}, "$1\r\nb\r\n"},
+		{[]string{"BLMOVE", "missing", "src", "LEFT", "LEFT", "0.01"}, "*-1\r\n"},
+		{[]string{"BRPOPLPUSH", "missing", "src", "0.01"}, "*-1\r\n"},
+		{[]string{"BLMOVE", "missing", "src", "LEFT", "LEFT", "-1"}, "-ERR timeout is negative\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"LMOVE", "src", "str", "LEFT", "LEFT"}, wrongType},
+		{[]string{"LLEN", "src"}, ":1\r\n"},
+	})
+}
+
+// A blocked move is replicated as the non-blocking move it performed,
+// after the push that served it.
+func TestBLMOVEPropagation(t *testing.T) {
+	h := newTestHandler(t)
+	stream := replicaStream(t, h)
+	blocked := newTestClient(t, h.s)
+	done := make(chan string)
+	go func() {
+		done <- blocked.do("BLMOVE", "src", "dst", "RIGHT", "LEFT", "5")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	h.do("RPUSH", "src", "x")
+	select {
+	case got := <-done:
+		if got != "$1\r\nx\r\n" {
+			t.Errorf("BLMOVE = %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLMOVE not served")
+	}
+	h.do("BRPOPLPUSH", "dst", "src", "0")
+
+	got := stream()
+	want := "*3\r\n$5\r\nRPUSH\r\n$3\r\nsrc\r\n$1\r\nx\r\n" +
+		"*5\r\n$5\r\nLMOVE\r\n$3\r\nsrc\r\n$3\r\ndst\r\n$5\r\nRIGHT\r\n$4\r\nLEFT\r\n" +
+		"*3\r\n$9\r\nRPOPLPUSH\r\n$3\r\ndst\r\n$3\r\nsrc\r\n"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("stream = %q, want it to end with %q", got, want)
+	}
+	if strings.Contains(got, "BLMOVE") || strings.Contains(got, "BRPOPLPUSH") {
+		t.Errorf("blocking command propagated as is: %q", got)
+	}
+}
+
+func TestPopCommands(t *testing.T) {
+	h := newTestHandler(t)
+	runSteps(t, h, []step{
+		{[]string{"RPUSH", "b", "1", "2", "3"}, ":3\r\n"},
+		{[]string{"BLPOP", "a", "b", "0"}, "*2\r\n$1\r\nb\r\n$1\r\n1\r\n"},
+		{[]string{"BRPOP", "a", "b", "0"}, "*2\r\n$1\r\nb\r\n$1\r\n3\r\n"},
+		{[]string{"BLPOP", "a", "0.01"}, "*-1\r\n"},
+		{[]string{"BLPOP", "a", "x"}, "-ERR timeout is not a float or out of range\r\n"},
+		{[]string{"RPUSH", "c", "4", "5", "6"}, ":3\r\n"},
+		{[]string{"LMPOP", "3", "a", "b", "c", "LEFT"}, "*2\r\n$1\r\nb\r\n*1\r\n$1\r\n2\r\n"},
+		{[]string{"LMPOP", "2", "a", "c", "RIGHT", "COUNT", "2"}, "*2\r\n$1\r\nc\r\n*2\r\n$1\r\n6\r\n$1\r\n5\r\n"},
+		{[]string{"LMPOP", "1", "a", "LEFT"}, "*-1\r\n"},
+		{[]string{"BLMPOP", "0", "2", "a", "c", "LEFT", "COUNT", "10"}, "*2\r\n$1\r\nc\r\n*1\r\n$1\r\n4\r\n"},
+		{[]string{"BLMPOP", "0.01", "1", "a", "LEFT"}, "*-1\r\n"},
+		{[]string{"LMPOP", "0", "a", "LEFT"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"LMPOP", "2", "a", "LEFT"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"LMPOP", "9223372036854775807", "a", "LEFT"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"LMPOP", "1", "a", "MIDDLE"}, "-ERR syntax error\r\n"},
+		{[]string{"LMPOP", "1", "a", "LEFT", "COUNT", "0"}, "-ERR count should be greater than 0\r\n"},
+		{[]string{"LMPOP", "1", "a", "LEFT", "COUNT"}, "-ERR syntax error\r\n"},
+		{[]string{"BLMPOP", "-1", "1", "a", "LEFT"}, "-ERR timeout is negative\r\n"},
+	})
+}
+
+// A client blocked on several keys is served from the one pushed to, and
+// replicated as the pop it made.
+func TestBLPOPPropagation(t *testing.T) {
+	h := newTestHandler(t)
+	stream := replicaStream(t, h)
+	blocked := newTestClient(t, h.s)
+	done := make(chan string)
+	go func() {
+		done <- blocked.do("BLMPOP", "5", "2", "a", "b", "RIGHT", "COUNT", "2")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	h.do("RPUSH", "b", "x", "y", "z")
+	select {
+	case got := <-done:
+		if want := "*2\r\n$1\r\nb\r\n*2\r\n$1\r\nz\r\n$1\r\ny\r\n"; got != want {
+			t.Errorf("BLMPOP = %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLMPOP not served")
+	}
+	want := "*3\r\n$4\r\nRPOP\r\n$1\r\nb\r\n$1\r\n2\r\n"
+	if got := stream(); !strings.HasSuffix(got, want) || strings.Contains(got, "BLMPOP") {
+		t.Errorf("stream = %q, want it to end with %q", got, want)
+	}
+}
+
+// Closing the connection of a blocked client unblocks it.
+func TestBLPOPClosedClient(t *testing.T) {
+	h := newTestHandler(t)
+	blocked := newTestClient(t, h.s)
+	done := make(chan string)
+	go func() {
+		done <- blocked.do("BLPOP", "l", "0")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	blocked.close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("BLPOP still blocked after the client closed")
+	}
+	h.do("RPUSH", "l", "x")
+	if got := h.do("LLEN", "l"); got != ":1\r\n" {
+		t.Errorf("LLEN after the closed client = %q, want :1", got)
+	}
+}
+
+func TestListEncoding(t *testing.T) {
+	h := newTestHandler(t)
+	big := strings.Repeat("x", 9000)
+	runSteps(t, h, []step{
+		{[]string{"RPUSH", "l", "a", "b"}, ":2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "l"}, "$8\r\nlistpack\r\n"},
+		{[]string{"RPUSH", "l", big}, ":3\r\n"},
+		{[]string{"OBJECT", "encoding", "l"}, "$9\r\nquicklist\r\n"},
+		{[]string{"RPOP", "l"}, "$9000\r\n" + big + "\r\n"},
+		{[]string{"OBJECT", "ENCODING", "l"}, "$8\r\nlistpack\r\n"},
+		{[]string{"OBJECT", "ENCODING", "missing"}, "$-1\r\n"},
+		{[]string{"OBJECT", "ENCODING"}, "-ERR wrong number of arguments for 'object|encoding' command\r\n"},
+		{[]string{"OBJECT", "FOO", "l"}, "-ERR unknown subcommand 'FOO'. Try OBJECT HELP.\r\n"},
+	})
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// lzfDecompress expands an LZF compressed RDB string into ulen bytes.
+func lzfDecompress(in []byte, ulen int) ([]byte, error) {
+	out := make([]byte, 0, ulen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// literal run of ctrl+1 bytes
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, fmt.Errorf("invalid LZF literal run")
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// back reference
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, fmt.Errorf("invalid LZF back reference")
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, fmt.Errorf("invalid LZF back reference")
+		}
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, fmt.Errorf("invalid LZF back reference")
+		}
+		// byte by byte, the reference may overlap the output being written
+		for j := range n + 2 {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != ulen {
+		return nil, fmt.Errorf("LZF decompressed %d bytes, expected %d", len(out), ulen)
+	}
+	return out, nil
+}
+
+// parseListpack decodes the entries of a listpack blob, the compact
+// encoding RDB uses for small hashes, sets, lists and sorted sets.
+// Integer entries are returned in their decimal string form.
+func parseListpack(b []byte) ([]string, error) {
+	if len(b) < 7 {
+		return nil, fmt.Errorf("listpack too short")
+	}
+	entries := []string{}
+	p := 6 // skip total bytes (4) and number of elements (2)
+	for {
+		if p >= len(b) {
+			return nil, fmt.Errorf("listpack without terminator")
+		}
+		enc := b[p]
+		if enc == 0xFF {
+			return entries, nil
+		}
+
+		var (
+			entry  string
+			length int // size of encoding byte(s) + data
+		)
+		switch {
+		case enc&0x80 == 0: // 7 bit unsigned int
+			entry, length = strconv.Itoa(int(enc&0x7F)), 1
+		case enc&0xC0 == 0x80: // 6 bit string length
+			n := int(enc & 0x3F)
+			length = 1 + n
+			if p+length > len(b) {
+				return nil, fmt.Errorf("listpack entry out of range")
+			}
+			entry = string(b[p+1 : p+length])
+		case enc&0xE0 == 0xC0: // 13 bit signed int
+			if p+2 > len(b) {
+				return nil, fmt.Errorf("listpack entry out of range")
+			}
+			v := int(enc&0x1F)<<8 | int(b[p+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			entry, length = strconv.Itoa(v), 2
+		case enc&0xF0 == 0xE0: // 12 bit string length
+			if p+2 > len(b) {
+				return nil, fmt.Errorf("listpack entry out of range")
+			}
+			n := int(enc&0x0F)<<8 | int(b[p+1])
+			length = 2 + n
+			if p+length > len(b) {
+				return nil, fmt.Errorf("listpack entry out of range")
+			}
+			entry = string(b[p+2 : p+length])
+		case enc == 0xF0: // 32 bit string length
+			if p+5 > len(b) {
+				return nil, fmt.Errorf("listpack entry out of range")
+			}
+			n := int(binary.LittleEndian.Uint32(b[p+1 : p+5]))
+			length = 5 + n
+			if p+length > len(b) {
+				return nil, fmt.Errorf("listpack entry out of range")
+			}
+			entry = string(b[p+5 : p+length])
+		case enc >= 0xF1 && enc <= 0xF4: // 16, 24, 32 and 64 bit signed int
+			size := map[byte]int{0xF1: 2, 0xF2: 3, 0xF3: 4, 0xF4: 8}[enc]
+			length = 1 + size
+			if p+length > len(b) {
+				return nil, fmt.Errorf("listpack entry out of range")
+			}
+			var u uint64
+			for i := size - 1; i >= 0; i-- {
+				u = u<<8 | uint64(b[p+1+i])
+			}
+			// sign extend
+			shift := 64 - 8*size
+			entry = strconv.FormatInt(int64(u<<shift)>>shift, 10)
+		default:
+			return nil, fmt.Errorf("invalid listpack encoding 0x%x", enc)
+		}
+
+		entries = append(entries, entry)
+		p += length + backlenSize(length)
+	}
+}
+
+// backlenSize is the number of bytes used to store an entry length.
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// parseIntset decodes an intset blob: a little endian uint32 element size
+// (2, 4 or 8 bytes), a uint32 length, then the sorted signed integers.
+func parseIntset(b []byte) ([]string, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("intset too short")
+	}
+	size := int(binary.LittleEndian.Uint32(b[0:4]))
+	n := int(binary.LittleEndian.Uint32(b[4:8]))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("invalid intset encoding %d", size)
+	}
+	if 8+n*size > len(b) {
+		return nil, fmt.Errorf("intset entry out of range")
+	}
+	members := make([]string, 0, n)
+	for i := range n {
+		p := 8 + i*size
+		var v int64
+		switch size {
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(b[p:])))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(b[p:])))
+		default:
+			v = int64(binary.LittleEndian.Uint64(b[p:]))
+		}
+		members = append(members, strconv.FormatInt(v, 10))
+	}
+	return members, nil
+}
+
+// parseZiplist decodes the entries of a ziplist blob, the compact
+// encoding of small hashes, lists and sorted sets written by Redis 6 and
+// older. Integer entries are returned in their decimal string form.
+func parseZiplist(b []byte) ([]string, error) {
+	if len(b) < 11 {
+		return nil, fmt.Errorf("ziplist too short")
+	}
+	entries := []string{}
+	p := 10 // skip total bytes (4), tail offset (4) and number of entries (2)
+	for {
+		if p >= len(b) {
+			return nil, fmt.Errorf("ziplist without terminator")
+		}
+		if b[p] == 0xFF {
+			return entries, nil
+		}
+		// length of the previous entry, 1 byte or 0xFE and 4 bytes
+		if b[p] == 0xFE {
+			p += 5
+		} else {
+			p++
+		}
+		if p >= len(b) {
+			return nil, fmt.Errorf("ziplist entry out of range")
+		}
+
+		enc := b[p]
+		var (
+			entry  string
+			header int // size of the encoding byte(s)
+			size   int // size of the data
+		)
+		switch {
+		case enc>>6 == 0: // 6 bit string length
+			header, size = 1, int(enc&0x3F)
+		case enc>>6 == 1: // 14 bit string length
+			if p+2 > len(b) {
+				return nil, fmt.Errorf("ziplist entry out of range")
+			}
+			header, size = 2, int(enc&0x3F)<<8|int(b[p+1])
+		case enc == 0x80: // 32 bit string length
+			if p+5 > len(b) {
+				return nil, fmt.Errorf("ziplist entry out of range")
+			}
+			header, size = 5, int(binary.BigEndian.Uint32(b[p+1:p+5]))
+		case enc == 0xC0: // int16
+			header, size = 1, 2
+		case enc == 0xD0: // int32
+			header, size = 1, 4
+		case enc == 0xE0: // int64
+			header, size = 1, 8
+		case enc == 0xF0: // 24 bit signed int
+			header, size = 1, 3
+		case enc == 0xFE: // 8 bit signed int
+			header, size = 1, 1
+		case enc >= 0xF1 && enc <= 0xFD: // 4 bit immediate value, 0 to 12
+			entry, header = strconv.Itoa(int(enc&0x0F)-1), 1
+		default:
+			return nil, fmt.Errorf("invalid ziplist encoding 0x%x", enc)
+		}
+		data := p + header
+		if data+size > len(b) {
+			return nil, fmt.Errorf("ziplist entry out of range")
+		}
+		switch {
+		case enc>>6 < 3: // strings
+			entry = string(b[data : data+size])
+		case size > 0: // little endian signed ints
+			var u uint64
+			for i := size - 1; i >= 0; i-- {
+				u = u<<8 | uint64(b[data+i])
+			}
+			shift := 64 - 8*size
+			entry = strconv.FormatInt(int64(u<<shift)>>shift, 10)
+		}
+		entries = append(entries, entry)
+		p = data + size
+	}
+}
+
+// parseZipmap decodes a zipmap blob, the encoding of small hashes before
+// Redis 2.6, into alternating keys and values.
+func parseZipmap(b []byte) ([]string, error) {
+	entries := []string{}
+	p := 1 // skip the number of entries, only exact below 254
+	// readLen reads a 1 byte length, or 0xFE and 4 bytes. ok is false at
+	// the 0xFF terminator.
+	readLen := func() (int, bool, error) {
+		if p >= len(b) {
+			return 0, false, fmt.Errorf("zipmap without terminator")
+		}
+		switch l := b[p]; l {
+		case 0xFF:
+			return 0, false, nil
+		case 0xFE:
+			if p+5 > len(b) {
+				return 0, false, fmt.Errorf("zipmap entry out of range")
+			}
+			p += 5
+			return int(binary.LittleEndian.Uint32(b[p-4 : p])), true, nil
+		default:
+			p++
+			return int(l), true, nil
+		}
+	}
+	readStr := func(n, skip int) (string, error) {
+		if p+skip+n > len(b) {
+			return "", fmt.Errorf("zipmap entry out of range")
+		}
+		s := string(b[p+skip : p+skip+n])
+		p += skip + n
+		return s, nil
+	}
+	for {
+		keyLen, ok, err := readLen()
+		if err != nil || !ok {
+			return entries, err
+		}
+		key, err := readStr(keyLen, 0)
+		if err != nil {
+			return nil, err
+		}
+		valLen, ok, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("zipmap key without value")
+		}
+		// one byte telling how many free bytes follow the value
+		if p >= len(b) {
+			return nil, fmt.Errorf("zipmap entry out of range")
+		}
+		free := int(b[p])
+		value, err := readStr(valLen, 1)
+		if err != nil {
+			return nil, err
+		}
+		p += free
+		entries = append(entries, key, value)
+	}
+}
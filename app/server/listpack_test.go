@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLZFDecompress(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		ulen int
+		want string
+	}{
+		{"literal", []byte{2, 'a', 'b', 'c'}, 3, "abc"},
+		{"back reference", []byte{2, 'a', 'b', 'c', 0x20, 2}, 6, "abcabc"},
+		{"overlapping reference", []byte{0, 'a', 0x60, 0}, 6, "aaaaaa"},
+		{"long reference", []byte{0, 'a', 0xE0, 3, 0}, 13, strings.Repeat("a", 13)},
+	}
+	for _, tt := range tests {
+		got, err := lzfDecompress(tt.in, tt.ulen)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s: lzfDecompress = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	for _, in := range [][]byte{
+		{5, 'a'},           // literal past the end
+		{0x20, 5},          // reference before the start
+		{0, 'a', 0x20},     // reference without offset
+		{2, 'a', 'b', 'c'}, // wrong length
+	} {
+		if _, err := lzfDecompress(in, 4); err == nil {
+			t.Errorf("lzfDecompress(%v) succeeded", in)
+		}
+	}
+}
+
+func TestParseListpack(t *testing.T) {
+	blob := []byte{
+		0, 0, 0, 0, 0, 0, // total bytes and count, not checked
+		0x81, 'f', 2, // 6 bit string
+		0x05, 1, // 7 bit uint
+		0xDF, 0x9C, 2, // 13 bit int -100
+		0xF1, 0xE8, 0x03, 3, // 16 bit int 1000
+		0xF3, 0xFE, 0xFF, 0xFF, 0xFF, 5, // 32 bit int -2
+		0xE0, 0x02, 'a', 'b', 4, // 12 bit string
+		0xFF,
+	}
+	got, err := parseListpack(blob)
+	want := []string{"f", "5", "-100", "1000", "-2", "ab"}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("parseListpack = %q, %v, want %q", got, err, want)
+	}
+	if _, err := parseListpack(blob[:len(blob)-1]); err == nil {
+		t.Error("parseListpack without terminator succeeded")
+	}
+	if _, err := parseListpack([]byte{0, 0, 0, 0, 0, 0, 0x85, 'a', 0xFF}); err == nil {
+		t.Error("parseListpack with a truncated entry succeeded")
+	}
+}
+
+func TestParseZiplist(t *testing.T) {
+	blob := []byte{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // total bytes, tail offset and count
+		0, 0x01, 'a', // 6 bit string
+		3, 0xFE, 0x85, // int8 -123
+		3, 0xF3, // immediate 2
+		2, 0xC0, 0xE8, 0x03, // int16 1000
+		4, 0xF0, 0xFE, 0xFF, 0xFF, // int24 -2
+		5, 0xE0, 1, 0, 0, 0, 0, 0, 0, 0x80, // int64 min+1
+		10, 0x40, 0x02, 'h', 'i', // 14 bit string
+		0xFE, 0, 0, 0, 0, 0x01, 'z', // 5 byte previous length
+		0xFF,
+	}
+	got, err := parseZiplist(blob)
+	want := []string{"a", "-123", "2", "1000", "-2", "-9223372036854775807", "hi", "z"}
+	if err != nil || !slices.Equal(got, want) {
+		t.Errorf("parseZiplist = %q, %v, want %q", got, err, want)
+	}
+	if _, err := parseZiplist(blob[:len(blob)-1]); err == nil {
+		t.Error("parseZiplist without terminator succeeded")
+	}
+}
+
+func TestParseZipmap(t *testing.T) {
+	blob := []byte{
+		2,
+		1, 'a', 1, 0, 'x', // a => x
+		2, 'b', 'b', 2, 1, 'y', 'y', 0, // bb => yy, with a free byte
+		0xFF,
+	}
+	got, err := parseZipmap(blob)
+	if want := []string{"a", "x", "bb", "yy"}; err != nil || !slices.Equal(got, want) {
+		t.Errorf("parseZipmap = %q, %v, want %q", got, err, want)
+	}
+	if _, err := parseZipmap([]byte{1, 1, 'a', 0xFF}); err == nil {
+		t.Error("parseZipmap of a key without value succeeded")
+	}
+}
+
+func TestParseIntset(t *testing.T) {
+	tests := []struct {
+		blob []byte
+		want []string
+	}{
+		{[]byte{2, 0, 0, 0, 2, 0, 0, 0, 0xFE, 0xFF, 0x10, 0x00}, []string{"-2", "16"}},
+		{[]byte{4, 0, 0, 0, 1, 0, 0, 0, 0x00, 0x00, 0x01, 0x00}, []string{"65536"}},
+		{[]byte{8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80}, []string{"-9223372036854775808"}},
+	}
+	for _, tt := range tests {
+		got, err := parseIntset(tt.blob)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("parseIntset(%v) = %q, %v, want %q", tt.blob, got, err, tt.want)
+		}
+	}
+	for _, blob := range [][]byte{
+		{2, 0, 0, 0},                      // too short
+		{3, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0}, // invalid size
+		{2, 0, 0, 0, 2, 0, 0, 0, 1, 0},    // truncated
+	} {
+		if _, err := parseIntset(blob); err == nil {
+			t.Errorf("parseIntset(%v) succeeded", blob)
+		}
+	}
+}
+
+// Hashes of every RDB encoding load as the same hash.
+func TestReadValueHash(t *testing.T) {
+	ziplist := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 'f', 3, 0x01, 'v', 0xFF}
+	zipmap := []byte{1, 1, 'f', 1, 0, 'v', 0xFF}
+	listpack := []byte{0, 0, 0, 0, 0, 0, 0x81, 'f', 2, 0x81, 'v', 2, 0xFF}
+	tests := []struct {
+		name      string
+		valueType byte
+		payload   []byte
+	}{
+		{"hashtable", 4, []byte{1, 1, 'f', 1, 'v'}},
+		{"zipmap", 9, append([]byte{byte(len(zipmap))}, zipmap...)},
+		{"ziplist", 13, append([]byte{byte(len(ziplist))}, ziplist...)},
+		{"listpack", 16, append([]byte{byte(len(listpack))}, listpack...)},
+	}
+	for _, tt := range tests {
+		val, err := readValue(bytes.NewReader(tt.payload), tt.valueType)
+		if err != nil {
+			t.Errorf("%s: readValue error: %v", tt.name, err)
+			continue
+		}
+		h := newTestHandler(t)
+		h.db().Store("h", val)
+		if got := h.do("HGETALL", "h"); got != "*2\r\n$1\r\nf\r\n$1\r\nv\r\n" {
+			t.Errorf("%s: HGETALL = %q", tt.name, got)
+		}
+		if got := h.do("TYPE", "h"); got != "+hash\r\n" {
+			t.Errorf("%s: TYPE = %q", tt.name, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -24,6 +25,8 @@ func (s *Server) Parse(filePath string) error {
 	}
 	log.Printf("RDB Version: %s\n", string(header[5:]))
 
+	db := s.DB(0)
+
 	for {
 		opcode, err := readByte(f)
 		if err != nil {
@@ -44,11 +47,14 @@ func (s *Server) Parse(filePath string) error {
 			if err != nil {
 				return err
 			}
-			sVal, err := readValue(f, valueType, time.Unix(int64(seconds), 0))
+			sVal, err := readValue(f, valueType)
+			if err == errValueSkipped {
+				continue
+			}
 			if err != nil {
 				return err
 			}
-			s.KVStore.Store(key, sVal)
+			loadKey(db, key, sVal, time.Unix(int64(seconds), 0))
 		case 0xFC: // expire in milliseconds
 			milliSeconds, err := readUint64(f)
 			if err != nil {
@@ -59,16 +65,23 @@ func (s *Server) Parse(filePath string) error {
 			if err != nil {
 				return err
 			}
-			sVal, err := readValue(f, valueType, time.UnixMilli(int64(milliSeconds)))
+			sVal, err := readValue(f, valueType)
+			if err == errValueSkipped {
+				continue
+			}
 			if err != nil {
 				return err
 			}
-			s.KVStore.Store(key, sVal)
+			loadKey(db, key, sVal, time.UnixMilli(int64(milliSeconds)))
 		case 0xFE: // SELECTDB - read db number and continue to next database
-			dbNum, err := readByte(f)
+			dbNum, _, err := readLength(f)
 			if err != nil {
 				return err
 			}
+			if dbNum >= uint64(s.NumDBs()) {
+				return fmt.Errorf("RDB selects db %d, but only %d databases are configured", dbNum, s.NumDBs())
+			}
+			db = s.DB(int(dbNum))
 			log.Printf("Switched to database: %d\n", dbNum)
 		case 0xFA: // AUX fields
 			if _, err := readString(f); err != nil {
@@ -98,17 +111,32 @@ func (s *Server) Parse(filePath string) error {
 			if err != nil {
 				return err
 			}
-			sVal, err := readValue(f, valueType, time.Time{})
+			sVal, err := readValue(f, valueType)
+			if err == errValueSkipped {
+				continue
+			}
 			if err != nil {
 				return err
 			}
-			s.KVStore.Store(key, sVal)
+			loadKey(db, key, sVal, time.Time{})
 		}
 	}
 
 	return nil
 }
 
+// loadKey stores a key read from the RDB file into db. Keys that already expired
+// are skipped. A zero expireAt means the key has no expiry.
+func loadKey(db *kv.KVStore, key string, sVal kv.StoreValue, expireAt time.Time) {
+	if !expireAt.IsZero() && !time.Now().Before(expireAt) {
+		return
+	}
+	db.Store(key, sVal)
+	if !expireAt.IsZero() {
+		db.SetExpireAt(key, expireAt)
+	}
+}
+
 func readByte(r io.Reader) (byte, error) {
 	var b [1]byte
 	if _, err := io.ReadFull(r, b[:]); err != nil {
@@ -149,6 +177,14 @@ func readLength(r io.Reader) (uint64, bool, error) {
 		}
 		return uint64(first[0]&0x3F)<<8 | uint64(next[0]), false, nil
 	case 2:
+		if first[0] == 0x81 {
+			// 64-bit length, like the millisecond part of stream IDs
+			var next [8]byte
+			if _, err := io.ReadFull(r, next[:]); err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(next[:]), false, nil
+		}
 		var next [4]byte
 		if _, err := io.ReadFull(r, next[:]); err != nil {
 			return 0, false, err
@@ -193,7 +229,23 @@ func readString(r io.Reader) (string, error) {
 			}
 			return fmt.Sprintf("%d", binary.LittleEndian.Uint32(val[:])), nil
 		case 3: // LZF compressed string
-			return "", fmt.Errorf("LZF compressed strings not supported")
+			clen, _, err := readLength(r)
+			if err != nil {
+				return "", err
+			}
+			ulen, _, err := readLength(r)
+			if err != nil {
+				return "", err
+			}
+			compressed := make([]byte, clen)
+			if _, err := io.ReadFull(r, compressed); err != nil {
+				return "", err
+			}
+			buf, err := lzfDecompress(compressed, int(ulen))
+			if err != nil {
+				return "", err
+			}
+			return string(buf), nil
 		default:
 			return "", fmt.Errorf("unknown special string encoding: %d", special)
 		}
@@ -225,23 +277,297 @@ func readString(r io.Reader) (string, error) {
 	return string(buf), nil
 }
 
-func readValue(r io.Reader, valueType byte, expireAt time.Time) (kv.StoreValue, error) {
+func readValue(r io.Reader, valueType byte) (kv.StoreValue, error) {
 	switch valueType {
 	case 0: // string - use readString to handle special encodings
 		val, err := readString(r)
 		if err != nil {
 			return kv.StoreValue{}, err
 		} else {
-			var px int
-			if expireAt.IsZero() {
-				px = -1
-			} else {
-				px = int(time.Until(expireAt).Milliseconds())
-			}
-			strVal := kv.NewStringValue(val, px)
+			strVal := kv.NewStringValue(val)
 			return kv.NewStoreValue(kv.StringType, strVal), nil
 		}
+	case 2: // set - number of members followed by member strings
+		n, _, err := readLength(r)
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		members := make([]string, 0, n)
+		for range n {
+			member, err := readString(r)
+			if err != nil {
+				return kv.StoreValue{}, err
+			}
+			members = append(members, member)
+		}
+		return kv.NewStoreValue(kv.SetType, kv.NewSetValueFrom(members)), nil
+	case 11: // set in intset encoding
+		blob, err := readString(r)
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		members, err := parseIntset([]byte(blob))
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		return kv.NewStoreValue(kv.SetType, kv.NewSetValueFrom(members)), nil
+	case 20: // set in listpack encoding
+		members, err := readListpack(r)
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		return kv.NewStoreValue(kv.SetType, kv.NewSetValueFrom(members)), nil
+	case 4: // hash - number of pairs followed by field and value strings
+		n, _, err := readLength(r)
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		pairs := make([]string, 0, 2*n)
+		for range 2 * n {
+			str, err := readString(r)
+			if err != nil {
+				return kv.StoreValue{}, err
+			}
+			pairs = append(pairs, str)
+		}
+		return kv.NewStoreValue(kv.HashType, kv.NewHashValueFrom(pairs)), nil
+	case 16: // hash in listpack encoding - alternating fields and values
+		entries, err := readListpack(r)
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		return kv.NewStoreValue(kv.HashType, kv.NewHashValueFrom(entries)), nil
+	case 9: // hash in zipmap encoding
+		blob, err := readString(r)
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		entries, err := parseZipmap([]byte(blob))
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		return kv.NewStoreValue(kv.HashType, kv.NewHashValueFrom(entries)), nil
+	case 13: // hash in ziplist encoding - alternating fields and values
+		blob, err := readString(r)
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		entries, err := parseZiplist([]byte(blob))
+		if err != nil {
+			return kv.StoreValue{}, err
+		}
+		return kv.NewStoreValue(kv.HashType, kv.NewHashValueFrom(entries)), nil
 	default:
-		return kv.StoreValue{}, nil
+		if err := skipValue(r, valueType); err != nil {
+			return kv.StoreValue{}, err
+		}
+		log.Printf("Skipping RDB value of unsupported type %d\n", valueType)
+		return kv.StoreValue{}, errValueSkipped
+	}
+}
+
+// errValueSkipped is returned by readValue for a value it consumed
+// without loading it. The entry is dropped and loading goes on.
+var errValueSkipped = errors.New("RDB value skipped")
+
+// skipValue consumes a value of a type readValue doesn't load, so the
+// entries after it can still be read. Only a type whose layout is
+// unknown fails the load.
+func skipValue(r io.Reader, valueType byte) error {
+	switch valueType {
+	case 1, 14: // list, quicklist of ziplists: n strings
+		return skipFields(r, 1, 0)
+	case 3: // zset: n members with a string score
+		n, _, err := readLength(r)
+		if err != nil {
+			return err
+		}
+		for range n {
+			if _, err := readString(r); err != nil {
+				return err
+			}
+			// 1-byte length, or 253-255 for nan, +inf and -inf
+			var size [1]byte
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return err
+			}
+			if size[0] < 253 {
+				if err := skipBytes(r, int(size[0])); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case 5: // zset2: n members with a binary double score
+		return skipFields(r, 1, 8)
+	case 10, 12, 17: // ziplist or listpack blob
+		_, err := readString(r)
+		return err
+	case 18: // quicklist2: n nodes, each a container type and a blob
+		n, _, err := readLength(r)
+		if err != nil {
+			return err
+		}
+		for range n {
+			if _, _, err := readLength(r); err != nil {
+				return err
+			}
+			if _, err := readString(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 7: // module value, made of opcodes up to EOF
+		return skipModuleValue(r)
+	case 15, 19, 21: // stream listpacks, versions 1 to 3
+		return skipStream(r, valueType)
+	}
+	return fmt.Errorf("unsupported RDB value type: %d", valueType)
+}
+
+// skipFields reads a count, then that many groups of perEntry strings
+// followed by raw bytes each.
+func skipFields(r io.Reader, perEntry, raw int) error {
+	n, _, err := readLength(r)
+	if err != nil {
+		return err
+	}
+	for range n {
+		for range perEntry {
+			if _, err := readString(r); err != nil {
+				return err
+			}
+		}
+		if err := skipBytes(r, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skipBytes(r io.Reader, n int) error {
+	_, err := io.CopyN(io.Discard, r, int64(n))
+	return err
+}
+
+// skipLengths reads n length-encoded integers.
+func skipLengths(r io.Reader, n int) error {
+	for range n {
+		if _, _, err := readLength(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipModuleValue consumes the module ID and the opcode-tagged values
+// that follow, up to the EOF opcode.
+func skipModuleValue(r io.Reader) error {
+	if err := skipLengths(r, 1); err != nil {
+		return err
+	}
+	for {
+		opcode, _, err := readLength(r)
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case 0: // EOF
+			return nil
+		case 1, 2: // signed and unsigned integers
+			err = skipLengths(r, 1)
+		case 3: // float
+			err = skipBytes(r, 4)
+		case 4: // double
+			err = skipBytes(r, 8)
+		case 5: // string
+			_, err = readString(r)
+		default:
+			return fmt.Errorf("unknown RDB module opcode: %d", opcode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipStream consumes a stream: its listpacks, metadata and consumer
+// groups. Later versions add fields to the metadata and consumers.
+func skipStream(r io.Reader, valueType byte) error {
+	// listpacks, each keyed by its master entry ID
+	if err := skipFields(r, 2, 0); err != nil {
+		return err
+	}
+	// length and last ID, then first ID, max deleted ID and entries added
+	metadata := 3
+	if valueType >= 19 {
+		metadata += 5
+	}
+	if err := skipLengths(r, metadata); err != nil {
+		return err
+	}
+	groups, _, err := readLength(r)
+	if err != nil {
+		return err
+	}
+	for range groups {
+		// name, last delivered ID and entries read
+		if _, err := readString(r); err != nil {
+			return err
+		}
+		fields := 2
+		if valueType >= 19 {
+			fields++
+		}
+		if err := skipLengths(r, fields); err != nil {
+			return err
+		}
+		// pending entries: raw ID, delivery time and delivery count
+		pending, _, err := readLength(r)
+		if err != nil {
+			return err
+		}
+		for range pending {
+			if err := skipBytes(r, 16+8); err != nil {
+				return err
+			}
+			if err := skipLengths(r, 1); err != nil {
+				return err
+			}
+		}
+		consumers, _, err := readLength(r)
+		if err != nil {
+			return err
+		}
+		for range consumers {
+			// name, seen time, active time, then the raw IDs it owns
+			if _, err := readString(r); err != nil {
+				return err
+			}
+			times := 8
+			if valueType >= 21 {
+				times += 8
+			}
+			if err := skipBytes(r, times); err != nil {
+				return err
+			}
+			owned, _, err := readLength(r)
+			if err != nil {
+				return err
+			}
+			if err := skipBytes(r, 16*int(owned)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readListpack reads a listpack stored as an RDB string.
+func readListpack(r io.Reader) ([]string, error) {
+	blob, err := readString(r)
+	if err != nil {
+		return nil, err
 	}
+	return parseListpack([]byte(blob))
 }
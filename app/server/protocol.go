@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+const serverVersion = "7.2.0"
+
+// Reply helpers that pick the RESP2 or RESP3 representation according to
+// the protocol negotiated by the client with HELLO.
+
+func (h *ConnHandler) isResp3() bool {
+	return h.protocol == 3
+}
+
+func (h *ConnHandler) encodeNullBulkString() []byte {
+	if h.isResp3() {
+		return resp.EncodeNull()
+	}
+	return resp.EncodeNullBulkString()
+}
+
+func (h *ConnHandler) encodeNullArray() []byte {
+	if h.isResp3() {
+		return resp.EncodeNull()
+	}
+	return resp.EncodeNullArray()
+}
+
+func (h *ConnHandler) encodeDouble(f float64) []byte {
+	if h.isResp3() {
+		return resp.EncodeDouble(f)
+	}
+	return resp.EncodeBulkString(resp.FormatDouble(f))
+}
+
+// Map with n pairs. RESP2 clients get a flat array of 2*n elements.
+func (h *ConnHandler) encodeMapHeader(n int) []byte {
+	if h.isResp3() {
+		return resp.EncodeMapHeader(n)
+	}
+	return resp.EncodeArrayHeader(n * 2)
+}
+
+func (h *ConnHandler) encodeSet(l []string) []byte {
+	if h.isResp3() {
+		return resp.EncodeSet(l)
+	}
+	return resp.EncodeArray(l)
+}
+
+// Flat field/value list as a map. RESP2 clients get the flat array.
+func (h *ConnHandler) encodePairs(pairs []string) []byte {
+	res := h.encodeMapHeader(len(pairs) / 2)
+	for _, str := range pairs {
+		res = append(res, resp.EncodeBulkString(str)...)
+	}
+	return res
+}
+
+// Array of bulk strings where nil elements are encoded as nulls.
+func (h *ConnHandler) encodeNullableArray(l []any) []byte {
+	res := resp.EncodeArrayHeader(len(l))
+	for _, v := range l {
+		if v == nil {
+			res = append(res, h.encodeNullBulkString()...)
+		} else {
+			res = append(res, resp.EncodeBulkString(v.(string))...)
+		}
+	}
+	return res
+}
+
+func (h *ConnHandler) encodeVerbatimString(str string) []byte {
+	if h.isResp3() {
+		return resp.EncodeVerbatimString("txt", str)
+	}
+	return resp.EncodeBulkString(str)
+}
+
+// Out-of-band messages such as pub/sub deliveries.
+func encodePush(protocol int, l []string) []byte {
+	if protocol == 3 {
+		return resp.EncodePush(l)
+	}
+	return resp.EncodeArray(l)
+}
+
+// Push frame with a trailing integer, e.g. subscribe confirmations.
+func encodePushWithCount(protocol int, kind, channel string, cnt int) (res []byte) {
+	if protocol == 3 {
+		res = resp.EncodePushHeader(3)
+	} else {
+		res = resp.EncodeArrayHeader(3)
+	}
+	res = append(res, resp.EncodeBulkString(kind)...)
+	res = append(res, resp.EncodeBulkString(channel)...)
+	res = append(res, resp.EncodeInt(cnt)...)
+	return
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func (h *ConnHandler) handleHELLO(cmd CMD) []byte {
+	protocol := h.protocol
+	args := cmd.Args
+	if len(args) > 0 {
+		ver, err := strconv.Atoi(args[0])
+		if err != nil {
+			return resp.EncodeSimpleError("Protocol version is not an integer or out of range")
+		}
+		if ver != 2 && ver != 3 {
+			return resp.EncodeRawError("NOPROTO unsupported protocol version")
+		}
+		protocol = ver
+		args = args[1:]
+	}
+
+	name := h.name
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "AUTH") && i+2 < len(args):
+			// There is no ACL support: the default user has no password.
+			i += 2
+		case strings.EqualFold(args[i], "SETNAME") && i+1 < len(args):
+			name = args[i+1]
+			if strings.ContainsAny(name, " \n") {
+				return resp.EncodeSimpleError("Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+		default:
+			return resp.EncodeSimpleError(fmt.Sprintf("Syntax error in HELLO option '%s'", args[i]))
+		}
+	}
+	h.protocol = protocol
+	h.name = name
+
+	role := h.s.Role
+	if role == "slave" {
+		role = "replica"
+	}
+
+	res := h.encodeMapHeader(7)
+	res = append(res, resp.EncodeBulkString("server")...)
+	res = append(res, resp.EncodeBulkString("redis")...)
+	res = append(res, resp.EncodeBulkString("version")...)
+	res = append(res, resp.EncodeBulkString(serverVersion)...)
+	res = append(res, resp.EncodeBulkString("proto")...)
+	res = append(res, resp.EncodeInt(h.protocol)...)
+	res = append(res, resp.EncodeBulkString("id")...)
+	res = append(res, resp.EncodeInt64(h.id)...)
+	res = append(res, resp.EncodeBulkString("mode")...)
+	res = append(res, resp.EncodeBulkString("standalone")...)
+	res = append(res, resp.EncodeBulkString("role")...)
+	res = append(res, resp.EncodeBulkString(role)...)
+	res = append(res, resp.EncodeBulkString("modules")...)
+	res = append(res, resp.EncodeEmptyArray()...)
+	return res
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHELLO(t *testing.T) {
+	h := newTestHandler(t)
+	if got := h.do("HELLO"); !strings.HasPrefix(got, "*14\r\n$6\r\nserver\r\n") || !strings.Contains(got, "$5\r\nproto\r\n:2\r\n") {
+		t.Errorf("HELLO = %q, want a RESP2 array with proto 2", got)
+	}
+	if got := h.do("HELLO", "3", "SETNAME", "app"); !strings.HasPrefix(got, "%7\r\n") || !strings.Contains(got, "$5\r\nproto\r\n:3\r\n") {
+		t.Errorf("HELLO 3 = %q, want a RESP3 map with proto 3", got)
+	}
+	if h.protocol != 3 || h.name != "app" {
+		t.Errorf("after HELLO 3 SETNAME app, protocol = %d, name = %q", h.protocol, h.name)
+	}
+
+	errs := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"HELLO", "4"}, "-NOPROTO unsupported protocol version\r\n"},
+		{[]string{"HELLO", "x"}, "-ERR Protocol version is not an integer or out of range\r\n"},
+		{[]string{"HELLO", "2", "FOO"}, "-ERR Syntax error in HELLO option 'FOO'\r\n"},
+	}
+	for _, tt := range errs {
+		if got := h.do(tt.args...); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+	// a failed HELLO keeps the protocol
+	if h.protocol != 3 {
+		t.Errorf("protocol = %d after failed HELLO, want 3", h.protocol)
+	}
+}
+
+func TestResp3Replies(t *testing.T) {
+	tests := []struct {
+		args  []string
+		resp2 string
+		resp3 string
+	}{
+		{[]string{"GET", "missing"}, "$-1\r\n", "_\r\n"},
+		{[]string{"HGETALL", "h"}, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n", "%1\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"SMEMBERS", "s"}, "*1\r\n$1\r\nm\r\n", "~1\r\n$1\r\nm\r\n"},
+		{[]string{"ZSCORE", "z", "m"}, "$3\r\n1.5\r\n", ",1.5\r\n"},
+	}
+	h := newTestHandler(t)
+	h.do("HSET", "h", "f", "v")
+	h.do("SADD", "s", "m")
+	h.do("ZADD", "z", "1.5", "m")
+	for _, proto := range []string{"2", "3"} {
+		h.do("HELLO", proto)
+		for _, tt := range tests {
+			want := tt.resp2
+			if proto == "3" {
+				want = tt.resp3
+			}
+			if got := h.do(tt.args...); got != want {
+				t.Errorf("RESP%s %v = %q, want %q", proto, tt.args, got, want)
+			}
+		}
+	}
+}
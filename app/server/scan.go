@@ -0,0 +1,105 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+type scanOptions struct {
+	cursor   uint64
+	pattern  string
+	count    int
+	typeName string
+	noValues bool
+}
+
+// parseScanOptions parses `cursor [MATCH pattern] [COUNT count] [TYPE type]`.
+// TYPE is only valid for SCAN and NOVALUES/NOSCORES only for the collections.
+func parseScanOptions(args []string, allowType bool, noValuesOpt string) (scanOptions, []byte) {
+	opts := scanOptions{count: 10}
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return opts, resp.EncodeSimpleError("invalid cursor")
+	}
+	opts.cursor = cursor
+
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "MATCH" && i+1 < len(args):
+			opts.pattern = args[i+1]
+			if opts.pattern == "*" {
+				opts.pattern = ""
+			}
+			i++
+		case opt == "COUNT" && i+1 < len(args):
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return opts, resp.EncodeSimpleError("value is not an integer or out of range")
+			}
+			if count < 1 {
+				return opts, resp.EncodeSimpleError("syntax error")
+			}
+			opts.count = count
+			i++
+		case opt == "TYPE" && allowType && i+1 < len(args):
+			opts.typeName = strings.ToLower(args[i+1])
+			i++
+		case noValuesOpt != "" && opt == noValuesOpt:
+			opts.noValues = true
+		default:
+			return opts, resp.EncodeSimpleError("syntax error")
+		}
+	}
+	return opts, nil
+}
+
+func encodeScanReply(cursor uint64, elems []string) []byte {
+	res := resp.EncodeArrayHeader(2)
+	res = append(res, resp.EncodeBulkString(strconv.FormatUint(cursor, 10))...)
+	res = append(res, resp.EncodeArray(elems)...)
+	return res
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func (h *ConnHandler) handleSCAN(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	opts, errReply := parseScanOptions(cmd.Args, true, "")
+	if errReply != nil {
+		return errReply
+	}
+	cursor, keys := h.db().Scan(opts.cursor, opts.count, opts.pattern, opts.typeName)
+	return encodeScanReply(cursor, keys)
+}
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count] [NOSCORES]
+func (h *ConnHandler) handleZSCAN(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	opts, errReply := parseScanOptions(cmd.Args[1:], false, "NOSCORES")
+	if errReply != nil {
+		return errReply
+	}
+	cursor, elems, err := h.db().ZScan(cmd.Args[0], opts.cursor, opts.count, opts.pattern)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return encodeScanReply(cursor, dropValues(elems, opts.noValues))
+}
+
+// dropValues keeps only the members of a flat member/value list.
+func dropValues(elems []string, noValues bool) []string {
+	if !noValues {
+		return elems
+	}
+	members := make([]string, 0, len(elems)/2)
+	for i := 0; i < len(elems); i += 2 {
+		members = append(members, elems[i])
+	}
+	return members
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseScanOptions(t *testing.T) {
+	tests := []struct {
+		args        []string
+		allowType   bool
+		noValuesOpt string
+		want        scanOptions
+		wantErr     string
+	}{
+		{[]string{"0"}, true, "", scanOptions{count: 10}, ""},
+		{[]string{"17", "MATCH", "a*", "COUNT", "5", "TYPE", "HASH"}, true, "", scanOptions{cursor: 17, pattern: "a*", count: 5, typeName: "hash"}, ""},
+		{[]string{"0", "match", "*"}, true, "", scanOptions{count: 10}, ""},
+		{[]string{"0", "NOSCORES"}, false, "NOSCORES", scanOptions{count: 10, noValues: true}, ""},
+		{[]string{"x"}, true, "", scanOptions{}, "-ERR invalid cursor\r\n"},
+		{[]string{"-1"}, true, "", scanOptions{}, "-ERR invalid cursor\r\n"},
+		{[]string{"0", "COUNT", "0"}, true, "", scanOptions{}, "-ERR syntax error\r\n"},
+		{[]string{"0", "COUNT", "x"}, true, "", scanOptions{}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"0", "TYPE", "set"}, false, "", scanOptions{}, "-ERR syntax error\r\n"},
+		{[]string{"0", "NOVALUES"}, true, "", scanOptions{}, "-ERR syntax error\r\n"},
+		{[]string{"0", "MATCH"}, true, "", scanOptions{}, "-ERR syntax error\r\n"},
+	}
+	for _, tt := range tests {
+		got, errReply := parseScanOptions(tt.args, tt.allowType, tt.noValuesOpt)
+		if string(errReply) != tt.wantErr {
+			t.Errorf("parseScanOptions(%q) error = %q, want %q", tt.args, errReply, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == "" && got != tt.want {
+			t.Errorf("parseScanOptions(%q) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestKEYS(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("MSET", "user:1", "a", "user:2", "b", "item:1", "c")
+	got := h.do("KEYS", "user:*")
+	for _, want := range []string{"*2\r\n", "$6\r\nuser:1\r\n", "$6\r\nuser:2\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("KEYS user:* = %q, missing %q", got, want)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/codecrafters-io/redis-starter-go/app/kv"
 	"github.com/codecrafters-io/redis-starter-go/app/resp"
@@ -31,10 +32,12 @@ type Server struct {
 
 	SlaveReplOffset int // Only written by slave itself.
 
-	KVStore *kv.KVStore // Concurrent safe. No need for mutex.
+	dbMu sync.RWMutex
+	DBs  []*kv.KVStore // Logical databases picked with SELECT. Each one is concurrent safe.
 
 	SlaveMu    sync.RWMutex
 	SlaveConns []net.Conn // Written by slaves. Read by self.
+	replDB     int        // Last db selected in the replication stream. Guarded by SlaveMu.
 
 	ackMu  sync.RWMutex
 	ackCnt int
@@ -43,6 +46,8 @@ type Server struct {
 	Dbfilename string
 
 	PubSub *PubSubManager
+
+	nextClientID atomic.Int64
 }
 
 // Pub/Sub 管理器
@@ -61,6 +66,7 @@ type PubSubManager struct {
 
 type Subscriber struct {
 	mu       sync.RWMutex
+	Proto    int             // RESP version used to deliver messages
 	Channels map[string]bool // 订阅的普通 channel
 	// Patterns map[string]bool // 订阅的 pattern
 	// WriteCh  chan []byte // 异步写入通道，避免阻塞发布者
@@ -76,11 +82,16 @@ func NewPubSubManager() *PubSubManager {
 
 func NewSubscriber() *Subscriber {
 	return &Subscriber{
+		Proto:    2,
 		Channels: make(map[string]bool),
 	}
 }
 
-func NewServer(host string, port int, role string, masterReplId string, masterReplOffset int, replicaof string, dir, dbfilename string) *Server {
+func NewServer(host string, port int, role string, masterReplId string, masterReplOffset int, replicaof string, dir, dbfilename string, databases int) *Server {
+	dbs := make([]*kv.KVStore, databases)
+	for i := range dbs {
+		dbs[i] = kv.NewKVStore()
+	}
 	server := &Server{
 		Host:             host,
 		Port:             port,
@@ -88,8 +99,9 @@ func NewServer(host string, port int, role string, masterReplId string, masterRe
 		MasterReplId:     masterReplId,
 		MasterReplOffset: masterReplOffset,
 		Replicaof:        replicaof,
-		KVStore:          kv.NewKVStore(),
+		DBs:              dbs,
 		SlaveConns:       []net.Conn{},
+		replDB:           -1,
 		Dir:              dir,
 		Dbfilename:       dbfilename,
 		PubSub:           NewPubSubManager(),
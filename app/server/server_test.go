@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// newTestHandler returns a handler of a fresh master server, for running
+// commands directly with do.
+func newTestHandler(t *testing.T) *ConnHandler {
+	t.Helper()
+	return newTestClient(t, NewServer("localhost", 0, "master", "", 0, "", "", "", 16))
+}
+
+// newTestClient returns another client of the server s.
+func newTestClient(t *testing.T, s *Server) *ConnHandler {
+	t.Helper()
+	conn, peer := net.Pipe()
+	t.Cleanup(func() {
+		conn.Close()
+		peer.Close()
+	})
+	return NewConnHandler(conn, s)
+}
+
+// do runs a command and returns its raw reply.
+func (h *ConnHandler) do(args ...string) string {
+	return string(h.run(CMD{Command: args[0], Args: args[1:]}))
+}
+
+// recordConn is a fake slave connection keeping what is written to it.
+type recordConn struct {
+	net.Conn
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = append(c.buf, b...)
+	return len(b), nil
+}
+
+// replicaStream registers a fake slave with the server of h and returns a
+// function giving what was propagated to it so far.
+func replicaStream(t *testing.T, h *ConnHandler) func() string {
+	t.Helper()
+	conn := &recordConn{}
+	h.s.SlaveMu.Lock()
+	h.s.SlaveConns = append(h.s.SlaveConns, conn)
+	h.s.SlaveMu.Unlock()
+	return func() string {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		return string(conn.buf)
+	}
+}
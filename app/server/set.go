@@ -0,0 +1,265 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// SADD key member [member ...]
+func (h *ConnHandler) handleSADD(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SAdd(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// SREM key member [member ...]
+func (h *ConnHandler) handleSREM(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SRem(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// SMEMBERS key
+func (h *ConnHandler) handleSMEMBERS(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SMembers(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeSet(res)
+}
+
+// SISMEMBER key member
+func (h *ConnHandler) handleSISMEMBER(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SIsMember(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res[0])
+}
+
+// SMISMEMBER key member [member ...]
+func (h *ConnHandler) handleSMISMEMBER(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SIsMember(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	out := resp.EncodeArrayHeader(len(res))
+	for _, v := range res {
+		out = append(out, resp.EncodeInt(v)...)
+	}
+	return out
+}
+
+// SCARD key
+func (h *ConnHandler) handleSCARD(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SCard(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// SPOP key [count]
+func (h *ConnHandler) handleSPOP(cmd CMD) []byte {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return wrongArgs(cmd)
+	}
+	if len(cmd.Args) == 1 {
+		res, err := h.db().SPop(cmd.Args[0], 1)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
+		if len(res) == 0 {
+			return h.encodeNullBulkString()
+		}
+		h.propagateSPop(cmd.Args[0], res)
+		return resp.EncodeBulkString(res[0])
+	}
+	count, err := strconv.Atoi(cmd.Args[1])
+	if err != nil || count < 0 {
+		return resp.EncodeSimpleError("value is out of range, must be positive")
+	}
+	res, err := h.db().SPop(cmd.Args[0], count)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	h.propagateSPop(cmd.Args[0], res)
+	return h.encodeSet(res)
+}
+
+// propagateSPop replicates SPOP as the removal of the members it picked.
+// Removing the last ones deletes the set on the slaves too.
+func (h *ConnHandler) propagateSPop(key string, members []string) {
+	if len(members) == 0 {
+		return
+	}
+	h.propagate(append([]string{"SREM", key}, members...)...)
+}
+
+// maxRandCount caps how many elements SRANDMEMBER, HRANDFIELD and
+// ZRANDMEMBER may return with a negative count, which repeats elements
+// instead of stopping at the size of the key.
+const maxRandCount = 1 << 24
+
+// parseRandCount parses the count of SRANDMEMBER, HRANDFIELD and
+// ZRANDMEMBER.
+func parseRandCount(arg string) (int, []byte) {
+	count, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if count < -maxRandCount {
+		return 0, resp.EncodeSimpleError("value is out of range")
+	}
+	return count, nil
+}
+
+// SRANDMEMBER key [count]
+func (h *ConnHandler) handleSRANDMEMBER(cmd CMD) []byte {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return wrongArgs(cmd)
+	}
+	if len(cmd.Args) == 1 {
+		res, err := h.db().SRandMember(cmd.Args[0], 1)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
+		if len(res) == 0 {
+			return h.encodeNullBulkString()
+		}
+		return resp.EncodeBulkString(res[0])
+	}
+	count, errRes := parseRandCount(cmd.Args[1])
+	if errRes != nil {
+		return errRes
+	}
+	res, err := h.db().SRandMember(cmd.Args[0], count)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeArray(res)
+}
+
+// SMOVE source destination member
+func (h *ConnHandler) handleSMOVE(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SMove(cmd.Args[0], cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// SUNION / SINTER / SDIFF key [key ...]
+func (h *ConnHandler) handleSetOp(cmd CMD, op kv.SetOp) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SOp(op, cmd.Args)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeSet(res)
+}
+
+// SUNIONSTORE / SINTERSTORE / SDIFFSTORE destination key [key ...]
+func (h *ConnHandler) handleSetOpStore(cmd CMD, op kv.SetOp) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().SOpStore(op, cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// parseInterCardArgs parses "numkeys key [key ...] [LIMIT limit]" of
+// SINTERCARD and ZINTERCARD.
+func parseInterCardArgs(args []string) ([]string, int, []byte) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, 0, resp.EncodeSimpleError("numkeys should be greater than 0")
+	}
+	if numKeys <= 0 {
+		return nil, 0, resp.EncodeSimpleError("numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return nil, 0, resp.EncodeSimpleError("Number of keys can't be greater than number of args")
+	}
+	keys := args[1 : 1+numKeys]
+	limit := 0
+	for i := 1 + numKeys; i < len(args); i++ {
+		if !strings.EqualFold(args[i], "LIMIT") || i+1 >= len(args) {
+			return nil, 0, resp.EncodeSimpleError("syntax error")
+		}
+		limit, err = strconv.Atoi(args[i+1])
+		if err != nil {
+			return nil, 0, resp.EncodeSimpleError("value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return nil, 0, resp.EncodeSimpleError("LIMIT can't be negative")
+		}
+		i++
+	}
+	return keys, limit, nil
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func (h *ConnHandler) handleSINTERCARD(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	keys, limit, errRes := parseInterCardArgs(cmd.Args)
+	if errRes != nil {
+		return errRes
+	}
+	res, err := h.db().SInterCard(keys, limit)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func (h *ConnHandler) handleSSCAN(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	opts, errReply := parseScanOptions(cmd.Args[1:], false, "")
+	if errReply != nil {
+		return errReply
+	}
+	cursor, elems, err := h.db().SScan(cmd.Args[0], opts.cursor, opts.count, opts.pattern)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return encodeScanReply(cursor, elems)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSINTERCARD(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("SADD", "a", "1", "2", "3")
+	h.do("SADD", "b", "2", "3", "4")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SINTERCARD", "2", "a", "b"}, ":2\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b", "LIMIT", "1"}, ":1\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b", "limit", "0"}, ":2\r\n"},
+		{[]string{"SINTERCARD", "0", "a"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"SINTERCARD", "3", "a", "b"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"SINTERCARD", "1", "a", "LIMIT", "-1"}, "-ERR LIMIT can't be negative\r\n"},
+		{[]string{"SINTERCARD", "1", "a", "LIMIT"}, "-ERR syntax error\r\n"},
+		{[]string{"SINTERCARD", "1", "a", "FOO", "1"}, "-ERR syntax error\r\n"},
+	}
+	for _, tt := range tests {
+		if got := h.do(tt.args...); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// SPOP picks random members, the slaves must remove the same ones.
+func TestSPOPPropagation(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("SADD", "s", "a", "b", "c")
+	stream := replicaStream(t, h)
+	got := h.do("SPOP", "s")
+	member := strings.Split(got, "\r\n")[1]
+	if want := "*3\r\n$4\r\nSREM\r\n$1\r\ns\r\n$1\r\n" + member + "\r\n"; !strings.HasSuffix(stream(), want) {
+		t.Errorf("SPOP propagated %q, want %q", stream(), want)
+	}
+	if strings.Contains(stream(), "SPOP") {
+		t.Errorf("SPOP was propagated as is: %q", stream())
+	}
+}
+
+// Commands of a transaction reach the slaves at EXEC, in the order they
+// ran, whether they are propagated as is or rewritten.
+func TestTransactionPropagation(t *testing.T) {
+	h := newTestHandler(t)
+	stream := replicaStream(t, h)
+	h.do("MULTI")
+	h.do("SET", "a", "1")
+	h.do("INCR", "a")
+	h.do("SADD", "s", "x")
+	h.do("SPOP", "s")
+	if got := stream(); got != "" {
+		t.Errorf("queued commands were propagated: %q", got)
+	}
+	h.do("EXEC")
+
+	got := stream()
+	order := []string{"SET", "INCR", "SADD", "SREM"}
+	pos := 0
+	for _, name := range order {
+		i := strings.Index(got[pos:], "\r\n"+name+"\r\n")
+		if i < 0 {
+			t.Fatalf("%s missing or out of order in %q", name, got)
+		}
+		pos += i + 1
+	}
+}
@@ -0,0 +1,446 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// parseExpireTime converts the argument of EX, PX, EXAT or PXAT into an
+// absolute expiry. Zero and negative values are rejected.
+func parseExpireTime(cmd CMD, arg string, unit time.Duration, absolute bool) (time.Time, []byte) {
+	t, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if t <= 0 {
+		return time.Time{}, invalidExpireTime(cmd)
+	}
+	ms := t
+	if unit == time.Second {
+		if t > math.MaxInt64/1000 {
+			return time.Time{}, invalidExpireTime(cmd)
+		}
+		ms = t * 1000
+	}
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if now > math.MaxInt64-ms {
+			return time.Time{}, invalidExpireTime(cmd)
+		}
+		ms += now
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// formatUnixMilli formats at for the PXAT option and PEXPIREAT.
+func formatUnixMilli(at time.Time) string {
+	return strconv.FormatInt(at.UnixMilli(), 10)
+}
+
+// expireOption returns the unit of an EX, PX, EXAT or PXAT option and
+// whether it is an absolute Unix time.
+func expireOption(opt string) (unit time.Duration, absolute bool, ok bool) {
+	switch opt {
+	case "EX":
+		return time.Second, false, true
+	case "PX":
+		return time.Millisecond, false, true
+	case "EXAT":
+		return time.Second, true, true
+	case "PXAT":
+		return time.Millisecond, true, true
+	}
+	return 0, false, false
+}
+
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func (h *ConnHandler) handleSET(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	key, value := cmd.Args[0], cmd.Args[1]
+
+	opts := kv.SetOptions{}
+	hasExpire := false
+	relExpire := -1 // index of an EX or PX option
+	for i := 2; i < len(cmd.Args); i++ {
+		opt := strings.ToUpper(cmd.Args[i])
+		if unit, absolute, ok := expireOption(opt); ok {
+			if hasExpire || opts.KeepTTL || i+1 >= len(cmd.Args) {
+				return resp.EncodeSimpleError("syntax error")
+			}
+			at, errReply := parseExpireTime(cmd, cmd.Args[i+1], unit, absolute)
+			if errReply != nil {
+				return errReply
+			}
+			opts.ExpireAt, hasExpire = at, true
+			if !absolute {
+				relExpire = i
+			}
+			i++
+			continue
+		}
+		switch {
+		case opt == "NX" && opts.Cond != kv.SetXX:
+			opts.Cond = kv.SetNX
+		case opt == "XX" && opts.Cond != kv.SetNX:
+			opts.Cond = kv.SetXX
+		case opt == "KEEPTTL" && !hasExpire:
+			opts.KeepTTL = true
+		case opt == "GET":
+			opts.Get = true
+		default:
+			return resp.EncodeSimpleError("syntax error")
+		}
+	}
+
+	old, ok, err := h.db().SetWithOptions(key, value, opts)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if ok {
+		args := append([]string{cmd.Command}, cmd.Args...)
+		if relExpire >= 0 {
+			// slaves expire the key at the same time as we do
+			args[relExpire+1], args[relExpire+2] = "PXAT", formatUnixMilli(opts.ExpireAt)
+		}
+		h.propagate(args...)
+	}
+	if opts.Get {
+		if old == nil {
+			return h.encodeNullBulkString()
+		}
+		return resp.EncodeBulkString(old.(string))
+	}
+	if !ok {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeSimpleString("OK")
+}
+
+// GET key
+func (h *ConnHandler) handleGET(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	val, err := h.db().Get(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if val == nil {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(val.(string))
+}
+
+// SETNX key value
+func (h *ConnHandler) handleSETNX(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	_, ok, err := h.db().SetWithOptions(cmd.Args[0], cmd.Args[1], kv.SetOptions{Cond: kv.SetNX})
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if ok {
+		return resp.EncodeInt(1)
+	}
+	return resp.EncodeInt(0)
+}
+
+// SETEX key seconds value / PSETEX key milliseconds value
+func (h *ConnHandler) handleSETEX(cmd CMD, unit time.Duration) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	at, errReply := parseExpireTime(cmd, cmd.Args[1], unit, false)
+	if errReply != nil {
+		return errReply
+	}
+	if _, _, err := h.db().SetWithOptions(cmd.Args[0], cmd.Args[2], kv.SetOptions{ExpireAt: at}); err != nil {
+		return resp.EncodeError(err)
+	}
+	h.propagate("SET", cmd.Args[0], cmd.Args[2], "PXAT", formatUnixMilli(at))
+	return resp.EncodeSimpleString("OK")
+}
+
+// GETSET key value
+func (h *ConnHandler) handleGETSET(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	old, _, err := h.db().SetWithOptions(cmd.Args[0], cmd.Args[1], kv.SetOptions{Get: true})
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if old == nil {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(old.(string))
+}
+
+// GETDEL key
+func (h *ConnHandler) handleGETDEL(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	val, err := h.db().GetDel(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if val == nil {
+		return h.encodeNullBulkString()
+	}
+	return resp.EncodeBulkString(val.(string))
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds | PERSIST]
+func (h *ConnHandler) handleGETEX(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	var at time.Time
+	persist := false
+	for i := 1; i < len(cmd.Args); i++ {
+		opt := strings.ToUpper(cmd.Args[i])
+		if unit, absolute, ok := expireOption(opt); ok && at.IsZero() && !persist && i+1 < len(cmd.Args) {
+			var errReply []byte
+			at, errReply = parseExpireTime(cmd, cmd.Args[i+1], unit, absolute)
+			if errReply != nil {
+				return errReply
+			}
+			i++
+		} else if opt == "PERSIST" && at.IsZero() && !persist {
+			persist = true
+		} else {
+			return resp.EncodeSimpleError("syntax error")
+		}
+	}
+	val, err := h.db().GetEx(cmd.Args[0], at, persist)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if val == nil {
+		return h.encodeNullBulkString()
+	}
+	switch {
+	case !at.IsZero():
+		h.propagate("PEXPIREAT", cmd.Args[0], formatUnixMilli(at))
+	case persist:
+		h.propagate("PERSIST", cmd.Args[0])
+	}
+	return resp.EncodeBulkString(val.(string))
+}
+
+// APPEND key value
+func (h *ConnHandler) handleAPPEND(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().Append(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// STRLEN key
+func (h *ConnHandler) handleSTRLEN(cmd CMD) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().StrLen(cmd.Args[0])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// GETRANGE key start end
+func (h *ConnHandler) handleGETRANGE(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	start, err1 := strconv.Atoi(cmd.Args[1])
+	end, err2 := strconv.Atoi(cmd.Args[2])
+	if err1 != nil || err2 != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	res, err := h.db().GetRange(cmd.Args[0], start, end)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeBulkString(res)
+}
+
+// SETRANGE key offset value
+func (h *ConnHandler) handleSETRANGE(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	offset, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return resp.EncodeSimpleError("offset is out of range")
+	}
+	res, err := h.db().SetRange(cmd.Args[0], offset, cmd.Args[2])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(res)
+}
+
+// MSET key value [key value ...]
+func (h *ConnHandler) handleMSET(cmd CMD) []byte {
+	if len(cmd.Args) < 2 || len(cmd.Args)%2 != 0 {
+		return wrongArgs(cmd)
+	}
+	h.db().MSet(cmd.Args)
+	return resp.EncodeSimpleString("OK")
+}
+
+// MSETNX key value [key value ...]
+func (h *ConnHandler) handleMSETNX(cmd CMD) []byte {
+	if len(cmd.Args) < 2 || len(cmd.Args)%2 != 0 {
+		return wrongArgs(cmd)
+	}
+	return resp.EncodeInt(h.db().MSetNX(cmd.Args))
+}
+
+// MGET key [key ...]
+func (h *ConnHandler) handleMGET(cmd CMD) []byte {
+	if len(cmd.Args) < 1 {
+		return wrongArgs(cmd)
+	}
+	return h.encodeNullableArray(h.db().MGet(cmd.Args))
+}
+
+// LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]
+func (h *ConnHandler) handleLCS(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	getLen, getIdx, withMatchLen := false, false, false
+	minMatchLen := 0
+	for i := 2; i < len(cmd.Args); i++ {
+		opt := strings.ToUpper(cmd.Args[i])
+		switch {
+		case opt == "LEN":
+			getLen = true
+		case opt == "IDX":
+			getIdx = true
+		case opt == "WITHMATCHLEN":
+			withMatchLen = true
+		case opt == "MINMATCHLEN" && i+1 < len(cmd.Args):
+			n, err := strconv.Atoi(cmd.Args[i+1])
+			if err != nil {
+				return resp.EncodeSimpleError("value is not an integer or out of range")
+			}
+			minMatchLen = max(n, 0)
+			i++
+		default:
+			return resp.EncodeSimpleError("syntax error")
+		}
+	}
+	if getLen && getIdx {
+		return resp.EncodeSimpleError("If you want both the length and indexes, please just use IDX.")
+	}
+
+	res, err := h.db().LCS(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if getLen {
+		return resp.EncodeInt(len(res.Seq))
+	}
+	if !getIdx {
+		return resp.EncodeBulkString(res.Seq)
+	}
+
+	matches := []kv.LCSMatch{}
+	for _, m := range res.Matches {
+		if m.Len >= minMatchLen {
+			matches = append(matches, m)
+		}
+	}
+	out := h.encodeMapHeader(2)
+	out = append(out, resp.EncodeBulkString("matches")...)
+	out = append(out, resp.EncodeArrayHeader(len(matches))...)
+	for _, m := range matches {
+		if withMatchLen {
+			out = append(out, resp.EncodeArrayHeader(3)...)
+		} else {
+			out = append(out, resp.EncodeArrayHeader(2)...)
+		}
+		for _, r := range [][2]int{m.A, m.B} {
+			out = append(out, resp.EncodeArrayHeader(2)...)
+			out = append(out, resp.EncodeInt(r[0])...)
+			out = append(out, resp.EncodeInt(r[1])...)
+		}
+		if withMatchLen {
+			out = append(out, resp.EncodeInt(m.Len)...)
+		}
+	}
+	out = append(out, resp.EncodeBulkString("len")...)
+	out = append(out, resp.EncodeInt(len(res.Seq))...)
+	return out
+}
+
+// INCR / DECR key
+func (h *ConnHandler) handleINCR(cmd CMD, incr int64) []byte {
+	if len(cmd.Args) != 1 {
+		return wrongArgs(cmd)
+	}
+	res, err := h.db().IncrBy(cmd.Args[0], incr)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt64(res)
+}
+
+// INCRBY / DECRBY key increment
+func (h *ConnHandler) handleINCRBY(cmd CMD, sign int64) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	incr, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if sign < 0 {
+		if incr == math.MinInt64 {
+			return resp.EncodeSimpleError("decrement would overflow")
+		}
+		incr = -incr
+	}
+	res, err := h.db().IncrBy(cmd.Args[0], incr)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt64(res)
+}
+
+// INCRBYFLOAT key increment
+func (h *ConnHandler) handleINCRBYFLOAT(cmd CMD) []byte {
+	if len(cmd.Args) != 2 {
+		return wrongArgs(cmd)
+	}
+	incr, err := strconv.ParseFloat(cmd.Args[1], 64)
+	if err != nil || math.IsNaN(incr) || math.IsInf(incr, 0) {
+		return resp.EncodeSimpleError("value is not a valid float")
+	}
+	res, err := h.db().IncrByFloat(cmd.Args[0], incr)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeBulkString(res)
+}
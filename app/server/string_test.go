@@ -0,0 +1,144 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// step is one command of a scenario and its expected reply.
+type step struct {
+	args []string
+	want string
+}
+
+func runSteps(t *testing.T, h *ConnHandler, steps []step) {
+	t.Helper()
+	for _, s := range steps {
+		if got := h.do(s.args...); got != s.want {
+			t.Errorf("%v = %q, want %q", s.args, got, s.want)
+		}
+	}
+}
+
+func TestSETOptions(t *testing.T) {
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"NX", []step{
+			{[]string{"SET", "k", "1", "NX"}, "+OK\r\n"},
+			{[]string{"SET", "k", "2", "NX"}, "$-1\r\n"},
+			{[]string{"GET", "k"}, "$1\r\n1\r\n"},
+		}},
+		{"XX", []step{
+			{[]string{"SET", "k", "1", "XX"}, "$-1\r\n"},
+			{[]string{"SET", "k", "1"}, "+OK\r\n"},
+			{[]string{"SET", "k", "2", "XX"}, "+OK\r\n"},
+			{[]string{"GET", "k"}, "$1\r\n2\r\n"},
+		}},
+		{"GET", []step{
+			{[]string{"SET", "k", "1", "GET"}, "$-1\r\n"},
+			{[]string{"SET", "k", "2", "GET"}, "$1\r\n1\r\n"},
+			{[]string{"SET", "k", "3", "NX", "GET"}, "$1\r\n2\r\n"},
+			{[]string{"GET", "k"}, "$1\r\n2\r\n"},
+			{[]string{"RPUSH", "l", "a"}, ":1\r\n"},
+			{[]string{"SET", "l", "v", "GET"}, wrongType},
+			{[]string{"SET", "l", "v"}, "+OK\r\n"},
+		}},
+		{"expiry", []step{
+			{[]string{"SET", "k", "v", "EX", "100"}, "+OK\r\n"},
+			{[]string{"TTL", "k"}, ":100\r\n"},
+			{[]string{"SET", "k", "v", "PX", "100000"}, "+OK\r\n"},
+			{[]string{"TTL", "k"}, ":100\r\n"},
+			{[]string{"SET", "k", "v", "EXAT", future}, "+OK\r\n"},
+			{[]string{"EXPIRETIME", "k"}, ":" + future + "\r\n"},
+			{[]string{"SET", "k", "v2", "KEEPTTL"}, "+OK\r\n"},
+			{[]string{"EXPIRETIME", "k"}, ":" + future + "\r\n"},
+			{[]string{"SET", "k", "v3"}, "+OK\r\n"},
+			{[]string{"TTL", "k"}, ":-1\r\n"},
+		}},
+		{"errors", []step{
+			{[]string{"SET", "k", "v", "NX", "XX"}, "-ERR syntax error\r\n"},
+			{[]string{"SET", "k", "v", "EX", "1", "PX", "1"}, "-ERR syntax error\r\n"},
+			{[]string{"SET", "k", "v", "EX", "1", "KEEPTTL"}, "-ERR syntax error\r\n"},
+			{[]string{"SET", "k", "v", "KEEPTTL", "EX", "1"}, "-ERR syntax error\r\n"},
+			{[]string{"SET", "k", "v", "EX"}, "-ERR syntax error\r\n"},
+			{[]string{"SET", "k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+			{[]string{"SET", "k", "v", "PX", "-5"}, "-ERR invalid expire time in 'set' command\r\n"},
+			{[]string{"SET", "k", "v", "EX", "x"}, "-ERR value is not an integer or out of range\r\n"},
+			{[]string{"SET", "k", "v", "EX", "9223372036854775807"}, "-ERR invalid expire time in 'set' command\r\n"},
+			{[]string{"SET", "k", "v", "FOO"}, "-ERR syntax error\r\n"},
+			{[]string{"EXISTS", "k"}, ":0\r\n"},
+		}},
+		{"variants", []step{
+			{[]string{"SETNX", "k", "1"}, ":1\r\n"},
+			{[]string{"SETNX", "k", "2"}, ":0\r\n"},
+			{[]string{"GETSET", "k", "3"}, "$1\r\n1\r\n"},
+			{[]string{"SETEX", "k", "100", "4"}, "+OK\r\n"},
+			{[]string{"TTL", "k"}, ":100\r\n"},
+			{[]string{"PSETEX", "k", "0", "5"}, "-ERR invalid expire time in 'psetex' command\r\n"},
+			{[]string{"GETEX", "k", "PERSIST"}, "$1\r\n4\r\n"},
+			{[]string{"TTL", "k"}, ":-1\r\n"},
+			{[]string{"GETEX", "k", "EX", "50"}, "$1\r\n4\r\n"},
+			{[]string{"TTL", "k"}, ":50\r\n"},
+			{[]string{"GETEX", "k", "EX", "50", "PERSIST"}, "-ERR syntax error\r\n"},
+			{[]string{"GETDEL", "k"}, "$1\r\n4\r\n"},
+			{[]string{"GETDEL", "k"}, "$-1\r\n"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, newTestHandler(t), tt.steps)
+		})
+	}
+}
+
+func TestStringCommands(t *testing.T) {
+	runSteps(t, newTestHandler(t), []step{
+		{[]string{"SET", "k", "Hello World"}, "+OK\r\n"},
+		{[]string{"SETRANGE", "k", "6", "Redis"}, ":11\r\n"},
+		{[]string{"GETRANGE", "k", "-5", "-1"}, "$5\r\nRedis\r\n"},
+		{[]string{"GETRANGE", "k", "0", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"SETRANGE", "k", "-1", "x"}, "-ERR offset is out of range\r\n"},
+		{[]string{"SETRANGE", "k", "536870912", "x"}, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n"},
+		{[]string{"SETRANGE", "k", "9223372036854775807", "xyz"}, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n"},
+		{[]string{"APPEND", "k", "!"}, ":12\r\n"},
+		{[]string{"STRLEN", "k"}, ":12\r\n"},
+		{[]string{"MSET", "a", "1", "b"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{[]string{"MSET", "a", "1", "b", "2"}, "+OK\r\n"},
+		{[]string{"MGET", "a", "missing", "b"}, "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n"},
+		{[]string{"MSETNX", "a", "x", "c", "3"}, ":0\r\n"},
+		{[]string{"MSETNX", "c", "3", "d", "4"}, ":1\r\n"},
+	})
+}
+
+func TestLCSReply(t *testing.T) {
+	runSteps(t, newTestHandler(t), []step{
+		{[]string{"MSET", "key1", "ohmytext", "key2", "mynewtext"}, "+OK\r\n"},
+		{[]string{"LCS", "key1", "key2"}, "$6\r\nmytext\r\n"},
+		{[]string{"LCS", "key1", "key2", "LEN"}, ":6\r\n"},
+		{[]string{"LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"},
+			"*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n"},
+		{[]string{"LCS", "key1", "key2", "LEN", "IDX"}, "-ERR If you want both the length and indexes, please just use IDX.\r\n"},
+		{[]string{"LCS", "key1", "key2", "FOO"}, "-ERR syntax error\r\n"},
+	})
+}
+
+func TestCounters(t *testing.T) {
+	runSteps(t, newTestHandler(t), []step{
+		{[]string{"INCR", "n"}, ":1\r\n"},
+		{[]string{"INCRBY", "n", "10"}, ":11\r\n"},
+		{[]string{"DECR", "n"}, ":10\r\n"},
+		{[]string{"DECRBY", "n", "-5"}, ":15\r\n"},
+		{[]string{"DECRBY", "n", "-9223372036854775808"}, "-ERR decrement would overflow\r\n"},
+		{[]string{"INCRBY", "n", "9223372036854775807"}, "-ERR increment or decrement would overflow\r\n"},
+		{[]string{"INCRBY", "n", "1.5"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"INCRBYFLOAT", "n", "0.5"}, "$4\r\n15.5\r\n"},
+		{[]string{"INCR", "n"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"INCRBYFLOAT", "n", "nan"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"INCRBYFLOAT", "n", "inf"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"GET", "n"}, "$4\r\n15.5\r\n"},
+	})
+}
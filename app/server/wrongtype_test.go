@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+)
+
+const wrongType = "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+
+// Commands run against a key of another type reply WRONGTYPE, instead of
+// panicking or treating the key as missing.
+func TestWrongType(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("SET", "str", "v")
+	h.do("RPUSH", "list", "a")
+	h.do("SADD", "set", "a")
+	h.do("HSET", "hash", "f", "v")
+	h.do("ZADD", "zset", "1", "a")
+	h.do("XADD", "stream", "1-1", "f", "v")
+
+	tests := [][]string{
+		{"GET", "list"},
+		{"APPEND", "set", "x"},
+		{"INCR", "hash"},
+		{"GETRANGE", "zset", "0", "1"},
+		{"SETBIT", "list", "1", "1"},
+		{"PFADD", "set", "a"},
+		{"LPUSH", "str", "a"},
+		{"LRANGE", "hash", "0", "-1"},
+		{"LLEN", "set"},
+		{"LPOP", "zset"},
+		{"BLPOP", "str", "0"},
+		{"LMOVE", "list", "str", "LEFT", "LEFT"},
+		{"SADD", "str", "a"},
+		{"SMEMBERS", "list"},
+		{"SINTER", "set", "hash"},
+		{"HSET", "set", "f", "v"},
+		{"HGETALL", "str"},
+		{"HINCRBY", "zset", "f", "1"},
+		{"ZADD", "hash", "1", "a"},
+		{"ZRANGE", "list", "0", "-1"},
+		{"ZSCORE", "set", "a"},
+		{"ZUNION", "2", "zset", "str"},
+		{"ZSCAN", "hash", "0"},
+		{"XADD", "str", "*", "f", "v"},
+		{"XRANGE", "list", "-", "+"},
+		{"GEOADD", "set", "13.36", "38.11", "a"},
+		{"GEOPOS", "str", "a"},
+	}
+	for _, args := range tests {
+		if got := h.do(args...); got != wrongType {
+			t.Errorf("%v = %q, want WRONGTYPE", args, got)
+		}
+	}
+
+	// reads that don't care about the type still work
+	for key, want := range map[string]string{
+		"str": "+string\r\n", "list": "+list\r\n", "set": "+set\r\n",
+		"hash": "+hash\r\n", "zset": "+zset\r\n", "stream": "+stream\r\n",
+	} {
+		if got := h.do("TYPE", key); got != want {
+			t.Errorf("TYPE %s = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/kv"
+	"github.com/codecrafters-io/redis-starter-go/app/resp"
+)
+
+// encodeZSetElems replies with the members, followed by their scores when
+// withScores is set: flat for RESP2, [member, score] pairs for RESP3.
+func (h *ConnHandler) encodeZSetElems(elems []kv.ZSetElem, withScores bool) []byte {
+	if !withScores {
+		res := resp.EncodeArrayHeader(len(elems))
+		for _, elem := range elems {
+			res = append(res, resp.EncodeBulkString(elem.Member)...)
+		}
+		return res
+	}
+	if h.isResp3() {
+		res := resp.EncodeArrayHeader(len(elems))
+		for _, elem := range elems {
+			res = append(res, resp.EncodeArrayHeader(2)...)
+			res = append(res, resp.EncodeBulkString(elem.Member)...)
+			res = append(res, resp.EncodeDouble(elem.Score)...)
+		}
+		return res
+	}
+	res := resp.EncodeArrayHeader(2 * len(elems))
+	for _, elem := range elems {
+		res = append(res, resp.EncodeBulkString(elem.Member)...)
+		res = append(res, resp.EncodeBulkString(resp.FormatDouble(elem.Score))...)
+	}
+	return res
+}
+
+// parseZRangeArgs parses "min max [options]" of the ZRANGE family into q,
+// whose By and Rev are preset by the command. generic allows the BYSCORE,
+// BYLEX and REV options of ZRANGE, store rejects WITHSCORES.
+func parseZRangeArgs(args []string, q kv.ZRangeQuery, generic, store bool) (kv.ZRangeQuery, bool, []byte) {
+	withScores, hasLimit := false, false
+	q.Count = -1
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "WITHSCORES" && !store:
+			withScores = true
+		case opt == "LIMIT" && i+2 < len(args):
+			offset, err1 := strconv.Atoi(args[i+1])
+			count, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return q, false, resp.EncodeSimpleError("value is not an integer or out of range")
+			}
+			q.Offset, q.Count, hasLimit = offset, count, true
+			i += 2
+		case opt == "BYSCORE" && generic:
+			q.By = kv.ZRangeByScore
+		case opt == "BYLEX" && generic:
+			q.By = kv.ZRangeByLex
+		case opt == "REV" && generic:
+			q.Rev = true
+		default:
+			return q, false, resp.EncodeSimpleError("syntax error")
+		}
+	}
+	if hasLimit && q.By == kv.ZRangeByRank {
+		return q, false, resp.EncodeSimpleError("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if withScores && q.By == kv.ZRangeByLex {
+		return q, false, resp.EncodeSimpleError("syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	min, max := args[0], args[1]
+	if q.Rev && q.By != kv.ZRangeByRank {
+		// reversed score and lex ranges are written max first
+		min, max = max, min
+	}
+	var err error
+	switch q.By {
+	case kv.ZRangeByRank:
+		var err1, err2 error
+		q.Start, err1 = strconv.Atoi(min)
+		q.Stop, err2 = strconv.Atoi(max)
+		if err1 != nil || err2 != nil {
+			return q, false, resp.EncodeSimpleError("value is not an integer or out of range")
+		}
+	case kv.ZRangeByScore:
+		q.Score, err = kv.ParseScoreRange(min, max)
+	case kv.ZRangeByLex:
+		q.Lex, err = kv.ParseLexRange(min, max)
+	}
+	if err != nil {
+		return q, false, resp.EncodeError(err)
+	}
+	return q, withScores, nil
+}
+
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func (h *ConnHandler) handleZRANGE(cmd CMD) []byte {
+	if len(cmd.Args) < 3 {
+		return wrongArgs(cmd)
+	}
+	q, withScores, errRes := parseZRangeArgs(cmd.Args[1:], kv.ZRangeQuery{}, true, false)
+	if errRes != nil {
+		return errRes
+	}
+	elems, err := h.db().ZRange(cmd.Args[0], q)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeZSetElems(elems, withScores)
+}
+
+// ZREVRANGE key start stop [WITHSCORES]
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+// ZRANGEBYLEX key min max [LIMIT offset count]
+// ZREVRANGEBYLEX key max min [LIMIT offset count]
+func (h *ConnHandler) handleZRANGEBY(cmd CMD, by kv.ZRangeBy, rev bool) []byte {
+	if len(cmd.Args) < 3 {
+		return wrongArgs(cmd)
+	}
+	q := kv.ZRangeQuery{By: by, Rev: rev}
+	q, withScores, errRes := parseZRangeArgs(cmd.Args[1:], q, false, false)
+	if errRes != nil {
+		return errRes
+	}
+	elems, err := h.db().ZRange(cmd.Args[0], q)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeZSetElems(elems, withScores)
+}
+
+// ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func (h *ConnHandler) handleZRANGESTORE(cmd CMD) []byte {
+	if len(cmd.Args) < 4 {
+		return wrongArgs(cmd)
+	}
+	q, _, errRes := parseZRangeArgs(cmd.Args[2:], kv.ZRangeQuery{}, true, true)
+	if errRes != nil {
+		return errRes
+	}
+	n, err := h.db().ZRangeStore(cmd.Args[0], cmd.Args[1], q)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(n)
+}
+
+// ZCOUNT key min max
+func (h *ConnHandler) handleZCOUNT(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	r, err := kv.ParseScoreRange(cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	n, err := h.db().ZCount(cmd.Args[0], r)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(n)
+}
+
+// ZLEXCOUNT key min max
+func (h *ConnHandler) handleZLEXCOUNT(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	r, err := kv.ParseLexRange(cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	n, err := h.db().ZLexCount(cmd.Args[0], r)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(n)
+}
+
+// parseScore parses a score, accepting "+inf" and "-inf" but not NaN.
+func parseScore(arg string) (float64, bool) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+func (h *ConnHandler) handleZADD(cmd CMD) []byte {
+	if len(cmd.Args) < 3 {
+		return wrongArgs(cmd)
+	}
+	var (
+		opts kv.ZAddOptions
+		incr bool
+	)
+	i := 1
+flags:
+	for ; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+	pairs := cmd.Args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return resp.EncodeSimpleError("syntax error")
+	}
+	if opts.NX && opts.XX {
+		return resp.EncodeSimpleError("XX and NX options at the same time are not compatible")
+	}
+	if (opts.GT && opts.LT) || ((opts.GT || opts.LT) && opts.NX) {
+		return resp.EncodeSimpleError("GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) > 2 {
+		return resp.EncodeSimpleError("INCR option supports a single increment-element pair")
+	}
+
+	elems := make([]kv.ZSetElem, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, ok := parseScore(pairs[j])
+		if !ok {
+			return resp.EncodeError(kv.ErrNotFloat)
+		}
+		elems = append(elems, kv.ZSetElem{Member: pairs[j+1], Score: score})
+	}
+
+	if incr {
+		score, err := h.db().ZIncrBy(cmd.Args[0], elems[0].Member, elems[0].Score, opts)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
+		if score == nil {
+			return h.encodeNullBulkString()
+		}
+		return h.encodeDouble(score.(float64))
+	}
+	n, err := h.db().ZAddMulti(cmd.Args[0], elems, opts)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(n)
+}
+
+// ZINCRBY key increment member
+func (h *ConnHandler) handleZINCRBY(cmd CMD) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	incr, ok := parseScore(cmd.Args[1])
+	if !ok {
+		return resp.EncodeError(kv.ErrNotFloat)
+	}
+	score, err := h.db().ZIncrBy(cmd.Args[0], cmd.Args[2], incr, kv.ZAddOptions{})
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeDouble(score.(float64))
+}
+
+// parseZSetOpArgs parses "numkeys key [key ...] [WEIGHTS weight ...]
+// [AGGREGATE SUM | MIN | MAX] [WITHSCORES]" of the ZUNION family. ZDIFF
+// only takes WITHSCORES, and store rejects it.
+func parseZSetOpArgs(cmd CMD, args []string, op kv.SetOp, store bool) (keys []string, weights []float64, agg kv.ZAggregate, withScores bool, errRes []byte) {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, nil, 0, false, resp.EncodeSimpleError("value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return nil, nil, 0, false, resp.EncodeSimpleError(fmt.Sprintf("at least 1 input key is needed for '%s' command", strings.ToLower(cmd.Command)))
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, 0, false, resp.EncodeSimpleError("syntax error")
+	}
+	keys = args[1 : 1+numKeys]
+	for i := 1 + numKeys; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "WEIGHTS" && op != kv.SetDiff && remaining >= numKeys:
+			weights = make([]float64, numKeys)
+			for j := range weights {
+				weights[j], err = strconv.ParseFloat(args[i+1+j], 64)
+				if err != nil || math.IsNaN(weights[j]) {
+					return nil, nil, 0, false, resp.EncodeSimpleError("weight value is not a float")
+				}
+			}
+			i += numKeys
+		case opt == "AGGREGATE" && op != kv.SetDiff && remaining >= 1:
+			switch strings.ToUpper(args[i+1]) {
+			case "SUM":
+				agg = kv.ZAggSum
+			case "MIN":
+				agg = kv.ZAggMin
+			case "MAX":
+				agg = kv.ZAggMax
+			default:
+				return nil, nil, 0, false, resp.EncodeSimpleError("syntax error")
+			}
+			i++
+		case opt == "WITHSCORES" && !store:
+			withScores = true
+		default:
+			return nil, nil, 0, false, resp.EncodeSimpleError("syntax error")
+		}
+	}
+	return keys, weights, agg, withScores, nil
+}
+
+// ZUNION numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+// ZINTER numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+// ZDIFF numkeys key [key ...] [WITHSCORES]
+func (h *ConnHandler) handleZSetOp(cmd CMD, op kv.SetOp) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	keys, weights, agg, withScores, errRes := parseZSetOpArgs(cmd, cmd.Args, op, false)
+	if errRes != nil {
+		return errRes
+	}
+	elems, err := h.db().ZOp(op, keys, weights, agg)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeZSetElems(elems, withScores)
+}
+
+// ZUNIONSTORE dst numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM | MIN | MAX]
+// ZINTERSTORE dst numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM | MIN | MAX]
+// ZDIFFSTORE dst numkeys key [key ...]
+func (h *ConnHandler) handleZSetOpStore(cmd CMD, op kv.SetOp) []byte {
+	if len(cmd.Args) < 3 {
+		return wrongArgs(cmd)
+	}
+	keys, weights, agg, _, errRes := parseZSetOpArgs(cmd, cmd.Args[1:], op, true)
+	if errRes != nil {
+		return errRes
+	}
+	n, err := h.db().ZOpStore(op, cmd.Args[0], keys, weights, agg)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(n)
+}
+
+// ZINTERCARD numkeys key [key ...] [LIMIT limit]
+func (h *ConnHandler) handleZINTERCARD(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	keys, limit, errRes := parseInterCardArgs(cmd.Args)
+	if errRes != nil {
+		return errRes
+	}
+	n, err := h.db().ZInterCard(keys, limit)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(n)
+}
+
+// parseZSetEnd parses the MIN | MAX argument of ZMPOP and BZMPOP.
+func parseZSetEnd(arg string) (max bool, ok bool) {
+	switch strings.ToUpper(arg) {
+	case "MIN":
+		return false, true
+	case "MAX":
+		return true, true
+	}
+	return false, false
+}
+
+// encodeZSetPairs replies with [member, score] pairs in both protocols,
+// as ZMPOP does.
+func (h *ConnHandler) encodeZSetPairs(elems []kv.ZSetElem) []byte {
+	res := resp.EncodeArrayHeader(len(elems))
+	for _, elem := range elems {
+		res = append(res, resp.EncodeArrayHeader(2)...)
+		res = append(res, resp.EncodeBulkString(elem.Member)...)
+		res = append(res, h.encodeDouble(elem.Score)...)
+	}
+	return res
+}
+
+// ZPOPMIN key [count]
+// ZPOPMAX key [count]
+func (h *ConnHandler) handleZPOP(cmd CMD, max bool) []byte {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return wrongArgs(cmd)
+	}
+	count := 1
+	if len(cmd.Args) == 2 {
+		var err error
+		count, err = strconv.Atoi(cmd.Args[1])
+		if err != nil {
+			return resp.EncodeSimpleError("value is not an integer or out of range")
+		}
+		if count < 0 {
+			return resp.EncodeSimpleError("value is out of range, must be positive")
+		}
+	}
+	elems, err := h.db().ZPop(cmd.Args[0], count, max)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if len(cmd.Args) == 2 {
+		return h.encodeZSetElems(elems, true)
+	}
+	// a single pop replies with a flat [member, score], even in RESP3
+	res := resp.EncodeArrayHeader(2 * len(elems))
+	for _, elem := range elems {
+		res = append(res, resp.EncodeBulkString(elem.Member)...)
+		res = append(res, h.encodeDouble(elem.Score)...)
+	}
+	return res
+}
+
+// zsetPopCommand names the non-blocking pop from the given end.
+func zsetPopCommand(max bool) string {
+	if max {
+		return "ZPOPMAX"
+	}
+	return "ZPOPMIN"
+}
+
+// BZPOPMIN key [key ...] timeout
+// BZPOPMAX key [key ...] timeout
+func (h *ConnHandler) handleBZPOP(cmd CMD, max bool) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	keys := cmd.Args[:len(cmd.Args)-1]
+	timeout, errRes := parseTimeout(cmd.Args[len(cmd.Args)-1])
+	if errRes != nil {
+		return errRes
+	}
+	opts := h.blockOptions(timeout, func(key string, _ int) []string {
+		return []string{zsetPopCommand(max), key}
+	})
+	key, elems, err := h.db().BZMPop(keys, 1, max, opts)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if len(elems) == 0 {
+		return h.encodeNullArray()
+	}
+	res := resp.EncodeArrayHeader(3)
+	res = append(res, resp.EncodeBulkString(key)...)
+	res = append(res, resp.EncodeBulkString(elems[0].Member)...)
+	return append(res, h.encodeDouble(elems[0].Score)...)
+}
+
+// ZMPOP numkeys key [key ...] <MIN | MAX> [COUNT count]
+func (h *ConnHandler) handleZMPOP(cmd CMD) []byte {
+	if len(cmd.Args) < 3 {
+		return wrongArgs(cmd)
+	}
+	keys, max, count, errRes := parseMPopArgs(cmd.Args, parseZSetEnd)
+	if errRes != nil {
+		return errRes
+	}
+	return h.encodeZMPop(h.db().ZMPop(keys, count, max))
+}
+
+// BZMPOP timeout numkeys key [key ...] <MIN | MAX> [COUNT count]
+func (h *ConnHandler) handleBZMPOP(cmd CMD) []byte {
+	if len(cmd.Args) < 4 {
+		return wrongArgs(cmd)
+	}
+	timeout, errRes := parseTimeout(cmd.Args[0])
+	if errRes != nil {
+		return errRes
+	}
+	keys, max, count, errRes := parseMPopArgs(cmd.Args[1:], parseZSetEnd)
+	if errRes != nil {
+		return errRes
+	}
+	opts := h.blockOptions(timeout, func(key string, n int) []string {
+		return []string{zsetPopCommand(max), key, strconv.Itoa(n)}
+	})
+	return h.encodeZMPop(h.db().BZMPop(keys, count, max, opts))
+}
+
+// encodeZMPop replies with the key and the popped [member, score] pairs,
+// or a null array when nothing was popped.
+func (h *ConnHandler) encodeZMPop(key string, elems []kv.ZSetElem, err error) []byte {
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	if len(elems) == 0 {
+		return h.encodeNullArray()
+	}
+	res := resp.EncodeArrayHeader(2)
+	res = append(res, resp.EncodeBulkString(key)...)
+	return append(res, h.encodeZSetPairs(elems)...)
+}
+
+// ZMSCORE key member [member ...]
+func (h *ConnHandler) handleZMSCORE(cmd CMD) []byte {
+	if len(cmd.Args) < 2 {
+		return wrongArgs(cmd)
+	}
+	scores, err := h.db().ZMScore(cmd.Args[0], cmd.Args[1:])
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	res := resp.EncodeArrayHeader(len(scores))
+	for _, score := range scores {
+		if score == nil {
+			res = append(res, h.encodeNullBulkString()...)
+		} else {
+			res = append(res, h.encodeDouble(score.(float64))...)
+		}
+	}
+	return res
+}
+
+// ZRANDMEMBER key [count [WITHSCORES]]
+func (h *ConnHandler) handleZRANDMEMBER(cmd CMD) []byte {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 3 {
+		return wrongArgs(cmd)
+	}
+	if len(cmd.Args) == 1 {
+		elems, err := h.db().ZRandMember(cmd.Args[0], 1)
+		if err != nil {
+			return resp.EncodeError(err)
+		}
+		if len(elems) == 0 {
+			return h.encodeNullBulkString()
+		}
+		return resp.EncodeBulkString(elems[0].Member)
+	}
+	count, errRes := parseRandCount(cmd.Args[1])
+	if errRes != nil {
+		return errRes
+	}
+	withScores := len(cmd.Args) == 3
+	if withScores && !strings.EqualFold(cmd.Args[2], "WITHSCORES") {
+		return resp.EncodeSimpleError("syntax error")
+	}
+	elems, err := h.db().ZRandMember(cmd.Args[0], count)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return h.encodeZSetElems(elems, withScores)
+}
+
+// ZREMRANGEBYRANK key start stop
+// ZREMRANGEBYSCORE key min max
+// ZREMRANGEBYLEX key min max
+func (h *ConnHandler) handleZREMRANGEBY(cmd CMD, by kv.ZRangeBy) []byte {
+	if len(cmd.Args) != 3 {
+		return wrongArgs(cmd)
+	}
+	q, _, errRes := parseZRangeArgs(cmd.Args[1:], kv.ZRangeQuery{By: by}, false, true)
+	if errRes != nil {
+		return errRes
+	}
+	n, err := h.db().ZRemRange(cmd.Args[0], q)
+	if err != nil {
+		return resp.EncodeError(err)
+	}
+	return resp.EncodeInt(n)
+}
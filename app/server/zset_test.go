@@ -0,0 +1,223 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZRangeCommands(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("ZADD", "z", "1", "a", "2", "b", "2.5", "c", "3", "d")
+	runSteps(t, h, []step{
+		{[]string{"ZRANGE", "z", "0", "1"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]string{"ZRANGE", "z", "0", "0", "REV", "WITHSCORES"}, "*2\r\n$1\r\nd\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANGE", "z", "(1", "2.5", "BYSCORE", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$3\r\n2.5\r\n"},
+		{[]string{"ZRANGE", "z", "+inf", "(2", "BYSCORE", "REV", "LIMIT", "1", "5"}, "*1\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "z", "[b", "(d", "BYLEX"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "z", "0", "1", "LIMIT", "0", "1"}, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{[]string{"ZRANGE", "z", "-", "+", "BYLEX", "WITHSCORES"}, "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n"},
+		{[]string{"ZRANGE", "z", "a", "1", "BYSCORE"}, "-ERR min or max is not a float\r\n"},
+		{[]string{"ZRANGE", "z", "a", "+", "BYLEX"}, "-ERR min or max not valid string range item\r\n"},
+		{[]string{"ZRANGE", "z", "a", "1"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ZRANGE", "z", "0", "1", "LIMIT", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"ZRANGE", "z", "0", "1", "BYSCORE", "LIMIT", "x", "1"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ZREVRANGE", "z", "0", "1"}, "*2\r\n$1\r\nd\r\n$1\r\nc\r\n"},
+		{[]string{"ZREVRANGE", "z", "0", "1", "REV"}, "-ERR syntax error\r\n"},
+		{[]string{"ZRANGEBYSCORE", "z", "-inf", "+inf", "LIMIT", "1", "2"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGEBYSCORE", "z", "0", "1", "BYLEX"}, "-ERR syntax error\r\n"},
+		{[]string{"ZREVRANGEBYSCORE", "z", "2", "-inf", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"ZRANGEBYLEX", "z", "(a", "[c"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZREVRANGEBYLEX", "z", "+", "(c"}, "*1\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGE", "missing", "0", "-1"}, "*0\r\n"},
+	})
+}
+
+func TestZCountCommands(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("ZADD", "z", "0", "a", "0", "b", "0", "c")
+	h.do("ZADD", "s", "1", "x", "2", "y", "3", "z")
+	runSteps(t, h, []step{
+		{[]string{"ZCOUNT", "s", "(1", "+inf"}, ":2\r\n"},
+		{[]string{"ZCOUNT", "s", "-inf", "(1"}, ":0\r\n"},
+		{[]string{"ZCOUNT", "s", "x", "1"}, "-ERR min or max is not a float\r\n"},
+		{[]string{"ZLEXCOUNT", "z", "-", "+"}, ":3\r\n"},
+		{[]string{"ZLEXCOUNT", "z", "(a", "[c"}, ":2\r\n"},
+		{[]string{"ZLEXCOUNT", "z", "a", "+"}, "-ERR min or max not valid string range item\r\n"},
+		{[]string{"ZLEXCOUNT", "missing", "-", "+"}, ":0\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "s", "2", "+inf", "BYSCORE"}, ":2\r\n"},
+		{[]string{"ZRANGE", "dst", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\ny\r\n$1\r\n2\r\n$1\r\nz\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "s", "0", "-1", "WITHSCORES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "s", "10", "20"}, ":0\r\n"},
+		{[]string{"EXISTS", "dst"}, ":0\r\n"},
+	})
+}
+
+func TestZADD(t *testing.T) {
+	h := newTestHandler(t)
+	runSteps(t, h, []step{
+		{[]string{"ZADD", "z", "1", "a", "2", "b"}, ":2\r\n"},
+		{[]string{"ZADD", "z", "nx", "5", "a", "3", "c"}, ":1\r\n"},
+		{[]string{"ZADD", "z", "XX", "CH", "5", "a", "4", "d"}, ":1\r\n"},
+		{[]string{"ZADD", "z", "GT", "CH", "1", "a", "9", "b"}, ":1\r\n"},
+		{[]string{"ZADD", "z", "INCR", "1.5", "a"}, "$3\r\n6.5\r\n"},
+		{[]string{"ZADD", "z", "NX", "INCR", "1", "a"}, "$-1\r\n"},
+		{[]string{"ZADD", "z", "-inf", "low", "+inf", "high"}, ":2\r\n"},
+		{[]string{"ZSCORE", "z", "high"}, "$3\r\ninf\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1"}, "*5\r\n$3\r\nlow\r\n$1\r\nc\r\n$1\r\na\r\n$1\r\nb\r\n$4\r\nhigh\r\n"},
+		{[]string{"ZADD", "z", "nan", "a"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"ZADD", "z", "1", "a", "x", "b"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"ZADD", "z", "1"}, "-ERR wrong number of arguments for 'zadd' command\r\n"},
+		{[]string{"ZADD", "z", "1", "a", "2"}, "-ERR syntax error\r\n"},
+		{[]string{"ZADD", "z", "NX", "XX", "1", "a"}, "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "z", "GT", "LT", "1", "a"}, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "z", "NX", "GT", "1", "a"}, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "z", "INCR", "1", "a", "2", "b"}, "-ERR INCR option supports a single increment-element pair\r\n"},
+		{[]string{"ZADD", "z", "INCR", "-inf", "high"}, "-ERR resulting score is not a number (NaN)\r\n"},
+		{[]string{"ZADD", "missing", "XX", "1", "a"}, ":0\r\n"},
+		{[]string{"EXISTS", "missing"}, ":0\r\n"},
+		{[]string{"ZINCRBY", "z", "2", "c"}, "$1\r\n5\r\n"},
+		{[]string{"ZINCRBY", "z", "1", "new"}, "$1\r\n1\r\n"},
+		{[]string{"ZINCRBY", "z", "x", "c"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"ZINCRBY", "z", "1"}, "-ERR wrong number of arguments for 'zincrby' command\r\n"},
+	})
+}
+
+func TestZSetOpCommands(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("ZADD", "a", "1", "x", "2", "y")
+	h.do("ZADD", "b", "3", "y", "4", "z")
+	h.do("SADD", "s", "x", "z")
+	runSteps(t, h, []step{
+		{[]string{"ZUNION", "2", "a", "b", "WITHSCORES"}, "*6\r\n$1\r\nx\r\n$1\r\n1\r\n$1\r\nz\r\n$1\r\n4\r\n$1\r\ny\r\n$1\r\n5\r\n"},
+		{[]string{"ZUNION", "2", "a", "b", "weights", "1", "0.5", "aggregate", "max"}, "*3\r\n$1\r\nx\r\n$1\r\ny\r\n$1\r\nz\r\n"},
+		{[]string{"ZINTER", "2", "a", "s", "WITHSCORES"}, "*2\r\n$1\r\nx\r\n$1\r\n2\r\n"},
+		{[]string{"ZINTER", "2", "a", "b", "AGGREGATE", "MIN", "WITHSCORES"}, "*2\r\n$1\r\ny\r\n$1\r\n2\r\n"},
+		{[]string{"ZDIFF", "2", "b", "s"}, "*1\r\n$1\r\ny\r\n"},
+		{[]string{"ZUNIONSTORE", "dst", "3", "a", "b", "s"}, ":3\r\n"},
+		{[]string{"ZRANGE", "dst", "0", "-1", "WITHSCORES"}, "*6\r\n$1\r\nx\r\n$1\r\n2\r\n$1\r\ny\r\n$1\r\n5\r\n$1\r\nz\r\n$1\r\n5\r\n"},
+		{[]string{"ZINTERSTORE", "dst", "2", "a", "b", "WEIGHTS", "2", "2"}, ":1\r\n"},
+		{[]string{"ZSCORE", "dst", "y"}, "$2\r\n10\r\n"},
+		{[]string{"ZDIFFSTORE", "dst", "2", "a", "a"}, ":0\r\n"},
+		{[]string{"EXISTS", "dst"}, ":0\r\n"},
+		{[]string{"ZINTERCARD", "2", "a", "b"}, ":1\r\n"},
+		{[]string{"ZINTERCARD", "2", "a", "s", "LIMIT", "1"}, ":1\r\n"},
+
+		{[]string{"ZUNION", "0", "a"}, "-ERR at least 1 input key is needed for 'zunion' command\r\n"},
+		{[]string{"ZUNIONSTORE", "dst", "0", "a"}, "-ERR at least 1 input key is needed for 'zunionstore' command\r\n"},
+		{[]string{"ZUNION", "x", "a"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ZUNION", "3", "a", "b"}, "-ERR syntax error\r\n"},
+		{[]string{"ZUNION", "2", "a", "b", "WEIGHTS", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"ZUNION", "2", "a", "b", "WEIGHTS", "1", "x"}, "-ERR weight value is not a float\r\n"},
+		{[]string{"ZUNION", "1", "a", "AGGREGATE", "AVG"}, "-ERR syntax error\r\n"},
+		{[]string{"ZDIFF", "1", "a", "WEIGHTS", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"ZUNIONSTORE", "dst", "1", "a", "WITHSCORES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZINTERCARD", "0", "a"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"ZINTERCARD", "1", "a", "LIMIT", "-1"}, "-ERR LIMIT can't be negative\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"ZUNION", "2", "a", "str"}, wrongType},
+		{[]string{"ZINTERCARD", "2", "a", "str"}, wrongType},
+	})
+}
+
+func TestZPopCommands(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	runSteps(t, h, []step{
+		{[]string{"ZPOPMIN", "z"}, "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"ZPOPMAX", "z", "2"}, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"ZPOPMIN", "missing"}, "*0\r\n"},
+		{[]string{"ZPOPMIN", "z", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"ZPOPMIN", "z", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"BZPOPMAX", "missing", "z", "0"}, "*3\r\n$1\r\nz\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"EXISTS", "z"}, ":0\r\n"},
+		{[]string{"BZPOPMIN", "z", "0.01"}, "*-1\r\n"},
+		{[]string{"ZADD", "y", "5", "e", "6", "f"}, ":2\r\n"},
+		{[]string{"ZMPOP", "2", "z", "y", "MAX", "COUNT", "5"}, "*2\r\n$1\r\ny\r\n*2\r\n*2\r\n$1\r\nf\r\n$1\r\n6\r\n*2\r\n$1\r\ne\r\n$1\r\n5\r\n"},
+		{[]string{"ZMPOP", "1", "y", "MIN"}, "*-1\r\n"},
+		{[]string{"ZMPOP", "1", "y", "LEFT"}, "-ERR syntax error\r\n"},
+		{[]string{"BZMPOP", "0.01", "1", "y", "MIN"}, "*-1\r\n"},
+		{[]string{"BZMPOP", "x", "1", "y", "MIN"}, "-ERR timeout is not a float or out of range\r\n"},
+		{[]string{"BZMPOP", "0", "0", "y", "MIN"}, "-ERR numkeys should be greater than 0\r\n"},
+	})
+
+	// RESP3 keeps the flat reply of a single pop, pairs with a count
+	h.do("HELLO", "3")
+	h.do("ZADD", "z", "1", "a", "2", "b")
+	runSteps(t, h, []step{
+		{[]string{"ZPOPMIN", "z"}, "*2\r\n$1\r\na\r\n,1\r\n"},
+		{[]string{"ZPOPMIN", "z", "1"}, "*1\r\n*2\r\n$1\r\nb\r\n,2\r\n"},
+		{[]string{"BZPOPMIN", "z", "0.01"}, "_\r\n"},
+	})
+}
+
+// A blocked pop is replicated as the ZPOPMIN or ZPOPMAX it performed.
+func TestBZPOPPropagation(t *testing.T) {
+	h := newTestHandler(t)
+	stream := replicaStream(t, h)
+	blocked := newTestClient(t, h.s)
+	done := make(chan string)
+	go func() {
+		done <- blocked.do("BZMPOP", "5", "1", "z", "MAX", "COUNT", "2")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	h.do("ZADD", "z", "1", "a", "2", "b", "3", "c")
+	select {
+	case got := <-done:
+		if want := "*2\r\n$1\r\nz\r\n*2\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"; got != want {
+			t.Errorf("BZMPOP = %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BZMPOP not served")
+	}
+	h.do("BZPOPMIN", "z", "0")
+
+	want := "*3\r\n$7\r\nZPOPMAX\r\n$1\r\nz\r\n$1\r\n2\r\n*2\r\n$7\r\nZPOPMIN\r\n$1\r\nz\r\n"
+	if got := stream(); !strings.HasSuffix(got, want) || strings.Contains(got, "BZ") {
+		t.Errorf("stream = %q, want it to end with %q", got, want)
+	}
+}
+
+func TestZRankAndRemoveCommands(t *testing.T) {
+	h := newTestHandler(t)
+	h.do("ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	runSteps(t, h, []step{
+		{[]string{"ZRANK", "z", "b"}, ":1\r\n"},
+		{[]string{"ZREVRANK", "z", "b"}, ":3\r\n"},
+		{[]string{"ZRANK", "z", "c", "WITHSCORE"}, "*2\r\n:2\r\n$1\r\n3\r\n"},
+		{[]string{"ZREVRANK", "z", "e", "withscore"}, "*2\r\n:0\r\n$1\r\n5\r\n"},
+		{[]string{"ZREVRANK", "z", "missing"}, "$-1\r\n"},
+		{[]string{"ZREVRANK", "z", "missing", "WITHSCORE"}, "*-1\r\n"},
+		{[]string{"ZRANK", "z", "a", "WITHSCORES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZMSCORE", "z", "a", "missing", "e"}, "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n5\r\n"},
+		{[]string{"ZMSCORE", "missing", "a"}, "*1\r\n$-1\r\n"},
+		{[]string{"ZMSCORE", "z"}, "-ERR wrong number of arguments for 'zmscore' command\r\n"},
+		{[]string{"ZRANDMEMBER", "missing"}, "$-1\r\n"},
+		{[]string{"ZRANDMEMBER", "missing", "3"}, "*0\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "0"}, "*0\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "1", "SCORES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ZREMRANGEBYRANK", "z", "0", "0"}, ":1\r\n"},
+		{[]string{"ZREMRANGEBYSCORE", "z", "(4", "+inf"}, ":1\r\n"},
+		{[]string{"ZREMRANGEBYLEX", "z", "[c", "[z"}, ":2\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1"}, "*1\r\n$1\r\nb\r\n"},
+		{[]string{"ZREMRANGEBYSCORE", "z", "x", "1"}, "-ERR min or max is not a float\r\n"},
+		{[]string{"ZREMRANGEBYLEX", "z", "b", "+"}, "-ERR min or max not valid string range item\r\n"},
+		{[]string{"ZREMRANGEBYRANK", "z", "0", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ZADD", "z", "3", "c", "4", "d"}, ":2\r\n"},
+		{[]string{"ZREM", "z", "b", "missing", "d"}, ":2\r\n"},
+		{[]string{"ZREM", "z", "c"}, ":1\r\n"},
+		{[]string{"EXISTS", "z"}, ":0\r\n"},
+		{[]string{"ZREM", "z"}, "-ERR wrong number of arguments for 'zrem' command\r\n"},
+	})
+
+	// a negative count may repeat members, WITHSCORES pairs them
+	h.do("ZADD", "one", "7", "m")
+	if got, want := h.do("ZRANDMEMBER", "one", "-3", "WITHSCORES"), "*6\r\n"+strings.Repeat("$1\r\nm\r\n$1\r\n7\r\n", 3); got != want {
+		t.Errorf("ZRANDMEMBER one -3 WITHSCORES = %q, want %q", got, want)
+	}
+	if got, want := h.do("ZRANDMEMBER", "one", "5"), "*1\r\n$1\r\nm\r\n"; got != want {
+		t.Errorf("ZRANDMEMBER one 5 = %q, want %q", got, want)
+	}
+}